@@ -13,6 +13,13 @@ Hence, for each subfolder (package), there should be a correspondong entry
   apis.internal.[name].module.url.base
 set to the API endpoint, without a trailing slash (/)
 
+Cached reference data (e.g. GetCachedSupportInfo) can optionally be tuned with
+  apis.cache.[name].ttl    (how long a value is considered fresh, e.g. "10m")
+  apis.cache.[name].retry  (how often a failed refresh is retried, e.g. "1m")
+  apis.cache.[name].max    (maximum number of values cached, e.g. 1000)
+where [name] is supportinfo, contract or signature. Contracts and signatures are cached per
+caller token, so max defaults to 1000 for them.
+
 To use the API with the config, call Init() with a valid config object.
 
 If any API calls is used without Init(), the call panic instead
@@ -0,0 +1,33 @@
+package core
+
+import (
+	"github.com/Mobility-Development-Team/be-common-mdl/apis"
+	"github.com/Mobility-Development-Team/be-common-mdl/model"
+	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+	"github.com/Mobility-Development-Team/be-common-mdl/util/cacheutil"
+)
+
+const (
+	cacheSupportInfoConfig = "apis.cache.supportinfo"
+	cacheContractConfig    = "apis.cache.contract"
+)
+
+var referenceCache = cacheutil.NewReferenceDataCache[model.GetCoreContractResponse](apis.V, cacheSupportInfoConfig, cacheContractConfig, GetSupportInfo, GetOneContract)
+
+// GetCachedSupportInfo A cached version of GetSupportInfo, the map returned is a copy.
+// The last good value is returned if the core module is unavailable, see cacheutil.SWRCache
+func GetCachedSupportInfo() (map[string]string, cacheutil.Freshness, error) {
+	return referenceCache.SupportInfo()
+}
+
+// GetCachedOneContract A cached version of GetOneContract, cached per caller token so that a
+// contract is only served to callers allowed to get it. The contract returned is a deep copy.
+// The last good value is returned if the core module is unavailable, see cacheutil.SWRCache
+func GetCachedOneContract(tk string, contractId intstring.IntString) (model.GetCoreContractResponse, cacheutil.Freshness, error) {
+	return referenceCache.Contract(tk, contractId)
+}
+
+// InvalidateCachedContract removes a contract from the cache, e.g. after it is updated
+func InvalidateCachedContract(contractId intstring.IntString) {
+	referenceCache.InvalidateContract(contractId)
+}
@@ -297,16 +297,16 @@ func GetSupportInfo() (map[string]string, error) {
 	return resp.Payload, nil
 }
 
-// A version of GetSupportInfo that logs the error and retruns the initialized map value on error
+// A version of GetSupportInfo that logs the error and retruns the initialized map value on error.
+// The value is served from GetCachedSupportInfo, so the last good value is returned during outages.
 func ShouldGetSupportInfo() map[string]string {
-	supportInfo, err := GetSupportInfo()
+	supportInfo, freshness, err := GetCachedSupportInfo()
 	if err != nil {
-		logger.Error("[ShouldGetSupportInfo] Unable to get support info, support info would be missing for functions depending on it")
+		logger.Error("[ShouldGetSupportInfo] Unable to get support info, support info would be missing for functions depending on it: ", err)
 		return map[string]string{}
 	}
-	if supportInfo == nil {
-		logger.Error("[ShouldGetSupportInfo] Call was successful but a nil support info was received")
-		return map[string]string{}
+	if freshness.LastError != nil {
+		logger.Warnf("[ShouldGetSupportInfo] Using support info fetched %s ago: %v", freshness.Age(), freshness.LastError)
 	}
 	return supportInfo
 }
@@ -377,6 +377,12 @@ func PopulateUserInfo(tk string, userInfo []*model.UserInfo) error {
 }
 
 func GetLocations(tk string, body map[string]interface{}) (map[intstring.IntString][]*model.Location, error) {
+	output, _, err := getLocations(tk, body)
+	return output, err
+}
+
+// getLocations is GetLocations returning the total number of locations matched as well
+func getLocations(tk string, body map[string]interface{}) (map[intstring.IntString][]*model.Location, int, error) {
 	var resp struct {
 		response.Response
 		Payload struct {
@@ -389,10 +395,10 @@ func GetLocations(tk string, body map[string]interface{}) (map[intstring.IntStri
 	result, err := client.R().SetAuthToken(tk).SetBody(body).Post(fmt.Sprintf(urlPath, apis.V().GetString(apiCoreMdlUrlBase)))
 	if err != nil {
 		logger.Error("[GetLocations]", "err:", err)
-		return map[intstring.IntString][]*model.Location{}, err
+		return map[intstring.IntString][]*model.Location{}, 0, err
 	}
 	if err = json.Unmarshal(result.Body(), &resp); err != nil {
-		return map[intstring.IntString][]*model.Location{}, err
+		return map[intstring.IntString][]*model.Location{}, 0, err
 	}
 
 	output := map[intstring.IntString][]*model.Location{}
@@ -429,7 +435,7 @@ func GetLocations(tk string, body map[string]interface{}) (map[intstring.IntStri
 
 	}
 
-	return output, nil
+	return output, resp.Payload.TotalCount, nil
 }
 
 func GetContractUserByUids(tk string, contractId intstring.IntString, uids ...intstring.IntString) (map[intstring.IntString]*intstring.IntString, error) {
@@ -812,19 +818,22 @@ func GetRoleHastag(tk string) ([]model.HashtagInfo, error) {
 
 func GetLocationHashtagByContractId(tk string, contractId intstring.IntString) ([]model.HashtagInfo, error) {
 	lhi := []model.HashtagInfo{}
-	locInfos, err := GetLocations(tk, map[string]interface{}{
-		"contractId": contractId,
-	})
+	page, err := GetLocationsByCriteria(tk, *NewLocationCriteria(contractId))
 	if err != nil {
 		return nil, err
 	}
+	locInfos := page.Locations
 
 	if len(locInfos) > 0 {
 		for _, r := range locInfos {
 			for _, c := range r {
+				name := c.Name
+				if c.NameZh != nil && *c.NameZh != "" {
+					name = fmt.Sprintf("%s %s", c.Name, *c.NameZh)
+				}
 				lhi = append(lhi, model.HashtagInfo{
 					Id:         c.Id,
-					Name:       fmt.Sprintf("%s %s", c.Name, *c.NameZh),
+					Name:       name,
 					Type:       "LOCATION",
 					UserRefKey: c.Uuid,
 				})
@@ -0,0 +1,339 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/genericjson"
+	"github.com/Mobility-Development-Team/be-common-mdl/model"
+	"github.com/Mobility-Development-Team/be-common-mdl/model/pagination"
+	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+)
+
+// Values accepted by the status and extra send fields of the criteria below
+const (
+	StatusActive   = "ACTIVE"
+	StatusInactive = "INACTIVE"
+	ExtraSendOn    = "on"
+	ExtraSendOff   = "off"
+)
+
+type (
+	// UserCriteria is the request body of GetAllUserInfo
+	UserCriteria struct {
+		ContractId  *intstring.IntString   `json:"contractId,omitempty"`
+		PartyId     *intstring.IntString   `json:"partyId,omitempty"`
+		Ids         []intstring.IntString  `json:"ids,omitempty"`
+		UserKeyRefs []string               `json:"userKeyRefs,omitempty"`
+		Status      string                 `json:"status,omitempty"`
+		Pagination  *pagination.Pagination `json:"-"`
+	}
+
+	// RoleUserCriteria is the request body of GetUsersIdByRole
+	RoleUserCriteria struct {
+		RoleName   string                 `json:"roleName"`
+		ContractId intstring.IntString    `json:"contractId"`
+		PartyId    *intstring.IntString   `json:"partyId,omitempty"`
+		Pagination *pagination.Pagination `json:"-"`
+	}
+
+	// GroupedUserCriteria is the request body of GetUsersByGroupCriteria
+	GroupedUserCriteria struct {
+		ContractId intstring.IntString    `json:"contractId"`
+		PartyId    *intstring.IntString   `json:"partyId,omitempty"`
+		RoleNames  []string               `json:"roleNames,omitempty"`
+		Pagination *pagination.Pagination `json:"-"`
+	}
+
+	// ContractUserMapCriteria is the request body of GetManyContractMapUsers
+	ContractUserMapCriteria struct {
+		ContractIds         []intstring.IntString  `json:"contractIds"`
+		UserIds             []intstring.IntString  `json:"userIds,omitempty"`
+		ContractIsExtraSend string                 `json:"contractIsExtraSend,omitempty"`
+		UserIsExtraSend     string                 `json:"userIsExtraSend,omitempty"`
+		UserStatus          string                 `json:"userStatus,omitempty"`
+		ContractStatus      string                 `json:"contractStatus,omitempty"`
+		Pagination          *pagination.Pagination `json:"-"`
+	}
+
+	// LocationCriteria is the request body of GetLocations
+	LocationCriteria struct {
+		ContractId   *intstring.IntString   `json:"contractId,omitempty"`
+		Ids          []intstring.IntString  `json:"ids,omitempty"`
+		Status       string                 `json:"status,omitempty"`
+		LocationType string                 `json:"locationType,omitempty"`
+		Pagination   *pagination.Pagination `json:"-"`
+	}
+
+	// LocationPage is a page of GetLocationsByCriteria, the totals are set if the criteria is paginated
+	LocationPage struct {
+		Locations  map[intstring.IntString][]*model.Location
+		TotalRows  int64
+		TotalPages int
+	}
+
+	// Criteria is implemented by the criteria of query endpoints to validate them before sending
+	Criteria interface {
+		Validate() error
+	}
+)
+
+func NewUserCriteria() *UserCriteria {
+	return &UserCriteria{}
+}
+
+func (c *UserCriteria) InContract(contractId intstring.IntString) *UserCriteria {
+	c.ContractId = &contractId
+	return c
+}
+
+func (c *UserCriteria) InParty(partyId intstring.IntString) *UserCriteria {
+	c.PartyId = &partyId
+	return c
+}
+
+func (c *UserCriteria) WithIds(ids ...intstring.IntString) *UserCriteria {
+	c.Ids = append(c.Ids, ids...)
+	return c
+}
+
+func (c *UserCriteria) WithUserKeyRefs(userKeyRefs ...string) *UserCriteria {
+	c.UserKeyRefs = append(c.UserKeyRefs, userKeyRefs...)
+	return c
+}
+
+func (c *UserCriteria) WithStatus(status string) *UserCriteria {
+	c.Status = status
+	return c
+}
+
+func (c *UserCriteria) Paginate(p *pagination.Pagination) *UserCriteria {
+	c.Pagination = p
+	return c
+}
+
+func (c UserCriteria) Validate() error {
+	return ValidateStatus("status", c.Status)
+}
+
+func NewRoleUserCriteria(contractId intstring.IntString, roleName string) *RoleUserCriteria {
+	return &RoleUserCriteria{
+		RoleName:   roleName,
+		ContractId: contractId,
+	}
+}
+
+func (c *RoleUserCriteria) InParty(partyId intstring.IntString) *RoleUserCriteria {
+	c.PartyId = &partyId
+	return c
+}
+
+func (c *RoleUserCriteria) Paginate(p *pagination.Pagination) *RoleUserCriteria {
+	c.Pagination = p
+	return c
+}
+
+func (c RoleUserCriteria) Validate() error {
+	if c.RoleName == "" {
+		return errors.New("invalid criteria: roleName is required")
+	}
+	if c.ContractId == 0 {
+		return errors.New("invalid criteria: contractId is required")
+	}
+	return nil
+}
+
+func NewGroupedUserCriteria(contractId intstring.IntString) *GroupedUserCriteria {
+	return &GroupedUserCriteria{
+		ContractId: contractId,
+	}
+}
+
+func (c *GroupedUserCriteria) InParty(partyId intstring.IntString) *GroupedUserCriteria {
+	c.PartyId = &partyId
+	return c
+}
+
+func (c *GroupedUserCriteria) WithRoleNames(roleNames ...string) *GroupedUserCriteria {
+	c.RoleNames = append(c.RoleNames, roleNames...)
+	return c
+}
+
+func (c *GroupedUserCriteria) Paginate(p *pagination.Pagination) *GroupedUserCriteria {
+	c.Pagination = p
+	return c
+}
+
+func (c GroupedUserCriteria) Validate() error {
+	if c.ContractId == 0 {
+		return errors.New("invalid criteria: contractId is required")
+	}
+	return nil
+}
+
+func NewContractUserMapCriteria(contractIds ...intstring.IntString) *ContractUserMapCriteria {
+	return &ContractUserMapCriteria{
+		ContractIds: contractIds,
+	}
+}
+
+func (c *ContractUserMapCriteria) WithUserIds(userIds ...intstring.IntString) *ContractUserMapCriteria {
+	c.UserIds = append(c.UserIds, userIds...)
+	return c
+}
+
+// WithExtraSend restricts the result to contracts and users with the given extra send settings,
+// empty values are not restricted
+func (c *ContractUserMapCriteria) WithExtraSend(contractIsExtraSend, userIsExtraSend string) *ContractUserMapCriteria {
+	c.ContractIsExtraSend = contractIsExtraSend
+	c.UserIsExtraSend = userIsExtraSend
+	return c
+}
+
+// WithStatus restricts the result to contracts and users with the given status,
+// empty values are not restricted
+func (c *ContractUserMapCriteria) WithStatus(contractStatus, userStatus string) *ContractUserMapCriteria {
+	c.ContractStatus = contractStatus
+	c.UserStatus = userStatus
+	return c
+}
+
+func (c *ContractUserMapCriteria) Paginate(p *pagination.Pagination) *ContractUserMapCriteria {
+	c.Pagination = p
+	return c
+}
+
+func (c ContractUserMapCriteria) Validate() error {
+	if len(c.ContractIds) == 0 {
+		return errors.New("invalid criteria: contractIds must not be empty")
+	}
+	if err := validateExtraSend("contractIsExtraSend", c.ContractIsExtraSend); err != nil {
+		return err
+	}
+	if err := validateExtraSend("userIsExtraSend", c.UserIsExtraSend); err != nil {
+		return err
+	}
+	if err := ValidateStatus("contractStatus", c.ContractStatus); err != nil {
+		return err
+	}
+	return ValidateStatus("userStatus", c.UserStatus)
+}
+
+func NewLocationCriteria(contractId intstring.IntString) *LocationCriteria {
+	return &LocationCriteria{
+		ContractId: &contractId,
+	}
+}
+
+func (c *LocationCriteria) WithIds(ids ...intstring.IntString) *LocationCriteria {
+	c.Ids = append(c.Ids, ids...)
+	return c
+}
+
+func (c *LocationCriteria) WithStatus(status string) *LocationCriteria {
+	c.Status = status
+	return c
+}
+
+func (c *LocationCriteria) WithLocationType(locationType string) *LocationCriteria {
+	c.LocationType = locationType
+	return c
+}
+
+func (c *LocationCriteria) Paginate(p *pagination.Pagination) *LocationCriteria {
+	c.Pagination = p
+	return c
+}
+
+func (c LocationCriteria) Validate() error {
+	if c.ContractId == nil && len(c.Ids) == 0 {
+		return errors.New("invalid criteria: either contractId or ids must be specified")
+	}
+	return ValidateStatus("status", c.Status)
+}
+
+// The endpoints below return a plain list without totals, a page with fewer rows than the
+// pagination limit is the last one.
+
+func GetAllUserInfoByCriteria(tk string, c UserCriteria) ([]model.GetUserResponse, error) {
+	body, err := CriteriaBody(c, c.Pagination)
+	if err != nil {
+		return nil, err
+	}
+	return GetAllUserInfo(tk, body)
+}
+
+func GetUsersIdByRoleCriteria(tk string, c RoleUserCriteria) ([]intstring.IntString, error) {
+	body, err := CriteriaBody(c, c.Pagination)
+	if err != nil {
+		return nil, err
+	}
+	return GetUsersIdByRole(tk, body)
+}
+
+func GetUsersByGroupedCriteria(tk string, c GroupedUserCriteria) (map[string][]model.UserInfo, error) {
+	body, err := CriteriaBody(c, c.Pagination)
+	if err != nil {
+		return nil, err
+	}
+	return GetUsersByGroupCriteria(tk, body)
+}
+
+func GetManyContractMapUsersByCriteria(tk string, c ContractUserMapCriteria) ([]model.ContractToUserDetailMap, error) {
+	body, err := CriteriaBody(c, c.Pagination)
+	if err != nil {
+		return nil, err
+	}
+	return GetManyContractMapUsers(tk, body)
+}
+
+// GetLocationsByCriteria returns the locations matching c with the total number of locations matched.
+// The totals are also set on c.Pagination if given, as done by the modules with their own pagination.
+func GetLocationsByCriteria(tk string, c LocationCriteria) (*LocationPage, error) {
+	body, err := CriteriaBody(c, c.Pagination)
+	if err != nil {
+		return nil, err
+	}
+	locations, totalCount, err := getLocations(tk, body)
+	if err != nil {
+		return nil, err
+	}
+	page := &LocationPage{Locations: locations, TotalRows: int64(totalCount), TotalPages: 1}
+	if p := c.Pagination; p != nil {
+		page.TotalPages = int(math.Ceil(float64(totalCount) / float64(p.GetLimit())))
+		p.TotalRows, p.TotalPages = page.TotalRows, page.TotalPages
+	}
+	return page, nil
+}
+
+// CriteriaBody validates c and converts it into a request body, merging the pagination params if p is given
+func CriteriaBody(c Criteria, p *pagination.Pagination) (map[string]interface{}, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	body := genericjson.NewObject(c)
+	if p != nil {
+		for k, v := range p.Params() {
+			body[k] = v
+		}
+	}
+	return body, nil
+}
+
+// ValidateStatus returns an error if status is neither empty, StatusActive nor StatusInactive
+func ValidateStatus(field, status string) error {
+	switch status {
+	case "", StatusActive, StatusInactive:
+		return nil
+	}
+	return fmt.Errorf("invalid criteria: %s must be either %s or %s, got %q", field, StatusActive, StatusInactive, status)
+}
+
+func validateExtraSend(field, value string) error {
+	switch value {
+	case "", ExtraSendOn, ExtraSendOff:
+		return nil
+	}
+	return fmt.Errorf("invalid criteria: %s must be either %s or %s, got %q", field, ExtraSendOn, ExtraSendOff, value)
+}
@@ -0,0 +1,114 @@
+package core
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/apis"
+	"github.com/Mobility-Development-Team/be-common-mdl/model/pagination"
+	"github.com/spf13/viper"
+)
+
+func TestCriteriaBody(t *testing.T) {
+	tests := []struct {
+		name     string
+		criteria Criteria
+		page     *pagination.Pagination
+		want     map[string]interface{}
+		wantErr  bool
+	}{
+		{
+			name: "Contract user map",
+			criteria: NewContractUserMapCriteria(38, 39).
+				WithExtraSend(ExtraSendOn, ExtraSendOn).
+				WithStatus(StatusActive, StatusActive),
+			want: map[string]interface{}{
+				"contractIds":         []interface{}{"38", "39"},
+				"contractIsExtraSend": "on",
+				"userIsExtraSend":     "on",
+				"contractStatus":      "ACTIVE",
+				"userStatus":          "ACTIVE",
+			},
+		},
+		{
+			name:     "Contract user map without contracts",
+			criteria: NewContractUserMapCriteria(),
+			wantErr:  true,
+		},
+		{
+			name:     "Contract user map with invalid extra send",
+			criteria: NewContractUserMapCriteria(38).WithExtraSend("yes", ""),
+			wantErr:  true,
+		},
+		{
+			name:     "Role users with pagination",
+			criteria: NewRoleUserCriteria(38, "ADMIN").InParty(2),
+			page:     &pagination.Pagination{Limit: 20, Page: 3},
+			want: map[string]interface{}{
+				"roleName":   "ADMIN",
+				"contractId": "38",
+				"partyId":    "2",
+				"isPaginate": true,
+				"limit":      20,
+				"page":       3,
+			},
+		},
+		{
+			name:     "Role users without role name",
+			criteria: NewRoleUserCriteria(38, ""),
+			wantErr:  true,
+		},
+		{
+			name:     "Users with invalid status",
+			criteria: NewUserCriteria().WithStatus("DELETED"),
+			wantErr:  true,
+		},
+		{
+			name:     "Locations without contract or ids",
+			criteria: &LocationCriteria{},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CriteriaBody(tt.criteria, tt.page)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CriteriaBody() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CriteriaBody() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetLocationsByCriteria(t *testing.T) {
+	var gotBody map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&gotBody)
+		_, _ = w.Write([]byte(`{"payload":{"locations":[{"id":"1","name":"Block A"},{"id":"2","name":"Block B"}],"totalCount":45}}`))
+	}))
+	defer srv.Close()
+	v := viper.New()
+	v.Set(apiCoreMdlUrlBase, srv.URL)
+	apis.Init(v)
+
+	p := &pagination.Pagination{Limit: 20, Page: 2}
+	page, err := GetLocationsByCriteria("tk", *NewLocationCriteria(38).Paginate(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotBody["page"] != float64(2) || gotBody["limit"] != float64(20) {
+		t.Errorf("pagination not sent, body %v", gotBody)
+	}
+	if len(page.Locations) != 2 || page.TotalRows != 45 || page.TotalPages != 3 {
+		t.Errorf("GetLocationsByCriteria() = %d locations, %d rows, %d pages", len(page.Locations), page.TotalRows, page.TotalPages)
+	}
+	if p.TotalRows != 45 || p.TotalPages != 3 {
+		t.Errorf("pagination totals not set, got %d rows, %d pages", p.TotalRows, p.TotalPages)
+	}
+}
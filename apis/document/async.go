@@ -0,0 +1,282 @@
+package document
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/apis"
+	"github.com/Mobility-Development-Team/be-common-mdl/common"
+	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+	"github.com/Mobility-Development-Team/be-common-mdl/util/concutil"
+	logger "github.com/sirupsen/logrus"
+)
+
+// The async protocol, i.e. "async": true in the request body answered by 202 with a job id that is
+// polled at getReportJob, is not confirmed by the document module yet. It is only used if enabled
+// with `apis.internal.document.async.enabled`, otherwise the reports are generated synchronously.
+const (
+	asyncEnabledConfig = "apis.internal.document.async.enabled"
+	getReportJob       = "%s/documents/jobs/%s"
+
+	defaultPollInitial     = time.Second
+	defaultPollMax         = 15 * time.Second
+	defaultPollMultiplier  = 2.0
+	defaultPollTimeout     = 10 * time.Minute
+	defaultAsyncConcurrent = 5
+)
+
+// Statuses of ReportJob
+const (
+	ReportJobPending   = "PENDING"
+	ReportJobRunning   = "RUNNING"
+	ReportJobCompleted = "COMPLETED"
+	ReportJobFailed    = "FAILED"
+)
+
+var (
+	// ErrReportJobFailed is returned by AwaitReportJob if the document module failed to generate the report
+	ErrReportJobFailed = errors.New("report job failed")
+	// ErrReportJobRejected is returned by GetReportJob if the document module rejects the request,
+	// e.g. the job does not exist or the token is not authorized. AwaitReportJob does not retry it.
+	ErrReportJobRejected = errors.New("report job request rejected")
+)
+
+type (
+	// ReportJob is a report generated asynchronously by the document module
+	ReportJob struct {
+		Id         string `json:"jobId"`
+		ReportType string `json:"reportType"`
+		Status     string `json:"status"`
+		// Set once the job is COMPLETED
+		Url string `json:"url"`
+		// Reason of a FAILED job
+		Error string `json:"error"`
+		// Report type and publish flag requested
+		rt        ReportType
+		published bool
+	}
+	// PollOptions is the exponential backoff of AwaitReportJob, zero values use the defaults
+	PollOptions struct {
+		Initial    time.Duration // Defaults to 1s
+		Max        time.Duration // Defaults to 15s
+		Multiplier float64       // Defaults to 2
+		// Total time to wait for the job, defaults to 10m. The context deadline applies as well.
+		Timeout time.Duration
+	}
+	AsyncOptions struct {
+		GenerateOptions
+		Poll PollOptions
+		// Called once the report is generated or has failed, from the goroutine awaiting it
+		OnComplete func(id intstring.IntString, report *GeneratedReport, err error)
+		// Maximum number of reports generated at the same time by GenerateAll, defaults to 5
+		MaxConcurrent int
+	}
+)
+
+// Done returns true if the job is COMPLETED or FAILED
+func (j ReportJob) Done() bool {
+	return j.Status == ReportJobCompleted || j.Status == ReportJobFailed
+}
+
+// GenerateAsync submits a job to generate a report, see Generate. The job can be awaited with
+// AwaitReportJob. If the async protocol is not enabled, or the document module generates the report
+// synchronously, the returned job is already COMPLETED.
+func GenerateAsync(ctx context.Context, reportType string, id intstring.IntString, opts GenerateOptions) (*ReportJob, error) {
+	if !apis.V().GetBool(asyncEnabledConfig) {
+		report, err := Generate(ctx, reportType, id, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &ReportJob{
+			ReportType: reportType,
+			Status:     ReportJobCompleted,
+			Url:        report.Url,
+			rt:         report.Type,
+			published:  report.Published,
+		}, nil
+	}
+	rt, body, published, err := newGenerateBody(reportType, id, opts)
+	if err != nil {
+		return nil, err
+	}
+	body["async"] = true
+	var resp struct {
+		Payload struct {
+			ReportJob
+			Url string `json:"url"`
+		} `json:"payload"`
+	}
+	client := common.NewResty()
+	result, err := client.R().SetContext(ctx).SetAuthToken(opts.Token).SetBody(body).
+		Post(fmt.Sprintf(rt.Endpoint, apis.V().GetString(urlBase)))
+	if err != nil {
+		logger.Errorf("[GenerateAsync] happen err: %+v, reportType %s, id %s", err, reportType, id)
+		return nil, err
+	}
+	if result.StatusCode() != http.StatusAccepted && result.StatusCode() != http.StatusCreated {
+		logger.Errorf("[GenerateAsync] StatusCode happen err result: %+v, reportType %s, id %s", result, reportType, id)
+		return nil, fmt.Errorf("[GenerateAsync] %s status code not 202: %d", reportType, result.StatusCode())
+	}
+	if err = json.Unmarshal(result.Body(), &resp); err != nil {
+		return nil, err
+	}
+	job := resp.Payload.ReportJob
+	job.ReportType, job.rt, job.published = reportType, rt, published
+	if result.StatusCode() == http.StatusCreated {
+		// Generated synchronously
+		job.Status, job.Url = ReportJobCompleted, resp.Payload.Url
+		return &job, nil
+	}
+	if job.Id == "" {
+		return nil, fmt.Errorf("[GenerateAsync] %s document module returned no job id", reportType)
+	}
+	if job.Status == "" {
+		job.Status = ReportJobPending
+	}
+	return &job, nil
+}
+
+// GetReportJob gets the current status of a job
+func GetReportJob(ctx context.Context, tk string, jobId string) (*ReportJob, error) {
+	var resp struct {
+		Payload ReportJob `json:"payload"`
+	}
+	client := common.NewResty()
+	result, err := client.R().SetContext(ctx).SetAuthToken(tk).
+		Get(fmt.Sprintf(getReportJob, apis.V().GetString(urlBase), jobId))
+	if err != nil {
+		return nil, err
+	}
+	if code := result.StatusCode(); code >= 400 && code < 500 && code != http.StatusRequestTimeout && code != http.StatusTooManyRequests {
+		return nil, fmt.Errorf("%w: document module returned status code: %d", ErrReportJobRejected, code)
+	}
+	if !result.IsSuccess() {
+		return nil, fmt.Errorf("document module returned status code: %d", result.StatusCode())
+	}
+	if err = json.Unmarshal(result.Body(), &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Payload, nil
+}
+
+// AwaitReportJob polls the job with backoff until it is done, the timeout is reached or ctx is cancelled.
+// Errors of a single poll are logged and retried, except ErrReportJobRejected which is returned at once.
+func AwaitReportJob(ctx context.Context, tk string, job *ReportJob, opts PollOptions) (*GeneratedReport, error) {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = defaultPollTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	delay := opts.Initial
+	if delay <= 0 {
+		delay = defaultPollInitial
+	}
+	current := *job
+	for !current.Done() {
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("report job %s is %s: %w", job.Id, current.Status, ctx.Err())
+		case <-timer.C:
+		}
+		polled, err := GetReportJob(ctx, tk, job.Id)
+		if errors.Is(err, ErrReportJobRejected) {
+			return nil, fmt.Errorf("report job %s: %w", job.Id, err)
+		}
+		if err != nil {
+			logger.Warnf("[AwaitReportJob] Unable to get job %s, retrying: %v", job.Id, err)
+		} else {
+			current.Status, current.Url, current.Error = polled.Status, polled.Url, polled.Error
+		}
+		delay = nextPollDelay(delay, opts)
+	}
+	if current.Status == ReportJobFailed {
+		return nil, fmt.Errorf("%w: %s %s: %s", ErrReportJobFailed, job.ReportType, job.Id, current.Error)
+	}
+	return &GeneratedReport{Url: current.Url, Type: job.rt, Published: job.published}, nil
+}
+
+// GenerateAwaiter submits and awaits a report job in the background, Get returns a *GeneratedReport
+func GenerateAwaiter(ctx context.Context, reportType string, id intstring.IntString, opts AsyncOptions) *concutil.Awaiter {
+	return concutil.Async(func() (interface{}, error) {
+		report, err := generateAndAwait(ctx, reportType, id, opts)
+		if opts.OnComplete != nil {
+			opts.OnComplete(id, report, err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return report, nil
+	})
+}
+
+// GenerateAll generates a report for each of ids concurrently, e.g. the reports of many permits.
+// The reports generated are returned even if some have failed, in which case the errors are combined.
+func GenerateAll(ctx context.Context, reportType string, ids []intstring.IntString, opts AsyncOptions) (map[intstring.IntString]*GeneratedReport, error) {
+	limit := opts.MaxConcurrent
+	if limit <= 0 {
+		limit = defaultAsyncConcurrent
+	}
+	sem := make(chan struct{}, limit)
+	var mu sync.Mutex
+	result := make(map[intstring.IntString]*GeneratedReport, len(ids))
+	var errs []string
+	awaiters := make([]*concutil.Awaiter, 0, len(ids))
+	for _, id := range ids {
+		id := id
+		awaiters = append(awaiters, concutil.Async(func() (interface{}, error) {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			report, err := generateAndAwait(ctx, reportType, id, opts)
+			if opts.OnComplete != nil {
+				opts.OnComplete(id, report, err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", id, err))
+			} else {
+				result[id] = report
+			}
+			return report, err
+		}))
+	}
+	for _, a := range awaiters {
+		_ = a.Await()
+	}
+	if len(errs) > 0 {
+		return result, fmt.Errorf("failed to generate %d of %d %s reports: %s", len(errs), len(ids), reportType, strings.Join(errs, "; "))
+	}
+	return result, nil
+}
+
+func generateAndAwait(ctx context.Context, reportType string, id intstring.IntString, opts AsyncOptions) (*GeneratedReport, error) {
+	job, err := GenerateAsync(ctx, reportType, id, opts.GenerateOptions)
+	if err != nil {
+		return nil, err
+	}
+	return AwaitReportJob(ctx, opts.Token, job, opts.Poll)
+}
+
+func nextPollDelay(delay time.Duration, opts PollOptions) time.Duration {
+	multiplier, maxDelay := opts.Multiplier, opts.Max
+	if multiplier < 1 {
+		multiplier = defaultPollMultiplier
+	}
+	if maxDelay <= 0 {
+		maxDelay = defaultPollMax
+	}
+	delay = time.Duration(float64(delay) * multiplier)
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
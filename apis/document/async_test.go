@@ -0,0 +1,155 @@
+package document
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/apis"
+	"github.com/Mobility-Development-Team/be-common-mdl/apis/media"
+	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+	"github.com/spf13/viper"
+)
+
+// initTestConfig initializes apis with v until the end of the test, the previous config is restored after
+func initTestConfig(t *testing.T, v *viper.Viper) {
+	previous := func() (v *viper.Viper) {
+		defer func() { _ = recover() }()
+		return apis.V()
+	}()
+	apis.Init(v)
+	t.Cleanup(func() { apis.Init(previous) })
+}
+
+// testJobServer accepts report jobs and completes them on the second poll, jobs of permit 13 fail,
+// jobs of permit 14 never complete and jobs of permit 15 cannot be found
+func testJobServer(t *testing.T) {
+	var mu sync.Mutex
+	polls := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == http.MethodPost {
+			var body map[string]interface{}
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			if body["async"] != true {
+				t.Errorf("body = %v, want async", body)
+			}
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprintf(w, `{"payload":{"jobId":"job-%s","status":"PENDING"}}`, body["permitMasterId"])
+			return
+		}
+		jobId := strings.TrimPrefix(r.URL.Path, "/documents/jobs/")
+		polls[jobId]++
+		status, url, reason := ReportJobRunning, "", ""
+		switch {
+		case jobId == "job-15":
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case jobId == "job-14":
+		case polls[jobId] >= 2 && jobId == "job-13":
+			status, reason = ReportJobFailed, "template error"
+		case polls[jobId] >= 2:
+			status, url = ReportJobCompleted, "https://files/"+jobId+".pdf"
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"payload": ReportJob{Id: jobId, Status: status, Url: url, Error: reason},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	v := viper.New()
+	v.Set(urlBase, srv.URL)
+	v.Set(asyncEnabledConfig, true)
+	initTestConfig(t, v)
+}
+
+func TestGenerateAll(t *testing.T) {
+	testJobServer(t)
+	var mu sync.Mutex
+	completed := map[intstring.IntString]error{}
+	opts := AsyncOptions{
+		Poll: PollOptions{Initial: time.Millisecond, Max: 5 * time.Millisecond, Timeout: time.Second},
+		OnComplete: func(id intstring.IntString, report *GeneratedReport, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			completed[id] = err
+		},
+		MaxConcurrent: 2,
+	}
+	reports, err := GenerateAll(context.Background(), media.ReportTypeHotworkPermitReport, []intstring.IntString{11, 12, 13}, opts)
+	if err == nil || !strings.Contains(err.Error(), "template error") {
+		t.Errorf("GenerateAll() error = %v, want the failure of 13", err)
+	}
+	if len(reports) != 2 || reports[12].Url != "https://files/job-12.pdf" || !reports[12].Published ||
+		reports[12].Type.MediaReportType != media.ReportTypeHotworkPermitReport {
+		t.Errorf("GenerateAll() = %v", reports)
+	}
+	if len(completed) != 3 || !errors.Is(completed[13], ErrReportJobFailed) || completed[11] != nil {
+		t.Errorf("OnComplete called with %v", completed)
+	}
+}
+
+func TestAwaitReportJobTimeout(t *testing.T) {
+	testJobServer(t)
+	a := GenerateAwaiter(context.Background(), media.ReportTypeHotworkPermitReport, 14, AsyncOptions{
+		Poll: PollOptions{Initial: time.Millisecond, Timeout: 20 * time.Millisecond},
+	})
+	if err := a.Await(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Await() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestAwaitReportJobRejected(t *testing.T) {
+	testJobServer(t)
+	a := GenerateAwaiter(context.Background(), media.ReportTypeHotworkPermitReport, 15, AsyncOptions{
+		Poll: PollOptions{Initial: time.Millisecond, Timeout: time.Minute},
+	})
+	if err := a.Await(); !errors.Is(err, ErrReportJobRejected) {
+		t.Errorf("Await() error = %v, want %v", err, ErrReportJobRejected)
+	}
+}
+
+func TestGenerateAsyncDisabled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if _, ok := body["async"]; ok || r.Method != http.MethodPost {
+			t.Errorf("%s with body %v, want a synchronous request", r.Method, body)
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"payload":{"url":"https://files/report.pdf"}}`))
+	}))
+	defer srv.Close()
+	v := viper.New()
+	v.Set(urlBase, srv.URL)
+	initTestConfig(t, v)
+
+	job, err := GenerateAsync(context.Background(), media.ReportTypeHotworkPermitReport, 11, GenerateOptions{})
+	if err != nil || !job.Done() || job.Url != "https://files/report.pdf" {
+		t.Fatalf("GenerateAsync() = %+v, %v", job, err)
+	}
+	report, err := AwaitReportJob(context.Background(), "tk", job, PollOptions{})
+	if err != nil || report.Url != job.Url || report.Type.MediaReportType != media.ReportTypeHotworkPermitReport {
+		t.Errorf("AwaitReportJob() = %+v, %v", report, err)
+	}
+}
+
+func TestNextPollDelay(t *testing.T) {
+	opts := PollOptions{Max: 3 * time.Second}
+	delay := time.Second
+	var got []time.Duration
+	for i := 0; i < 3; i++ {
+		delay = nextPollDelay(delay, opts)
+		got = append(got, delay)
+	}
+	if fmt.Sprint(got) != "[2s 3s 3s]" {
+		t.Errorf("delays = %v", got)
+	}
+}
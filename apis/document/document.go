@@ -1,14 +1,8 @@
 package document
 
 import (
-	"encoding/json"
-	"fmt"
-	"net/http"
-
-	"github.com/Mobility-Development-Team/be-common-mdl/apis"
-	"github.com/Mobility-Development-Team/be-common-mdl/common"
+	"github.com/Mobility-Development-Team/be-common-mdl/apis/media"
 	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
-	logger "github.com/sirupsen/logrus"
 )
 
 const (
@@ -37,211 +31,91 @@ const (
 )
 
 func GenerateSiteWalk(tk string, siteWalkId intstring.IntString) (string, error) {
-	return generateReportSiteWalk(tk, generateSiteWalk, siteWalkId, true)
+	return generateUrl(tk, media.ReportTypeSiteWalk, siteWalkId, nil)
 }
 
 func GenerateRAT(tk string, siteWalkId intstring.IntString) (string, error) {
-	return generateReportSiteWalk(tk, generateRATSiteWalk, siteWalkId, true)
+	return generateUrl(tk, media.ReportTypeRat, siteWalkId, nil)
 }
 
 func GenerateSiteWalkAdmin(tk string, siteWalkId intstring.IntString) (string, error) {
-	return generateReportSiteWalk(tk, generateAdminSiteWalk, siteWalkId, true)
+	return generateUrl(tk, media.ReportTypeSiteWalkAdmin, siteWalkId, nil)
 }
 
 func GenerateTaskFollowUpReport(tk string, params FollowUpReportInfo, taskId intstring.IntString, contractId intstring.IntString) (string, error) {
-	client := common.NewResty()
-	var resp struct {
-		Payload struct {
-			Url string `json:"url"`
-		} `json:"payload"`
-	}
-	result, err := client.R().SetAuthToken(tk).SetBody(struct {
+	return generateUrl(tk, media.ReportTypeTaskFollowUp, taskId, struct {
 		FollowUpReportInfo
-		TaskId     intstring.IntString `json:"taskId"`
 		ContractId intstring.IntString `json:"contractId"`
 	}{
 		FollowUpReportInfo: params,
-		TaskId:             taskId,
 		ContractId:         contractId,
-	}).Post(
-		fmt.Sprintf(generateFollowUpReport, apis.V().GetString(urlBase)),
-	)
-	if err != nil {
-		logger.Errorf("[GenerateTaskFollowUpReport] happen err: %+v,params %+v, taskId %+v, contractId%+v",
-			err, params, taskId, contractId)
-		return "", err
-	}
-	if result.StatusCode() != http.StatusCreated {
-		logger.Errorf("[GenerateTaskFollowUpReport] StatusCode happen err: %+v,result %+v, params %+v, taskId %+v, contractId%+v",
-			err, result, params, taskId, contractId)
-		return "", fmt.Errorf(
-			"[GenerateTaskFollowUpReport] status code not 201: %d", result.StatusCode(),
-		)
-	}
-	err = json.Unmarshal(result.Body(), &resp)
-	if err != nil {
-		logger.Errorf("[GenerateTaskFollowUpReport] json.Unmarshal happen err: %+v,result.Body() %+v, params %+v, taskId %+v, contractId%+v",
-			err, result.Body(), params, taskId, contractId)
-		return "", err
-	}
-	return resp.Payload.Url, nil
-}
-
-func generateReportSiteWalk(tk, apiPath string, id intstring.IntString, publish bool) (string, error) {
-	client := common.NewResty()
-	var resp struct {
-		Payload struct {
-			Url string `json:"url"`
-		} `json:"payload"`
-	}
-	result, err := client.R().SetAuthToken(tk).SetBody(map[string]interface{}{
-		"id":      id,
-		"publish": publish,
-	}).Post(fmt.Sprintf(apiPath, apis.V().GetString(urlBase)))
-	if err != nil {
-		logger.Errorf("[GenerateSiteWalk] happen err: %+v,apiPath %+v, id %+v, publish%+v",
-			err, apiPath, id, publish)
-		return "", err
-	}
-	if result.StatusCode() != http.StatusCreated {
-		logger.Errorf("[GenerateSiteWalk] StatusCode happen err: %+v,result: %+v,apiPath %+v, id %+v, publish%+v",
-			err, result, apiPath, id, publish)
-		return "", fmt.Errorf("[GenerateSiteWalk] status code not 201: %d", result.StatusCode())
-	}
-	err = json.Unmarshal(result.Body(), &resp)
-	if err != nil {
-		logger.Errorf("[GenerateSiteWalk] json.Unmarshal happen err: %+v,result.Body(): %+v,apiPath %+v, id %+v, publish%+v",
-			err, result.Body(), apiPath, id, publish)
-		return "", err
-	}
-	return resp.Payload.Url, nil
+	})
 }
 
 func GeneratePermitCertificate(tk string, permitMasterId intstring.IntString) (string, error) {
-	return generatePermitType(tk, generatePlantCertificate, permitMasterId, true)
+	return generateUrl(tk, media.ReportTypePlantPermitCert, permitMasterId, nil)
 }
 
 func GeneratePCCertificate(tk string, permitMasterId intstring.IntString) (string, error) {
-	return generatePermitType(tk, generatePCCertificate, permitMasterId, true)
+	return generateUrl(tk, media.ReportTypePCPermitCert, permitMasterId, nil)
 }
 
 func GeneratePlantReport(tk string, permitMasterId intstring.IntString) (string, error) {
-	return generatePermitType(tk, generatePlantReport, permitMasterId, true)
+	return generateUrl(tk, media.ReportTypePlantPermitReport, permitMasterId, nil)
 }
 
 func GenerateNCAReport(tk string, permitMasterId intstring.IntString) (string, error) {
-	return generatePermitType(tk, generateNCAReport, permitMasterId, true)
+	return generateUrl(tk, media.ReportTypeNCAPermitReport, permitMasterId, nil)
 }
 
 func GenerateHWReport(tk string, permitMasterId intstring.IntString) (string, error) {
-	return generatePermitType(tk, generateHWReport, permitMasterId, true)
+	return generateUrl(tk, media.ReportTypeHotworkPermitReport, permitMasterId, nil)
 }
 
 func GenerateEXReport(tk string, permitMasterId intstring.IntString) (string, error) {
-	return generatePermitType(tk, generateEXReport, permitMasterId, true)
+	return generateUrl(tk, media.ReportTypeEXPermitReport, permitMasterId, nil)
 }
 
 func GenerateELReport(tk string, permitMasterId intstring.IntString) (string, error) {
-	return generatePermitType(tk, generateELReport, permitMasterId, true)
+	return generateUrl(tk, media.ReportTypeELPermitReport, permitMasterId, nil)
 }
 
 func GenerateELV2Report(tk string, permitMasterId intstring.IntString) (string, error) {
-	return generatePermitType(tk, generateELV2Report, permitMasterId, true)
+	return generateUrl(tk, ReportTypeELV2PermitReport, permitMasterId, nil)
 }
 
 func GenerateEL1090Report(tk string, permitMasterId intstring.IntString) (string, error) {
-	return generatePermitType(tk, generateEL1090Report, permitMasterId, true)
+	return generateUrl(tk, media.ReportTypeEL1090PermitReport, permitMasterId, nil)
 }
 
 func GeneratePCReport(tk string, permitMasterId intstring.IntString) (string, error) {
-	return generatePermitType(tk, generatePCReport, permitMasterId, true)
+	return generateUrl(tk, media.ReportTypePCPermitReport, permitMasterId, nil)
 }
 
 func GenerateCSReport(tk string, permitMasterId intstring.IntString) (string, error) {
-	return generatePermitType(tk, generateCSReport, permitMasterId, true)
+	return generateUrl(tk, media.ReportTypeCSPermitReport, permitMasterId, nil)
 }
 
 func GenerateLDReport(tk string, permitMasterId intstring.IntString) (string, error) {
-	return generatePermitType(tk, generateLDReport, permitMasterId, true)
+	return generateUrl(tk, media.ReportTypeLDPermitReport, permitMasterId, nil)
 }
 
 func GenerateEFReport(tk string, permitMasterId intstring.IntString) (string, error) {
-	return generatePermitType(tk, generateEFReport, permitMasterId, true)
+	return generateUrl(tk, media.ReportTypeEFPermitReport, permitMasterId, nil)
 }
 
 func GenerateLSReport(tk string, permitMasterId intstring.IntString) (string, error) {
-	return generatePermitType(tk, generateLSReport, permitMasterId, true)
+	return generateUrl(tk, media.ReportTypeLSPermitReport, permitMasterId, nil)
 }
 
 func GenerateCDReport(tk string, permitMasterId intstring.IntString) (string, error) {
-	return generatePermitType(tk, generateCDReport, permitMasterId, true)
+	return generateUrl(tk, media.ReportTypeCDPermitReport, permitMasterId, nil)
 }
 
 func GenerateCDV2Report(tk string, permitMasterId intstring.IntString) (string, error) {
-	return generatePermitType(tk, generateCDV2Report, permitMasterId, true)
-}
-
-func generatePermitType(tk string, apiPath string, permitMasterId intstring.IntString, publish bool) (string, error) {
-	client := common.NewResty()
-	var resp struct {
-		Payload struct {
-			Url string `json:"url"`
-		} `json:"payload"`
-	}
-	result, err := client.R().SetAuthToken(tk).SetBody(map[string]interface{}{
-		"permitMasterId": permitMasterId,
-		"publish":        publish,
-	}).Post(fmt.Sprintf(apiPath, apis.V().GetString(urlBase)))
-
-	if err != nil {
-		logger.Errorf("[GeneratePermitType] happen err: %+v,apiPath %+v, permitMasterId %+v, publish%+v",
-			err, apiPath, permitMasterId, publish)
-		return "", err
-	}
-	if result.StatusCode() != http.StatusCreated {
-		logger.Errorf("[GeneratePermitType] StatusCode happen err result: %+v,apiPath %+v, permitMasterId %+v, publish%+v",
-			result, apiPath, permitMasterId, publish)
-		return "", fmt.Errorf("[generatePlantPermitType] status code not 201: %d", result.StatusCode())
-	}
-	err = json.Unmarshal(result.Body(), &resp)
-	if err != nil {
-		logger.Errorf("[GeneratePermitType] json.Unmarshal happen err: %+v,apiPath %+v, permitMasterId %+v, publish%+v, result%+v",
-			err, apiPath, permitMasterId, publish, result)
-		return "", err
-	}
-	return resp.Payload.Url, nil
+	return generateUrl(tk, media.ReportTypeCDV2PermitReport, permitMasterId, nil)
 }
 
 func GenerateDocReport(tk string, reportId intstring.IntString) (string, error) {
-	return generateDoc(tk, generateDocReport, reportId, true)
-}
-
-func generateDoc(tk, apiPath string, reportId intstring.IntString, publish bool) (string, error) {
-	client := common.NewResty()
-	var resp struct {
-		Payload struct {
-			Url string `json:"url"`
-		} `json:"payload"`
-	}
-	result, err := client.R().SetAuthToken(tk).SetBody(map[string]interface{}{
-		"reportId": reportId,
-		"publish":  publish,
-	}).Post(fmt.Sprintf(apiPath, apis.V().GetString(urlBase)))
-	if err != nil {
-		logger.Errorf("[GenerateDocReport] happen err: %+v,apiPath %+v, reportId %+v, publish%+v",
-			err, apiPath, reportId, publish)
-		return "", err
-	}
-	if result.StatusCode() != http.StatusCreated {
-		logger.Errorf("[GenerateDocReport] StatusCode happen err: %+v,result%+v,apiPath %+v, reportId %+v, publish%+v",
-			err, result, apiPath, reportId, publish)
-		return "", fmt.Errorf("[GenerateDocReport] status code not 201: %d", result.StatusCode())
-	}
-	err = json.Unmarshal(result.Body(), &resp)
-	if err != nil {
-		logger.Errorf("[GenerateDocReport] json.Unmarshal happen err: %+v,result.Body()%+v,apiPath %+v, reportId %+v, publish%+v",
-			err, result.Body(), apiPath, reportId, publish)
-		return "", err
-	}
-	return resp.Payload.Url, nil
+	return generateUrl(tk, media.ReportTypeDocReport, reportId, nil)
 }
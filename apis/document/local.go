@@ -0,0 +1,212 @@
+package document
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/apis/media"
+	"github.com/Mobility-Development-Team/be-common-mdl/apis/system"
+	"github.com/Mobility-Development-Team/be-common-mdl/apis/user"
+	"github.com/Mobility-Development-Team/be-common-mdl/common"
+	"github.com/Mobility-Development-Team/be-common-mdl/model"
+	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+	"github.com/Mobility-Development-Team/be-common-mdl/util/concutil"
+	"github.com/Mobility-Development-Team/be-common-mdl/util/pdfutil"
+	logger "github.com/sirupsen/logrus"
+)
+
+const (
+	// Photos are downscaled to this size in pixels before they are embedded
+	localPhotoMaxSize = 1600
+	// Size in pixels of the signatures embedded
+	localSignatureWidth  = 600
+	localSignatureHeight = 200
+)
+
+type (
+	// Signer is a user signing a locally composed report
+	Signer struct {
+		UserId intstring.IntString
+		Name   string
+		Title  string
+		Date   string
+	}
+	LocalReportOptions struct {
+		Token string
+		// Contract shown in the report, fetched with system.GetCachedOneContract if nil. The
+		// contract is cached per caller token, so another caller's contract is never shown.
+		Contract *model.Contract
+		// Signatures are fetched with user.GetSignatureImages, a signer without signature is left blank
+		Signers []Signer
+		Publish bool
+		// Used in preview mode only, see media.UploadReport
+		FileName string
+		// Downloads the before and after photos, defaults to a GET of the url
+		FetchImage func(url string) ([]byte, error)
+	}
+)
+
+// ComposeFollowUpReport composes a task follow up report with pdfutil, without the document module.
+// The contract of opts must be set.
+func ComposeFollowUpReport(info FollowUpReportInfo, opts LocalReportOptions) (*pdfutil.Document, error) {
+	if opts.Contract == nil {
+		return nil, fmt.Errorf("contract of the follow up report is required")
+	}
+	photos, err := fetchPhotos(info, opts.FetchImage)
+	if err != nil {
+		return nil, err
+	}
+	signatures, err := signerImages(opts.Token, opts.Signers)
+	if err != nil {
+		return nil, err
+	}
+
+	d := pdfutil.New()
+	d.SetHeader("Follow Up Report 跟進報告", opts.Contract.ContractNo)
+	d.Heading(pdfutil.Bilingual("Contract Information", "合約資料"))
+	contractDesc := ""
+	if opts.Contract.ContractDesc != nil {
+		contractDesc = *opts.Contract.ContractDesc
+	}
+	d.KeyValues(
+		pdfutil.KeyValue{Key: pdfutil.Bilingual("Contract No.", "合約編號"), Value: opts.Contract.ContractNo},
+		pdfutil.KeyValue{Key: pdfutil.Bilingual("Contract Title", "合約名稱"), Value: contractDesc},
+	)
+	d.Heading(pdfutil.Bilingual("Follow Up", "跟進事項"))
+	d.KeyValues(
+		pdfutil.KeyValue{Key: pdfutil.Bilingual("Title", "標題"), Value: info.Title},
+		pdfutil.KeyValue{Key: pdfutil.Bilingual("Due Date", "限期"), Value: info.DueDate},
+		pdfutil.KeyValue{Key: pdfutil.Bilingual("Description", "描述"), Value: info.Description},
+	)
+	if len(info.Images) > 0 {
+		d.Heading(pdfutil.Bilingual("Photos", "相片"))
+		for i := range info.Images {
+			err := d.ImageRow([]pdfutil.ImageCell{
+				{Image: photos[2*i], Caption: fmt.Sprintf("%d. %s", i+1, pdfutil.Bilingual("Before", "之前"))},
+				{Image: photos[2*i+1], Caption: fmt.Sprintf("%d. %s", i+1, pdfutil.Bilingual("After", "之後"))},
+			}, 0, 220)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(opts.Signers) > 0 {
+		d.Heading(pdfutil.Bilingual("Signatures", "簽署"))
+		blocks := make([]pdfutil.SignatureBlock, len(opts.Signers))
+		for i, s := range opts.Signers {
+			blocks[i] = pdfutil.SignatureBlock{Image: signatures[s.UserId], Name: s.Name, Title: s.Title, Date: s.Date}
+		}
+		if err := d.Signatures(blocks...); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// GenerateLocalFollowUpReport is GenerateTaskFollowUpReport composing the report locally with
+// ComposeFollowUpReport, the report is uploaded with media.UploadReport and its url is returned.
+func GenerateLocalFollowUpReport(tk string, info FollowUpReportInfo, taskId intstring.IntString, contractId intstring.IntString, opts LocalReportOptions) (string, error) {
+	opts.Token = tk
+	if opts.Contract == nil {
+		contract, _, err := system.GetCachedOneContract(tk, contractId)
+		if err != nil {
+			return "", err
+		}
+		opts.Contract = &contract
+	}
+	d, err := ComposeFollowUpReport(info, opts)
+	if err != nil {
+		logger.Errorf("[GenerateLocalFollowUpReport] happen err: %+v, taskId %s", err, taskId)
+		return "", err
+	}
+	pdf, err := d.Bytes()
+	if err != nil {
+		return "", err
+	}
+	fileName := opts.FileName
+	if fileName == "" {
+		fileName = taskId.String()
+	}
+	return media.UploadReport(tk, bytes.NewReader(pdf), media.ReportTypeTaskFollowUp, contractId, fileName, opts.Publish)
+}
+
+// fetchPhotos downloads and decodes the before and after photos concurrently, a missing photo is nil
+func fetchPhotos(info FollowUpReportInfo, fetch func(url string) ([]byte, error)) ([]image.Image, error) {
+	if fetch == nil {
+		fetch = fetchUrl
+	}
+	urls := make([]string, 0, 2*len(info.Images))
+	for _, img := range info.Images {
+		urls = append(urls, img.Before, img.After)
+	}
+	awaiters := make([]*concutil.Awaiter, len(urls))
+	for i, url := range urls {
+		if url == "" {
+			continue
+		}
+		url := url
+		awaiters[i] = concutil.Async(func() (interface{}, error) {
+			data, err := fetch(url)
+			if err != nil {
+				return nil, err
+			}
+			img, _, err := media.DecodeImage(data)
+			if err != nil {
+				return nil, fmt.Errorf("cannot decode photo %s: %w", url, err)
+			}
+			return media.ResizeImage(img, localPhotoMaxSize, localPhotoMaxSize), nil
+		})
+	}
+	photos := make([]image.Image, len(urls))
+	for i, a := range awaiters {
+		if a == nil {
+			continue
+		}
+		if err := a.Await(); err != nil {
+			return nil, err
+		}
+		photos[i] = a.Get().(image.Image)
+	}
+	return photos, nil
+}
+
+// signerImages returns the trimmed signatures of the signers by user id
+func signerImages(tk string, signers []Signer) (map[intstring.IntString]image.Image, error) {
+	result := map[intstring.IntString]image.Image{}
+	ids := make([]intstring.IntString, 0, len(signers))
+	for _, s := range signers {
+		if s.UserId != 0 {
+			ids = append(ids, s.UserId)
+		}
+	}
+	if len(ids) == 0 {
+		return result, nil
+	}
+	sigs, err := user.GetSignatureImages(tk, ids, user.SignatureOptions{
+		Trim:   true,
+		Width:  localSignatureWidth,
+		Height: localSignatureHeight,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for id, sig := range sigs {
+		if sig == nil || sig.Err != nil {
+			continue
+		}
+		result[id] = sig.Image
+	}
+	return result, nil
+}
+
+func fetchUrl(url string) ([]byte, error) {
+	result, err := common.NewResty().R().Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if !result.IsSuccess() {
+		return nil, fmt.Errorf("cannot download %s, status code: %d", url, result.StatusCode())
+	}
+	return result.Body(), nil
+}
@@ -0,0 +1,90 @@
+package document
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/apis"
+	"github.com/Mobility-Development-Team/be-common-mdl/model"
+	"github.com/spf13/viper"
+)
+
+func TestGenerateLocalFollowUpReport(t *testing.T) {
+	pngBytes := func(w, h int, c color.Color) []byte {
+		img := image.NewNRGBA(image.Rect(0, 0, w, h))
+		for x := 0; x < w; x++ {
+			for y := 0; y < h; y++ {
+				img.Set(x, y, c)
+			}
+		}
+		var buf bytes.Buffer
+		_ = png.Encode(&buf, img)
+		return buf.Bytes()
+	}
+	photo := pngBytes(40, 30, color.NRGBA{G: 200, A: 255})
+	signature := base64.StdEncoding.EncodeToString(pngBytes(20, 10, color.NRGBA{A: 255}))
+
+	var uploadPath, contractId string
+	var uploaded []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/photos/before.png":
+			_, _ = w.Write(photo)
+		case "/users/signatures":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"payload": map[string]string{"7": signature}})
+		case "/file/upload/taskFollowUpReport/publish":
+			uploadPath, contractId = r.URL.Path, r.FormValue("contractId")
+			f, _, err := r.FormFile("file")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			uploaded, _ = io.ReadAll(f)
+			_, _ = w.Write([]byte(`{"payload":"https://files/followup.pdf"}`))
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	v := viper.New()
+	v.Set("apis.internal.user.module.url.base", srv.URL)
+	v.Set("apis.internal.media.module.url.base", srv.URL)
+	apis.Init(v)
+
+	info := FollowUpReportInfo{Title: "Remove debris 清理雜物", DueDate: "2024-01-31", Description: "Site entrance"}
+	info.Images = append(info.Images, struct {
+		Before string `json:"before"`
+		After  string `json:"after"`
+	}{Before: srv.URL + "/photos/before.png"})
+	desc := "Site formation 地盤平整"
+	url, err := GenerateLocalFollowUpReport("tk", info, 5, 6, LocalReportOptions{
+		Contract: &model.Contract{ContractNo: "ABC-123", ContractDesc: &desc},
+		Signers:  []Signer{{UserId: 7, Name: "Chan Tai Man", Date: "2024-02-01"}, {UserId: 8, Name: "No signature"}},
+		Publish:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "https://files/followup.pdf" {
+		t.Errorf("url = %s", url)
+	}
+	if uploadPath == "" || contractId != "6" {
+		t.Errorf("report not uploaded to the contract, path %q contractId %q", uploadPath, contractId)
+	}
+	if !bytes.HasPrefix(uploaded, []byte("%PDF-")) {
+		t.Fatalf("uploaded file is not a PDF")
+	}
+	// The before photo and the signature with its mask
+	if n := bytes.Count(uploaded, []byte("/Subtype /Image")); n != 3 {
+		t.Errorf("expected 3 images, got %d", n)
+	}
+}
@@ -0,0 +1,225 @@
+package document
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/apis"
+	"github.com/Mobility-Development-Team/be-common-mdl/apis/media"
+	"github.com/Mobility-Development-Team/be-common-mdl/common"
+	"github.com/Mobility-Development-Team/be-common-mdl/genericjson"
+	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+	logger "github.com/sirupsen/logrus"
+)
+
+// Report types without a media.ReportType* constant of their own
+const (
+	ReportTypeELV2PermitReport = "elv2PermitReport"
+)
+
+// Modes of GenerateOptions
+const (
+	// Uses ReportType.Publish
+	ReportModeDefault = ""
+	// Generates a preview, not visible to other users
+	ReportModePreview = "PREVIEW"
+	ReportModePublish = "PUBLISH"
+)
+
+type (
+	// ReportType is a report generated by the document module
+	ReportType struct {
+		// Key used by Generate, same as MediaReportType unless there are multiple versions
+		Key string
+		// Url of the generate endpoint, with %s for the url base of the document module
+		Endpoint string
+		// Name of the id field in the request body, e.g. permitMasterId
+		IdField string
+		// Publish flag sent in ReportModeDefault
+		Publish bool
+		// The endpoint does not accept the publish flag, only ReportModeDefault can be used
+		OmitPublish bool
+		// Report type the document module uploads the report with, see media.UploadReport
+		MediaReportType string
+	}
+	GenerateOptions struct {
+		Token string
+		Mode  string
+		// Additional fields of the request body, e.g. FollowUpReportInfo
+		Body interface{}
+	}
+	GeneratedReport struct {
+		Url       string
+		Type      ReportType
+		Published bool
+	}
+)
+
+var (
+	muReportTypes sync.RWMutex
+	reportTypes   = map[string]ReportType{}
+)
+
+func init() {
+	siteWalk := func(key, endpoint string) ReportType {
+		return ReportType{Key: key, Endpoint: endpoint, IdField: "id", Publish: true, MediaReportType: key}
+	}
+	permit := func(key, endpoint, mediaReportType string) ReportType {
+		return ReportType{Key: key, Endpoint: endpoint, IdField: "permitMasterId", Publish: true, MediaReportType: mediaReportType}
+	}
+	for _, rt := range []ReportType{
+		siteWalk(media.ReportTypeSiteWalk, generateSiteWalk),
+		siteWalk(media.ReportTypeSiteWalkAdmin, generateAdminSiteWalk),
+		siteWalk(media.ReportTypeRat, generateRATSiteWalk),
+		{
+			Key:             media.ReportTypeTaskFollowUp,
+			Endpoint:        generateFollowUpReport,
+			IdField:         "taskId",
+			OmitPublish:     true,
+			MediaReportType: media.ReportTypeTaskFollowUp,
+		},
+		permit(media.ReportTypePlantPermitCert, generatePlantCertificate, media.ReportTypePlantPermitCert),
+		permit(media.ReportTypePlantPermitReport, generatePlantReport, media.ReportTypePlantPermitReport),
+		permit(media.ReportTypeNCAPermitReport, generateNCAReport, media.ReportTypeNCAPermitReport),
+		permit(media.ReportTypeHotworkPermitReport, generateHWReport, media.ReportTypeHotworkPermitReport),
+		permit(media.ReportTypeEXPermitReport, generateEXReport, media.ReportTypeEXPermitReport),
+		permit(media.ReportTypeELPermitReport, generateELReport, media.ReportTypeELPermitReport),
+		permit(ReportTypeELV2PermitReport, generateELV2Report, media.ReportTypeELPermitReport),
+		permit(media.ReportTypeEL1090PermitReport, generateEL1090Report, media.ReportTypeEL1090PermitReport),
+		permit(media.ReportTypePCPermitCert, generatePCCertificate, media.ReportTypePCPermitCert),
+		permit(media.ReportTypePCPermitReport, generatePCReport, media.ReportTypePCPermitReport),
+		permit(media.ReportTypeCSPermitReport, generateCSReport, media.ReportTypeCSPermitReport),
+		permit(media.ReportTypeLDPermitReport, generateLDReport, media.ReportTypeLDPermitReport),
+		permit(media.ReportTypeEFPermitReport, generateEFReport, media.ReportTypeEFPermitReport),
+		permit(media.ReportTypeLSPermitReport, generateLSReport, media.ReportTypeLSPermitReport),
+		permit(media.ReportTypeCDPermitReport, generateCDReport, media.ReportTypeCDPermitReport),
+		permit(media.ReportTypeCDV2PermitReport, generateCDV2Report, media.ReportTypeCDV2PermitReport),
+		{
+			Key:             media.ReportTypeDocReport,
+			Endpoint:        generateDocReport,
+			IdField:         "reportId",
+			Publish:         true,
+			MediaReportType: media.ReportTypeDocReport,
+		},
+	} {
+		if err := RegisterReportType(rt); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// RegisterReportType adds a report type to Generate, replacing the existing one with the same key
+func RegisterReportType(rt ReportType) error {
+	if rt.Key == "" {
+		return errors.New("report type must have a key")
+	}
+	if strings.Count(rt.Endpoint, "%s") != 1 {
+		return fmt.Errorf("endpoint of report type %s must contain exactly one %%s, got %q", rt.Key, rt.Endpoint)
+	}
+	if rt.IdField == "" {
+		return fmt.Errorf("report type %s must have an id field", rt.Key)
+	}
+	muReportTypes.Lock()
+	defer muReportTypes.Unlock()
+	reportTypes[rt.Key] = rt
+	return nil
+}
+
+func LookupReportType(key string) (ReportType, bool) {
+	muReportTypes.RLock()
+	defer muReportTypes.RUnlock()
+	rt, ok := reportTypes[key]
+	return rt, ok
+}
+
+// ReportTypes returns all registered report types ordered by key
+func ReportTypes() []ReportType {
+	muReportTypes.RLock()
+	defer muReportTypes.RUnlock()
+	result := make([]ReportType, 0, len(reportTypes))
+	for _, rt := range reportTypes {
+		result = append(result, rt)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Key < result[j].Key
+	})
+	return result
+}
+
+// Generate asks the document module to generate a report of the registered reportType for the
+// record id, e.g. a site walk or permit, and returns the url of the report.
+func Generate(ctx context.Context, reportType string, id intstring.IntString, opts GenerateOptions) (*GeneratedReport, error) {
+	rt, body, published, err := newGenerateBody(reportType, id, opts)
+	if err != nil {
+		return nil, err
+	}
+	report := &GeneratedReport{Type: rt, Published: published}
+	var resp struct {
+		Payload struct {
+			Url string `json:"url"`
+		} `json:"payload"`
+	}
+	client := common.NewResty()
+	result, err := client.R().SetContext(ctx).SetAuthToken(opts.Token).SetBody(body).
+		Post(fmt.Sprintf(rt.Endpoint, apis.V().GetString(urlBase)))
+	if err != nil {
+		logger.Errorf("[Generate] happen err: %+v, reportType %s, id %s, body %+v", err, reportType, id, body)
+		return nil, err
+	}
+	if result.StatusCode() != http.StatusCreated {
+		logger.Errorf("[Generate] StatusCode happen err result: %+v, reportType %s, id %s, body %+v", result, reportType, id, body)
+		return nil, fmt.Errorf("[Generate] %s status code not 201: %d", reportType, result.StatusCode())
+	}
+	if err = json.Unmarshal(result.Body(), &resp); err != nil {
+		logger.Errorf("[Generate] json.Unmarshal happen err: %+v, result.Body() %s, reportType %s, id %s", err, result.Body(), reportType, id)
+		return nil, err
+	}
+	report.Url = resp.Payload.Url
+	return report, nil
+}
+
+// newGenerateBody returns the request body to generate a report of reportType in the given mode
+func newGenerateBody(reportType string, id intstring.IntString, opts GenerateOptions) (ReportType, genericjson.Object, bool, error) {
+	rt, ok := LookupReportType(reportType)
+	if !ok {
+		return rt, nil, false, fmt.Errorf("unknown report type %s", reportType)
+	}
+	body := genericjson.NewObject()
+	if opts.Body != nil {
+		if err := body.Merge(opts.Body); err != nil {
+			return rt, nil, false, fmt.Errorf("invalid body of report %s: %w", reportType, err)
+		}
+	}
+	body[rt.IdField] = id
+	var published bool
+	switch opts.Mode {
+	case ReportModeDefault:
+		published = rt.Publish
+	case ReportModePreview, ReportModePublish:
+		if rt.OmitPublish {
+			return rt, nil, false, fmt.Errorf("report %s does not support mode %s", reportType, opts.Mode)
+		}
+		published = opts.Mode == ReportModePublish
+	default:
+		return rt, nil, false, fmt.Errorf("invalid report mode %q", opts.Mode)
+	}
+	if !rt.OmitPublish {
+		body["publish"] = published
+	}
+	return rt, body, published, nil
+}
+
+// generateUrl is Generate in ReportModeDefault returning the url only, used by the Generate* functions
+func generateUrl(tk string, reportType string, id intstring.IntString, body interface{}) (string, error) {
+	report, err := Generate(context.Background(), reportType, id, GenerateOptions{Token: tk, Body: body})
+	if err != nil {
+		return "", err
+	}
+	return report.Url, nil
+}
@@ -0,0 +1,109 @@
+package document
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/apis"
+	"github.com/Mobility-Development-Team/be-common-mdl/apis/media"
+	"github.com/spf13/viper"
+)
+
+func TestGenerate(t *testing.T) {
+	var gotPath string
+	var gotBody map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotBody = r.URL.Path, nil
+		_ = json.NewDecoder(r.Body).Decode(&gotBody)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"payload":{"url":"https://files/report.pdf"}}`))
+	}))
+	defer srv.Close()
+	v := viper.New()
+	v.Set(urlBase, srv.URL)
+	apis.Init(v)
+
+	tests := []struct {
+		name     string
+		generate func() (string, error)
+		wantPath string
+		wantBody map[string]interface{}
+		wantErr  bool
+	}{
+		{
+			name:     "Permit wrapper",
+			generate: func() (string, error) { return GenerateHWReport("tk", 12) },
+			wantPath: "/documents/machine/permits/hw/report/generate",
+			wantBody: map[string]interface{}{"permitMasterId": "12", "publish": true},
+		},
+		{
+			name: "Preview",
+			generate: func() (string, error) {
+				r, err := Generate(context.Background(), media.ReportTypeSiteWalk, 3, GenerateOptions{Token: "tk", Mode: ReportModePreview})
+				if err != nil {
+					return "", err
+				}
+				return r.Url, nil
+			},
+			wantPath: "/documents/inspection/sitewalk/report/generate",
+			wantBody: map[string]interface{}{"id": "3", "publish": false},
+		},
+		{
+			name: "Follow up",
+			generate: func() (string, error) {
+				return GenerateTaskFollowUpReport("tk", FollowUpReportInfo{Title: "t"}, 5, 6)
+			},
+			wantPath: "/documents/inspection/tasks/followup/generate",
+			wantBody: map[string]interface{}{
+				"title": "t", "dueDate": "", "description": "", "images": nil, "taskId": "5", "contractId": "6",
+			},
+		},
+		{
+			name: "Follow up preview",
+			generate: func() (string, error) {
+				_, err := Generate(context.Background(), media.ReportTypeTaskFollowUp, 5, GenerateOptions{Mode: ReportModePreview})
+				return "", err
+			},
+			wantErr: true,
+		},
+		{
+			name: "Unknown type",
+			generate: func() (string, error) {
+				_, err := Generate(context.Background(), "unknown", 5, GenerateOptions{})
+				return "", err
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotPath, gotBody = "", nil
+			url, err := tt.generate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if gotPath != "" {
+					t.Errorf("unexpected request to %s", gotPath)
+				}
+				return
+			}
+			if url != "https://files/report.pdf" || gotPath != tt.wantPath || !reflect.DeepEqual(gotBody, tt.wantBody) {
+				t.Errorf("url = %s, request = %s %v, want %s %v", url, gotPath, gotBody, tt.wantPath, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestRegisterReportType(t *testing.T) {
+	if err := RegisterReportType(ReportType{Key: "x", Endpoint: "/no/base", IdField: "id"}); err == nil {
+		t.Error("RegisterReportType() expected error for an endpoint without url base")
+	}
+	if _, ok := LookupReportType(ReportTypeELV2PermitReport); !ok || len(ReportTypes()) != 21 {
+		t.Errorf("ReportTypes() = %d types", len(ReportTypes()))
+	}
+}
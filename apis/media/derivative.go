@@ -0,0 +1,340 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/model"
+	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+	"github.com/Mobility-Development-Team/be-common-mdl/util/concutil"
+)
+
+const (
+	// DerivativeThumbnail is the derivative set as the thumbnail of a MediaParam by UploadedImage.ApplyTo
+	DerivativeThumbnail = "thumbnail"
+	DerivativeMedium    = "medium"
+
+	defaultJpegQuality = 85
+)
+
+type (
+	// DerivativeSize is a derivative generated from an image, the image is scaled down to fit
+	// within MaxWidth x MaxHeight keeping its aspect ratio and is never scaled up.
+	DerivativeSize struct {
+		Name      string
+		MaxWidth  int
+		MaxHeight int
+		// JPEG quality (1-100), defaults to 85. PNG images are re-encoded as PNG.
+		Quality int
+	}
+	Derivative struct {
+		Name        string
+		ContentType string
+		Width       int
+		Height      int
+		Data        []byte
+	}
+	// UploadedImage is the url of an uploaded image and of its derivatives by name
+	UploadedImage struct {
+		Url         string
+		Derivatives map[string]string
+	}
+)
+
+var (
+	muDerivativeSizes sync.RWMutex
+	derivativeSizes   = []DerivativeSize{
+		{Name: DerivativeThumbnail, MaxWidth: 320, MaxHeight: 320},
+		{Name: DerivativeMedium, MaxWidth: 1280, MaxHeight: 1280},
+	}
+)
+
+// SetDerivativeSizes replaces the default derivative sizes generated when no sizes are given
+func SetDerivativeSizes(sizes ...DerivativeSize) error {
+	for _, s := range sizes {
+		if err := s.validate(); err != nil {
+			return err
+		}
+	}
+	muDerivativeSizes.Lock()
+	defer muDerivativeSizes.Unlock()
+	derivativeSizes = append([]DerivativeSize{}, sizes...)
+	return nil
+}
+
+func GetDerivativeSizes() []DerivativeSize {
+	muDerivativeSizes.RLock()
+	defer muDerivativeSizes.RUnlock()
+	return append([]DerivativeSize{}, derivativeSizes...)
+}
+
+func (s DerivativeSize) validate() error {
+	if s.Name == "" {
+		return errors.New("derivative size must have a name")
+	}
+	if s.MaxWidth <= 0 || s.MaxHeight <= 0 {
+		return fmt.Errorf("derivative %s must have a positive size, got %dx%d", s.Name, s.MaxWidth, s.MaxHeight)
+	}
+	if s.Quality < 0 || s.Quality > 100 {
+		return fmt.Errorf("derivative %s has invalid quality %d", s.Name, s.Quality)
+	}
+	return nil
+}
+
+// Thumbnail returns the url of the thumbnail derivative, empty if it is not generated
+func (u UploadedImage) Thumbnail() string {
+	return u.Derivatives[DerivativeThumbnail]
+}
+
+// ApplyTo sets the urls of the image and its thumbnail to m
+func (u UploadedImage) ApplyTo(m *model.MediaParam) {
+	m.FirebaseUrl = u.Url
+	m.FirebaseUrlThumbnail = u.Thumbnail()
+}
+
+// DecodeImage decodes a JPEG or PNG image, JPEG images are rotated / flipped according to
+// their Exif orientation. Images larger than maxImagePixels are rejected before decoding.
+func DecodeImage(data []byte) (image.Image, string, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxImagePixels {
+		return nil, "", fmt.Errorf("unsupported dimension %dx%d", cfg.Width, cfg.Height)
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	if format == "jpeg" {
+		if o := jpegOrientation(data); o != 1 {
+			img = orient(toRGBA(img), o)
+		}
+	}
+	return img, format, nil
+}
+
+// ResizeImage scales img down to fit within maxWidth x maxHeight keeping its aspect ratio,
+// each pixel is the average of the pixels it covers. img is returned as is if it already fits.
+func ResizeImage(img image.Image, maxWidth, maxHeight int) image.Image {
+	b := img.Bounds()
+	w, h := fitSize(b.Dx(), b.Dy(), maxWidth, maxHeight)
+	if w == b.Dx() && h == b.Dy() {
+		return img
+	}
+	src := toRGBA(img)
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for dy := 0; dy < h; dy++ {
+		y0, y1 := dy*sh/h, (dy+1)*sh/h
+		if y1 == y0 {
+			y1++
+		}
+		for dx := 0; dx < w; dx++ {
+			x0, x1 := dx*sw/w, (dx+1)*sw/w
+			if x1 == x0 {
+				x1++
+			}
+			var sum [4]int
+			for y := y0; y < y1; y++ {
+				row := src.Pix[y*src.Stride+x0*4 : y*src.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+			n := (x1 - x0) * (y1 - y0)
+			p := dst.Pix[dy*dst.Stride+dx*4:]
+			for i := range sum {
+				p[i] = uint8((sum[i] + n/2) / n)
+			}
+		}
+	}
+	return dst
+}
+
+// GenerateDerivatives decodes, auto-orients, resizes and re-encodes data for each size, the
+// sizes set by SetDerivativeSizes are used if none is given.
+func GenerateDerivatives(data []byte, sizes ...DerivativeSize) ([]Derivative, error) {
+	if len(sizes) == 0 {
+		sizes = GetDerivativeSizes()
+	}
+	for _, s := range sizes {
+		if err := s.validate(); err != nil {
+			return nil, err
+		}
+	}
+	img, format, err := DecodeImage(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	result := make([]Derivative, 0, len(sizes))
+	for _, s := range sizes {
+		resized := ResizeImage(img, s.MaxWidth, s.MaxHeight)
+		var buf bytes.Buffer
+		d := Derivative{Name: s.Name, Width: resized.Bounds().Dx(), Height: resized.Bounds().Dy()}
+		if format == "png" {
+			d.ContentType = ContentTypePng
+			err = png.Encode(&buf, resized)
+		} else {
+			quality := s.Quality
+			if quality == 0 {
+				quality = defaultJpegQuality
+			}
+			d.ContentType = ContentTypeJpeg
+			err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: quality})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode derivative %s: %w", s.Name, err)
+		}
+		d.Data = buf.Bytes()
+		result = append(result, d)
+	}
+	return result, nil
+}
+
+// UploadFileWithDerivatives uploads an image with UploadFile together with its derivatives,
+// the derivatives are named after fileName with the name of the size as suffix, e.g. photo_thumbnail.jpg.
+// The image is validated and sanitised with ValidateUpload against the policy of reportType first.
+func UploadFileWithDerivatives(tk string, imgBytes []byte, fileName string, reportType string, contractId intstring.IntString, sizes ...DerivativeSize) (*UploadedImage, error) {
+	return uploadWithDerivatives(reportType, imgBytes, fileName, sizes, func(name string, data []byte) (string, error) {
+		return UploadFile(tk, data, name, reportType, contractId)
+	})
+}
+
+// UploadSitePlanPictureWithDerivatives is UploadFileWithDerivatives for site plan pictures
+func UploadSitePlanPictureWithDerivatives(tk string, fileName string, imgBytes []byte, sizes ...DerivativeSize) (*UploadedImage, error) {
+	return uploadWithDerivatives(reportTypeSitePlan, imgBytes, fileName, sizes, func(name string, data []byte) (string, error) {
+		url, err := UploadSitePlanPicture(tk, name, data)
+		if err != nil {
+			return "", err
+		}
+		if url == nil {
+			return "", fmt.Errorf("media module returned no url for %s", name)
+		}
+		return *url, nil
+	})
+}
+
+// uploadWithDerivatives validates the image and generates the derivatives before uploading
+// anything so that an invalid image is not uploaded, then uploads all files concurrently.
+// The sanitised image is uploaded as the original, i.e. without its GPS location.
+func uploadWithDerivatives(reportType string, imgBytes []byte, fileName string, sizes []DerivativeSize, upload func(name string, data []byte) (string, error)) (*UploadedImage, error) {
+	file, err := ValidateUpload(reportType, imgBytes, ValidateOptions{FileName: fileName})
+	if err != nil {
+		return nil, err
+	}
+	derivatives, err := GenerateDerivatives(file.Data, sizes...)
+	if err != nil {
+		return nil, err
+	}
+	original := concutil.Async(func() (interface{}, error) {
+		return upload(fileName, file.Data)
+	})
+	awaiters := make([]*concutil.Awaiter, len(derivatives))
+	for i := range derivatives {
+		d := derivatives[i]
+		awaiters[i] = concutil.Async(func() (interface{}, error) {
+			return upload(derivativeFileName(fileName, d), d.Data)
+		})
+	}
+	if err := original.Await(); err != nil {
+		return nil, err
+	}
+	result := &UploadedImage{
+		Url:         original.Get().(string),
+		Derivatives: make(map[string]string, len(derivatives)),
+	}
+	for i, a := range awaiters {
+		if err := a.Await(); err != nil {
+			return nil, fmt.Errorf("failed to upload derivative %s: %w", derivatives[i].Name, err)
+		}
+		result.Derivatives[derivatives[i].Name] = a.Get().(string)
+	}
+	return result, nil
+}
+
+func derivativeFileName(fileName string, d Derivative) string {
+	ext := ".jpg"
+	if d.ContentType == ContentTypePng {
+		ext = ".png"
+	}
+	return strings.TrimSuffix(fileName, filepath.Ext(fileName)) + "_" + d.Name + ext
+}
+
+// fitSize returns the size of w x h scaled down to fit within maxWidth x maxHeight
+func fitSize(w, h, maxWidth, maxHeight int) (int, int) {
+	if w <= maxWidth && h <= maxHeight {
+		return w, h
+	}
+	// Compare maxWidth / w with maxHeight / h without rounding
+	if maxWidth*h <= maxHeight*w {
+		h = h * maxWidth / w
+		w = maxWidth
+	} else {
+		w = w * maxHeight / h
+		h = maxHeight
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	return w, h
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Rect, img, b.Min, draw.Src)
+	return rgba
+}
+
+// orient transforms src according to an Exif orientation so that it is displayed upright
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			default:
+				sx, sy = x, y
+			}
+			copy(dst.Pix[y*dst.Stride+x*4:y*dst.Stride+x*4+4], src.Pix[sy*src.Stride+sx*4:])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,157 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testHalvesJpeg returns a 40x20 JPEG with a red left half and a blue right half
+func testHalvesJpeg(t *testing.T, orientation uint16) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 40; x++ {
+			c := color.RGBA{R: 0xff, A: 0xff}
+			if x >= 20 {
+				c = color.RGBA{B: 0xff, A: 0xff}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	exif := testExif(orientation)
+	seg := []byte{0xff, jpegMarkerAPP1, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(2+len(exifHeader)+len(exif)))
+	seg = append(append(seg, exifHeader...), exif...)
+	return append(append(append([]byte{}, data[:2]...), seg...), data[2:]...)
+}
+
+func isRed(c color.Color) bool {
+	r, _, b, _ := c.RGBA()
+	return r > 0xc000 && b < 0x4000
+}
+
+func TestGenerateDerivatives(t *testing.T) {
+	tests := []struct {
+		name        string
+		orientation uint16
+		size        DerivativeSize
+		wantW       int
+		wantH       int
+		// Position of a red pixel, in proportion of the derivative size
+		redX, redY float64
+	}{
+		{name: "Upright", orientation: 1, size: DerivativeSize{Name: "a", MaxWidth: 10, MaxHeight: 10}, wantW: 10, wantH: 5, redX: 0.25, redY: 0.5},
+		{name: "Flipped", orientation: 2, size: DerivativeSize{Name: "a", MaxWidth: 10, MaxHeight: 10}, wantW: 10, wantH: 5, redX: 0.75, redY: 0.5},
+		{name: "Rotated 180", orientation: 3, size: DerivativeSize{Name: "a", MaxWidth: 10, MaxHeight: 10}, wantW: 10, wantH: 5, redX: 0.75, redY: 0.5},
+		{name: "Rotated 90 CW", orientation: 6, size: DerivativeSize{Name: "a", MaxWidth: 10, MaxHeight: 10}, wantW: 5, wantH: 10, redX: 0.5, redY: 0.25},
+		{name: "Rotated 90 CCW", orientation: 8, size: DerivativeSize{Name: "a", MaxWidth: 10, MaxHeight: 10}, wantW: 5, wantH: 10, redX: 0.5, redY: 0.75},
+		{name: "Not scaled up", orientation: 1, size: DerivativeSize{Name: "a", MaxWidth: 100, MaxHeight: 100}, wantW: 40, wantH: 20, redX: 0.25, redY: 0.5},
+		{name: "Height bound", orientation: 1, size: DerivativeSize{Name: "a", MaxWidth: 100, MaxHeight: 4}, wantW: 8, wantH: 4, redX: 0.25, redY: 0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GenerateDerivatives(testHalvesJpeg(t, tt.orientation), tt.size)
+			if err != nil {
+				t.Fatalf("GenerateDerivatives() error = %v", err)
+			}
+			d := got[0]
+			if d.Width != tt.wantW || d.Height != tt.wantH || d.ContentType != ContentTypeJpeg {
+				t.Fatalf("derivative = %s %dx%d, want %dx%d", d.ContentType, d.Width, d.Height, tt.wantW, tt.wantH)
+			}
+			img, err := jpeg.Decode(bytes.NewReader(d.Data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if img.Bounds().Dx() != d.Width || img.Bounds().Dy() != d.Height {
+				t.Errorf("encoded size = %v", img.Bounds())
+			}
+			if c := img.At(int(tt.redX*float64(d.Width)), int(tt.redY*float64(d.Height))); !isRed(c) {
+				t.Errorf("expected red pixel, got %v", c)
+			}
+		})
+	}
+}
+
+func TestGenerateDerivativesPng(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 30, 60))); err != nil {
+		t.Fatal(err)
+	}
+	got, err := GenerateDerivatives(buf.Bytes(), DerivativeSize{Name: DerivativeThumbnail, MaxWidth: 15, MaxHeight: 15})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0].ContentType != ContentTypePng || got[0].Width != 7 || got[0].Height != 15 {
+		t.Errorf("derivative = %s %dx%d", got[0].ContentType, got[0].Width, got[0].Height)
+	}
+	if _, err := GenerateDerivatives([]byte("not an image")); err == nil {
+		t.Error("expected error decoding an invalid image")
+	}
+	if _, err := GenerateDerivatives(buf.Bytes(), DerivativeSize{Name: "a"}); err == nil {
+		t.Error("expected error for an empty size")
+	}
+}
+
+func TestUploadWithDerivatives(t *testing.T) {
+	var mu sync.Mutex
+	uploaded := map[string][]byte{}
+	upload := func(name string, data []byte) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		uploaded[name] = data
+		return "https://files/" + name, nil
+	}
+	got, err := uploadWithDerivatives("permit", testHalvesJpeg(t, 1), "photo.jpeg", GetDerivativeSizes(), upload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Url != "https://files/photo.jpeg" || got.Thumbnail() != "https://files/photo_thumbnail.jpg" ||
+		got.Derivatives[DerivativeMedium] != "https://files/photo_medium.jpg" || len(uploaded) != 3 {
+		t.Errorf("uploaded %d files, result = %+v", len(uploaded), got)
+	}
+	if _, _, ok := jpegLocation(uploaded["photo.jpeg"]); ok {
+		t.Error("original uploaded with its GPS location")
+	}
+	if _, err := uploadWithDerivatives("permit", []byte("%PDF-1.4"), "photo.jpeg", nil, upload); err == nil {
+		t.Error("expected error for an invalid image")
+	}
+
+	failed := errors.New("failed")
+	_, err = uploadWithDerivatives("permit", testHalvesJpeg(t, 1), "photo.jpeg", nil, func(name string, data []byte) (string, error) {
+		if name == "photo_medium.jpg" {
+			return "", failed
+		}
+		return name, nil
+	})
+	if !errors.Is(err, failed) {
+		t.Errorf("error = %v, want %v", err, failed)
+	}
+}
+
+func TestDecodeImageTooLarge(t *testing.T) {
+	// Patch the IHDR of a 1x1 PNG to claim 100000x100000 pixels
+	data := testPng(t)
+	ihdr := data[8:]
+	binary.BigEndian.PutUint32(ihdr[8:], 100000)
+	binary.BigEndian.PutUint32(ihdr[12:], 100000)
+	binary.BigEndian.PutUint32(ihdr[21:], crc32.ChecksumIEEE(ihdr[4:21]))
+	if _, _, err := DecodeImage(data); err == nil || !strings.Contains(err.Error(), "100000x100000") {
+		t.Errorf("DecodeImage() error = %v, want unsupported dimension", err)
+	}
+	if _, err := GenerateDerivatives(data); err == nil {
+		t.Error("GenerateDerivatives() expected error for an image exceeding the pixel limit")
+	}
+}
@@ -0,0 +1,357 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// Minimal Exif support for JPEG photos taken by the app, only what is needed for
+// reading the orientation and reading / stripping the GPS location. XMP metadata,
+// which may carry the location as well, is stripped as a whole.
+
+const (
+	exifTagOrientation  = 0x0112
+	exifTagGPSInfo      = 0x8825
+	exifTagGPSLatRef    = 0x0001
+	exifTagGPSLat       = 0x0002
+	exifTagGPSLngRef    = 0x0003
+	exifTagGPSLng       = 0x0004
+	exifTypeShort       = 3
+	exifTypeLong        = 4
+	exifTypeRational    = 5
+	jpegMarkerSOS       = 0xda
+	jpegMarkerEOI       = 0xd9
+	jpegMarkerAPP1      = 0xe1
+	exifMaxEntriesInIFD = 1000
+)
+
+var (
+	errNoExif      = errors.New("no exif")
+	errInvalidExif = errors.New("invalid exif")
+	exifHeader     = []byte("Exif\x00\x00")
+	exifTypeSizes  = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+	// Headers of the APP1 segments of XMP and extended XMP
+	xmpHeaders = [][]byte{[]byte("http://ns.adobe.com/xap/1.0/\x00"), []byte("http://ns.adobe.com/xmp/extension/\x00")}
+	// Keyword of the PNG text chunks carrying XMP
+	pngXmpKeyword = []byte("XML:com.adobe.xmp\x00")
+)
+
+type (
+	// exifData is the tiff structure inside the Exif segment of a JPEG
+	exifData struct {
+		b  []byte
+		bo binary.ByteOrder
+	}
+	exifEntry struct {
+		tag   uint16
+		typ   uint16
+		count uint32
+		// Position of the entry and its value inside exifData.b
+		pos     int
+		dataPos int
+		size    int
+	}
+)
+
+// findJpegExif returns the position of the tiff structure inside the Exif segment of a JPEG,
+// as well as the position of the whole segment
+func findJpegExif(data []byte) (tiffStart, tiffEnd, segStart int, err error) {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return 0, 0, 0, errInvalidExif
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xff {
+			return 0, 0, 0, errInvalidExif
+		}
+		marker := data[i+1]
+		if marker == jpegMarkerSOS || marker == jpegMarkerEOI {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return 0, 0, 0, errInvalidExif
+		}
+		if marker == jpegMarkerAPP1 && bytes.HasPrefix(data[i+4:end], exifHeader) {
+			return i + 4 + len(exifHeader), end, i, nil
+		}
+		i = end
+	}
+	return 0, 0, 0, errNoExif
+}
+
+func parseExif(b []byte) (*exifData, error) {
+	if len(b) < 8 {
+		return nil, errInvalidExif
+	}
+	e := &exifData{b: b}
+	switch string(b[:4]) {
+	case "II*\x00":
+		e.bo = binary.LittleEndian
+	case "MM\x00*":
+		e.bo = binary.BigEndian
+	default:
+		return nil, errInvalidExif
+	}
+	return e, nil
+}
+
+func (e *exifData) ifd0() int {
+	return int(e.bo.Uint32(e.b[4:]))
+}
+
+func (e *exifData) entries(offset int) ([]exifEntry, error) {
+	if offset <= 0 || offset+2 > len(e.b) {
+		return nil, errInvalidExif
+	}
+	count := int(e.bo.Uint16(e.b[offset:]))
+	if count > exifMaxEntriesInIFD || offset+2+count*12 > len(e.b) {
+		return nil, errInvalidExif
+	}
+	result := make([]exifEntry, 0, count)
+	for i := 0; i < count; i++ {
+		pos := offset + 2 + i*12
+		entry := exifEntry{
+			tag:   e.bo.Uint16(e.b[pos:]),
+			typ:   e.bo.Uint16(e.b[pos+2:]),
+			count: e.bo.Uint32(e.b[pos+4:]),
+			pos:   pos,
+		}
+		typeSize, ok := exifTypeSizes[entry.typ]
+		if !ok || entry.count > uint32(len(e.b)) {
+			return nil, errInvalidExif
+		}
+		entry.size = typeSize * int(entry.count)
+		entry.dataPos = pos + 8
+		if entry.size > 4 {
+			entry.dataPos = int(e.bo.Uint32(e.b[pos+8:]))
+		}
+		if entry.dataPos < 0 || entry.dataPos+entry.size > len(e.b) {
+			return nil, errInvalidExif
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
+func (e *exifData) find(entries []exifEntry, tag uint16) (exifEntry, bool) {
+	for _, entry := range entries {
+		if entry.tag == tag {
+			return entry, true
+		}
+	}
+	return exifEntry{}, false
+}
+
+func (e *exifData) uint(entry exifEntry) (uint32, bool) {
+	switch {
+	case entry.typ == exifTypeShort && entry.count >= 1:
+		return uint32(e.bo.Uint16(e.b[entry.dataPos:])), true
+	case entry.typ == exifTypeLong && entry.count >= 1:
+		return e.bo.Uint32(e.b[entry.dataPos:]), true
+	}
+	return 0, false
+}
+
+// degrees reads a GPS coordinate stored as 3 rationals (degrees, minutes, seconds)
+func (e *exifData) degrees(entry exifEntry) (float64, bool) {
+	if entry.typ != exifTypeRational || entry.count != 3 {
+		return 0, false
+	}
+	result := 0.0
+	for i, div := range []float64{1, 60, 3600} {
+		num := e.bo.Uint32(e.b[entry.dataPos+i*8:])
+		den := e.bo.Uint32(e.b[entry.dataPos+i*8+4:])
+		if den == 0 {
+			return 0, false
+		}
+		result += float64(num) / float64(den) / div
+	}
+	return result, true
+}
+
+func (e *exifData) gpsEntries() ([]exifEntry, exifEntry, bool) {
+	ifd0, err := e.entries(e.ifd0())
+	if err != nil {
+		return nil, exifEntry{}, false
+	}
+	pointer, ok := e.find(ifd0, exifTagGPSInfo)
+	if !ok {
+		return nil, exifEntry{}, false
+	}
+	offset, ok := e.uint(pointer)
+	if !ok {
+		return nil, exifEntry{}, false
+	}
+	gps, err := e.entries(int(offset))
+	if err != nil {
+		return nil, exifEntry{}, false
+	}
+	return gps, pointer, true
+}
+
+// jpegOrientation returns the Exif orientation (1-8) of a JPEG, 1 if there is none
+func jpegOrientation(data []byte) int {
+	start, end, _, err := findJpegExif(data)
+	if err != nil {
+		return 1
+	}
+	e, err := parseExif(data[start:end])
+	if err != nil {
+		return 1
+	}
+	ifd0, err := e.entries(e.ifd0())
+	if err != nil {
+		return 1
+	}
+	entry, ok := e.find(ifd0, exifTagOrientation)
+	if !ok {
+		return 1
+	}
+	if o, ok := e.uint(entry); ok && o >= 1 && o <= 8 {
+		return int(o)
+	}
+	return 1
+}
+
+// jpegLocation returns the GPS location of a JPEG in decimal degrees
+func jpegLocation(data []byte) (lat, lng float64, ok bool) {
+	start, end, _, err := findJpegExif(data)
+	if err != nil {
+		return 0, 0, false
+	}
+	e, err := parseExif(data[start:end])
+	if err != nil {
+		return 0, 0, false
+	}
+	gps, _, ok := e.gpsEntries()
+	if !ok {
+		return 0, 0, false
+	}
+	latEntry, ok1 := e.find(gps, exifTagGPSLat)
+	lngEntry, ok2 := e.find(gps, exifTagGPSLng)
+	if !ok1 || !ok2 {
+		return 0, 0, false
+	}
+	if lat, ok1 = e.degrees(latEntry); !ok1 {
+		return 0, 0, false
+	}
+	if lng, ok2 = e.degrees(lngEntry); !ok2 {
+		return 0, 0, false
+	}
+	if ref, ok := e.find(gps, exifTagGPSLatRef); ok && e.b[ref.dataPos] == 'S' {
+		lat = -lat
+	}
+	if ref, ok := e.find(gps, exifTagGPSLngRef); ok && e.b[ref.dataPos] == 'W' {
+		lng = -lng
+	}
+	return lat, lng, true
+}
+
+// stripJpegGPS returns a copy of data with the GPS data overwritten by zeros and the GPS
+// directory emptied. If the Exif cannot be parsed, the whole Exif segment is removed instead.
+func stripJpegGPS(data []byte) []byte {
+	start, end, segStart, err := findJpegExif(data)
+	if err != nil {
+		// No Exif, or not a parsable JPEG which is rejected by the image validation anyway
+		return data
+	}
+	result := append([]byte{}, data...)
+	e, err := parseExif(result[start:end])
+	if err != nil {
+		return append(result[:segStart:segStart], data[end:]...)
+	}
+	gps, pointer, ok := e.gpsEntries()
+	if !ok {
+		if _, hasPointer := e.find(e.ifd0Entries(), exifTagGPSInfo); hasPointer {
+			// GPS directory is present but corrupted
+			return append(result[:segStart:segStart], data[end:]...)
+		}
+		return result
+	}
+	for _, entry := range gps {
+		if entry.size > 4 {
+			zeroBytes(e.b[entry.dataPos : entry.dataPos+entry.size])
+		}
+		zeroBytes(e.b[entry.pos : entry.pos+12])
+	}
+	offset, _ := e.uint(pointer)
+	e.bo.PutUint16(e.b[offset:], 0)
+	return result
+}
+
+// ifd0Entries returns the entries of IFD0, nil if it cannot be parsed
+func (e *exifData) ifd0Entries() []exifEntry {
+	entries, _ := e.entries(e.ifd0())
+	return entries
+}
+
+// stripJpegXMP returns a copy of data without the XMP segments
+func stripJpegXMP(data []byte) []byte {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return data
+	}
+	result := append([]byte{}, data[:2]...)
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xff {
+			return data
+		}
+		marker := data[i+1]
+		if marker == jpegMarkerSOS || marker == jpegMarkerEOI {
+			return append(result, data[i:]...)
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return data
+		}
+		if marker != jpegMarkerAPP1 || !isXmp(data[i+4:end]) {
+			result = append(result, data[i:end]...)
+		}
+		i = end
+	}
+	return data
+}
+
+func isXmp(segment []byte) bool {
+	for _, header := range xmpHeaders {
+		if bytes.HasPrefix(segment, header) {
+			return true
+		}
+	}
+	return false
+}
+
+// stripPngLocation returns a copy of data without the eXIf chunk and the text chunks carrying XMP
+func stripPngLocation(data []byte) []byte {
+	const sigLen = 8
+	if len(data) < sigLen {
+		return data
+	}
+	result := append([]byte{}, data[:sigLen]...)
+	for i := sigLen; i+12 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		end := i + 12 + length
+		if length < 0 || end > len(data) {
+			return data
+		}
+		switch string(data[i+4 : i+8]) {
+		case "eXIf":
+		case "iTXt", "tEXt", "zTXt":
+			if !bytes.HasPrefix(data[i+8:end-4], pngXmpKeyword) {
+				result = append(result, data[i:end]...)
+			}
+		default:
+			result = append(result, data[i:end]...)
+		}
+		i = end
+	}
+	return result
+}
+
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
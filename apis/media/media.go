@@ -172,51 +172,29 @@ func GetMediaBatches(tk string, batchId ...string) (map[string][]model.MediaPara
 }
 
 func GetMediaByBatchId(tk string, batchId string) ([]model.MediaParam, error) {
-	return GetMedia(tk, map[string]interface{}{
-		"batchId": batchId,
-	})
+	return GetMediaByQuery(tk, *NewMediaQuery().InBatch(batchId))
 }
 
 // Media in different batches can refer to the same siteWalkId.
 // This function would return all of them
 func GetMediaBySiteWalkId(tk string, siteWalkId intstring.IntString) ([]model.MediaParam, error) {
-	return GetMedia(tk, map[string]interface{}{
-		"mediaRefInfo": map[string]interface{}{
-			"siteWalkId": siteWalkId,
-		},
-	})
+	return GetMediaByQuery(tk, *NewMediaQuery().WhereRef(RefKeySiteWalkId, siteWalkId))
 }
 
 func GetMediaByNcId(tk string, ncFindingId intstring.IntString) ([]model.MediaParam, error) {
-	return GetMedia(tk, map[string]interface{}{
-		"mediaRefInfo": map[string]interface{}{
-			"ncFindingId":  ncFindingId,
-			"taskActionId": "",
-		},
-		"includeEmptyValues": true,
-	})
+	return GetMediaByQuery(tk, *NewMediaQuery().WhereRef(RefKeyNcFindingId, ncFindingId).WhereRefEmpty(RefKeyTaskActionId))
 }
 
 func GetMediaByTaskId(tk string, taskId intstring.IntString) ([]model.MediaParam, error) {
-	return GetMedia(tk, map[string]interface{}{
-		"mediaRefInfo": map[string]interface{}{
-			"taskId":       taskId,
-			"taskActionId": "",
-		},
-		"includeEmptyValues": true,
-	})
+	return GetMediaByQuery(tk, *NewMediaQuery().WhereRef(RefKeyTaskId, taskId).WhereRefEmpty(RefKeyTaskActionId))
 }
 
 func GetMediaByTaskActionId(tk string, taskActionId intstring.IntString, taskActionType ...string) ([]model.MediaParam, error) {
-	refInfo := map[string]interface{}{
-		"taskActionId": taskActionId,
-	}
+	q := NewMediaQuery().WhereRef(RefKeyTaskActionId, taskActionId)
 	if len(taskActionType) > 0 {
-		refInfo["taskActionType"] = taskActionType[0]
+		q.WhereRef(RefKeyTaskActionType, taskActionType[0])
 	}
-	return GetMedia(tk, map[string]interface{}{
-		"mediaRefInfo": refInfo,
-	})
+	return GetMediaByQuery(tk, *q)
 }
 
 func ShouldGetMediaByTaskActionId(tk string, taskActionId intstring.IntString, taskActionType ...string) []model.MediaParam {
@@ -231,19 +209,11 @@ func ShouldGetMediaByTaskActionId(tk string, taskActionId intstring.IntString, t
 }
 
 func GetMediaByGeneralFindingId(tk string, generalFindingId intstring.IntString) ([]model.MediaParam, error) {
-	return GetMedia(tk, map[string]interface{}{
-		"mediaRefInfo": map[string]interface{}{
-			"generalFindingId": generalFindingId,
-		},
-	})
+	return GetMediaByQuery(tk, *NewMediaQuery().WhereRef(RefKeyGeneralFindingId, generalFindingId))
 }
 
 func GetMediaByChecklistId(tk string, checklistId intstring.IntString) ([]model.MediaParam, error) {
-	return GetMedia(tk, map[string]interface{}{
-		"mediaRefInfo": map[string]interface{}{
-			"checklistId": checklistId,
-		},
-	})
+	return GetMediaByQuery(tk, *NewMediaQuery().WhereRef(RefKeyChecklistId, checklistId))
 }
 
 func MapMediaByChecklistItemId(media []model.MediaParam, errOpt ...error) (map[intstring.IntString][]model.MediaParam, error) {
@@ -252,7 +222,7 @@ func MapMediaByChecklistItemId(media []model.MediaParam, errOpt ...error) (map[i
 		err = errOpt[0]
 	}
 	return MapMediaById(media, err, func(m model.MediaParam) intstring.IntString {
-		return m.ShouldGetRefInfo().ShouldGetIntString("checklistItemId")
+		return m.ShouldGetRefInfo().ShouldGetIntString(string(RefKeyChecklistItemId))
 	})
 }
 
@@ -262,7 +232,7 @@ func MapMediaByGeneralFindingId(media []model.MediaParam, errOpt ...error) (map[
 		err = errOpt[0]
 	}
 	return MapMediaById(media, err, func(m model.MediaParam) intstring.IntString {
-		return m.ShouldGetRefInfo().ShouldGetIntString("generalFindingId")
+		return m.ShouldGetRefInfo().ShouldGetIntString(string(RefKeyGeneralFindingId))
 	})
 }
 
@@ -272,7 +242,7 @@ func MapMediaByNcFindingId(media []model.MediaParam, errOpt ...error) (map[intst
 		err = errOpt[0]
 	}
 	return MapMediaById(media, err, func(m model.MediaParam) intstring.IntString {
-		return m.ShouldGetRefInfo().ShouldGetIntString("ncFindingId")
+		return m.ShouldGetRefInfo().ShouldGetIntString(string(RefKeyNcFindingId))
 	})
 }
 
@@ -346,7 +316,7 @@ func (s Scope) AddRestriction(key, value string) Scope {
 }
 
 func (s Scope) AddTaskActionTypeRestriction(value string) Scope {
-	return s.AddRestriction("taskActionType", value)
+	return s.Restrict(RefKeyTaskActionType, value)
 }
 
 func UploadSitePlanPicture(tk string, fileName string, imgBytes []byte) (*string, error) {
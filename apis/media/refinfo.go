@@ -0,0 +1,230 @@
+package media
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/genericjson"
+	"github.com/Mobility-Development-Team/be-common-mdl/model"
+	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+)
+
+// RefKey is a key of MediaParam.MediaRefInfo
+type RefKey string
+
+const (
+	RefKeySiteWalkId       RefKey = "siteWalkId"
+	RefKeyNcFindingId      RefKey = "ncFindingId"
+	RefKeyGeneralFindingId RefKey = "generalFindingId"
+	RefKeyTaskId           RefKey = "taskId"
+	RefKeyTaskActionId     RefKey = "taskActionId"
+	RefKeyTaskActionType   RefKey = "taskActionType"
+	RefKeyChecklistId      RefKey = "checklistId"
+	RefKeyChecklistItemId  RefKey = "checklistItemId"
+)
+
+// Typed MediaRefInfo structs, marshalled as is into MediaRefInfo. The values of MediaRefType
+// are defined by the services creating the media, they must be registered with RegisterRefInfo
+// to be used by DecodeRefInfo and SetRefInfo.
+type (
+	SiteWalkRefInfo struct {
+		SiteWalkId intstring.IntString `json:"siteWalkId,omitempty"`
+	}
+	NcFindingRefInfo struct {
+		SiteWalkId  intstring.IntString `json:"siteWalkId,omitempty"`
+		NcFindingId intstring.IntString `json:"ncFindingId,omitempty"`
+	}
+	GeneralFindingRefInfo struct {
+		SiteWalkId       intstring.IntString `json:"siteWalkId,omitempty"`
+		GeneralFindingId intstring.IntString `json:"generalFindingId,omitempty"`
+	}
+	TaskRefInfo struct {
+		TaskId intstring.IntString `json:"taskId,omitempty"`
+	}
+	TaskActionRefInfo struct {
+		TaskId         intstring.IntString `json:"taskId,omitempty"`
+		NcFindingId    intstring.IntString `json:"ncFindingId,omitempty"`
+		TaskActionId   intstring.IntString `json:"taskActionId,omitempty"`
+		TaskActionType string              `json:"taskActionType,omitempty"`
+	}
+	ChecklistRefInfo struct {
+		ChecklistId     intstring.IntString `json:"checklistId,omitempty"`
+		ChecklistItemId intstring.IntString `json:"checklistItemId,omitempty"`
+	}
+	// UnknownRefInfo is returned by DecodeRefInfo for a MediaRefType without a registered RefInfo
+	UnknownRefInfo struct {
+		RefType string
+		Info    genericjson.Object
+	}
+
+	// MediaQuery is the request body of GetMedia
+	MediaQuery struct {
+		BatchId            string             `json:"batchId,omitempty"`
+		RefInfo            genericjson.Object `json:"mediaRefInfo,omitempty"`
+		IncludeEmptyValues bool               `json:"includeEmptyValues,omitempty"`
+	}
+)
+
+func (i UnknownRefInfo) MarshalJSON() ([]byte, error) {
+	return json.Marshal(i.Info)
+}
+
+var (
+	muRefInfoTypes sync.RWMutex
+	refInfoTypes   = map[string]reflect.Type{}
+	refTypes       = map[reflect.Type]string{}
+)
+
+// RegisterRefInfo registers the struct type of info for refType, the MediaRefType of the media
+// having info as MediaRefInfo, replacing the existing registration of refType or info if any.
+// info must be a struct value, not a pointer.
+func RegisterRefInfo(refType string, info interface{}) {
+	t := reflect.TypeOf(info)
+	if t == nil || t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("media: RefInfo %v must be a struct", t))
+	}
+	muRefInfoTypes.Lock()
+	defer muRefInfoTypes.Unlock()
+	if old, ok := refInfoTypes[refType]; ok {
+		delete(refTypes, old)
+	}
+	if old, ok := refTypes[t]; ok {
+		delete(refInfoTypes, old)
+	}
+	refInfoTypes[refType] = t
+	refTypes[t] = refType
+}
+
+// registeredRefType returns the MediaRefType registered for the type of info
+func registeredRefType(info interface{}) (string, bool) {
+	muRefInfoTypes.RLock()
+	defer muRefInfoTypes.RUnlock()
+	refType, ok := refTypes[reflect.TypeOf(info)]
+	return refType, ok
+}
+
+// DecodeRefInfo decodes the MediaRefInfo of m into the struct registered for its MediaRefType,
+// an UnknownRefInfo is returned if there is none.
+func DecodeRefInfo(m model.MediaParam) (interface{}, error) {
+	muRefInfoTypes.RLock()
+	t, ok := refInfoTypes[m.MediaRefType]
+	muRefInfoTypes.RUnlock()
+	if !ok {
+		info := UnknownRefInfo{RefType: m.MediaRefType}
+		if err := unmarshalRefInfo(m, &info.Info); err != nil {
+			return nil, err
+		}
+		return info, nil
+	}
+	ptr := reflect.New(t)
+	if err := unmarshalRefInfo(m, ptr.Interface()); err != nil {
+		return nil, err
+	}
+	return ptr.Elem().Interface(), nil
+}
+
+// GetRefInfo decodes the MediaRefInfo of m into T. If T is registered, m must be of its MediaRefType,
+// media without a MediaRefType are decoded as well since some records are created without one.
+func GetRefInfo[T any](m model.MediaParam) (T, error) {
+	var info T
+	if refType, ok := registeredRefType(info); ok && m.MediaRefType != "" && m.MediaRefType != refType {
+		return info, fmt.Errorf("media %s has ref type %s, not %s", m.Id, m.MediaRefType, refType)
+	}
+	err := unmarshalRefInfo(m, &info)
+	return info, err
+}
+
+// SetRefInfo sets the MediaRefType registered for info and the MediaRefInfo of m, replacing the
+// existing ones. Use model.MediaParam.ShouldSetRefInfo for a type that is not registered.
+func SetRefInfo(m *model.MediaParam, info interface{}) error {
+	refType, ok := registeredRefType(info)
+	if !ok {
+		return fmt.Errorf("media: RefInfo %T is not registered", info)
+	}
+	b, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	m.MediaRefType = refType
+	m.MediaRefInfo = b
+	return nil
+}
+
+func unmarshalRefInfo(m model.MediaParam, v interface{}) error {
+	if len(m.MediaRefInfo) == 0 || string(m.MediaRefInfo) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(m.MediaRefInfo, v); err != nil {
+		return fmt.Errorf("invalid refInfo of media %s: %w", m.Id, err)
+	}
+	return nil
+}
+
+func NewMediaQuery() *MediaQuery {
+	return &MediaQuery{}
+}
+
+func (q *MediaQuery) InBatch(batchId string) *MediaQuery {
+	q.BatchId = batchId
+	return q
+}
+
+// WhereRef matches media with the given value in their MediaRefInfo
+func (q *MediaQuery) WhereRef(key RefKey, value interface{}) *MediaQuery {
+	if q.RefInfo == nil {
+		q.RefInfo = genericjson.Object{}
+	}
+	q.RefInfo[string(key)] = value
+	return q
+}
+
+// WhereRefEmpty matches media without a value of key in their MediaRefInfo
+func (q *MediaQuery) WhereRefEmpty(key RefKey) *MediaQuery {
+	q.IncludeEmptyValues = true
+	return q.WhereRef(key, "")
+}
+
+// WhereRefInfo matches media with all non-empty fields of info in their MediaRefInfo
+func (q *MediaQuery) WhereRefInfo(info interface{}) *MediaQuery {
+	q.RefInfo.ShouldMerge(info)
+	return q
+}
+
+// Body returns the query as the request body of GetMedia
+func (q MediaQuery) Body() map[string]interface{} {
+	return genericjson.NewObject(q)
+}
+
+// GetMediaByQuery is GetMedia with a typed query
+func GetMediaByQuery(tk string, q MediaQuery) ([]model.MediaParam, error) {
+	return GetMedia(tk, q.Body())
+}
+
+// NewScope returns a Scope restricted to all non-empty fields of info
+func NewScope(info interface{}) Scope {
+	s := Scope{}
+	for k, v := range genericjson.NewObject(info) {
+		s[k] = formatScopeValue(v)
+	}
+	return s
+}
+
+// Restrict is AddRestriction with a typed key, value is formatted with formatScopeValue
+func (s Scope) Restrict(key RefKey, value interface{}) Scope {
+	return s.AddRestriction(string(key), formatScopeValue(value))
+}
+
+// formatScopeValue formats a ref info value as a scope value. Numbers decoded from JSON are
+// float64 and are formatted without exponent, so that e.g. the id 1234567 is "1234567".
+func formatScopeValue(v interface{}) string {
+	switch v := v.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,124 @@
+package media
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/model"
+)
+
+// registerTestRefInfo registers info for refType until the end of the test
+func registerTestRefInfo(t *testing.T, refType string, info interface{}) {
+	RegisterRefInfo(refType, info)
+	t.Cleanup(func() {
+		muRefInfoTypes.Lock()
+		defer muRefInfoTypes.Unlock()
+		delete(refTypes, refInfoTypes[refType])
+		delete(refInfoTypes, refType)
+	})
+}
+
+func TestMediaQueryBody(t *testing.T) {
+	tests := []struct {
+		name  string
+		query *MediaQuery
+		want  string
+	}{
+		{name: "Batch", query: NewMediaQuery().InBatch("b1"), want: `{"batchId":"b1"}`},
+		{name: "Site walk", query: NewMediaQuery().WhereRef(RefKeySiteWalkId, 12), want: `{"mediaRefInfo":{"siteWalkId":12}}`},
+		{
+			name:  "NC finding without task action",
+			query: NewMediaQuery().WhereRef(RefKeyNcFindingId, "3").WhereRefEmpty(RefKeyTaskActionId),
+			want:  `{"mediaRefInfo":{"ncFindingId":"3","taskActionId":""},"includeEmptyValues":true}`,
+		},
+		{
+			name:  "Typed ref info",
+			query: NewMediaQuery().WhereRefInfo(TaskActionRefInfo{TaskActionId: 5, TaskActionType: "REPLY"}),
+			want:  `{"mediaRefInfo":{"taskActionId":"5","taskActionType":"REPLY"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := json.Marshal(tt.query.Body())
+			var gotObj, wantObj interface{}
+			_ = json.Unmarshal(got, &gotObj)
+			_ = json.Unmarshal([]byte(tt.want), &wantObj)
+			if !reflect.DeepEqual(gotObj, wantObj) {
+				t.Errorf("Body() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeRefInfo(t *testing.T) {
+	registerTestRefInfo(t, "testChecklist", ChecklistRefInfo{})
+	registerTestRefInfo(t, "testSiteWalk", SiteWalkRefInfo{})
+	tests := []struct {
+		name    string
+		media   model.MediaParam
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			name:  "Registered",
+			media: model.MediaParam{MediaRefType: "testChecklist", MediaRefInfo: json.RawMessage(`{"checklistId":"1","checklistItemId":2}`)},
+			want:  ChecklistRefInfo{ChecklistId: 1, ChecklistItemId: 2},
+		},
+		{
+			name:  "Unknown",
+			media: model.MediaParam{MediaRefType: "other", MediaRefInfo: json.RawMessage(`{"a":"b"}`)},
+			want:  UnknownRefInfo{RefType: "other", Info: map[string]interface{}{"a": "b"}},
+		},
+		{
+			name:  "Empty",
+			media: model.MediaParam{MediaRefType: "testSiteWalk"},
+			want:  SiteWalkRefInfo{},
+		},
+		{
+			name:    "Invalid",
+			media:   model.MediaParam{MediaRefType: "testSiteWalk", MediaRefInfo: json.RawMessage(`{"siteWalkId":"x"}`)},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeRefInfo(tt.media)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecodeRefInfo() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DecodeRefInfo() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetRefInfo(t *testing.T) {
+	var m model.MediaParam
+	if err := SetRefInfo(&m, NcFindingRefInfo{}); err == nil {
+		t.Error("SetRefInfo() expected error for a type that is not registered")
+	}
+	registerTestRefInfo(t, "testNcFinding", NcFindingRefInfo{})
+	registerTestRefInfo(t, "testTask", TaskRefInfo{})
+	if err := SetRefInfo(&m, NcFindingRefInfo{SiteWalkId: 1, NcFindingId: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if m.MediaRefType != "testNcFinding" || string(m.MediaRefInfo) != `{"siteWalkId":"1","ncFindingId":"2"}` {
+		t.Errorf("media = %s %s", m.MediaRefType, m.MediaRefInfo)
+	}
+	if id := m.ShouldGetRefInfo().ShouldGetIntString(string(RefKeyNcFindingId)); id != 2 {
+		t.Errorf("ShouldGetRefInfo() ncFindingId = %v", id)
+	}
+	info, err := GetRefInfo[NcFindingRefInfo](m)
+	if err != nil || info.NcFindingId != 2 {
+		t.Errorf("GetRefInfo() = %v, %v", info, err)
+	}
+	if _, err := GetRefInfo[TaskRefInfo](m); err == nil {
+		t.Error("GetRefInfo() expected error for a different ref type")
+	}
+	scope := NewScope(TaskActionRefInfo{TaskActionId: 3}).Restrict(RefKeyTaskActionType, "REPLY")
+	if !reflect.DeepEqual(scope, Scope{"taskActionId": "3", "taskActionType": "REPLY"}) {
+		t.Errorf("NewScope() = %v", scope)
+	}
+}
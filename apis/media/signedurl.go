@@ -0,0 +1,295 @@
+package media
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/apis"
+	"github.com/Mobility-Development-Team/be-common-mdl/common"
+	"github.com/Mobility-Development-Team/be-common-mdl/model"
+	"github.com/Mobility-Development-Team/be-common-mdl/response"
+	"github.com/Mobility-Development-Team/be-common-mdl/util/cacheutil"
+)
+
+// The signing endpoint is not confirmed by the media module yet. Urls are only signed if enabled
+// with `apis.media.signedurl.enabled`, otherwise they are returned as is.
+const (
+	signFileKeys = "%s/file/sign"
+
+	signedUrlEnabledConfig = "apis.media.signedurl.enabled"
+	signedUrlTTLConfig     = "apis.media.signedurl.ttl"
+	// Default validity of signed urls requested from the media module
+	DefaultSignedUrlTTL = 15 * time.Minute
+	// Cached signed urls are renewed when they expire within this duration, so that a
+	// url handed out is always valid for a while
+	DefaultSignedUrlRefreshBefore = 2 * time.Minute
+)
+
+type (
+	// FileUrl is the permanent url of a file stored by the media module, e.g. MediaParam.FirebaseUrl
+	// or a report url returned by UploadReport
+	FileUrl string
+	// SignedUrl is a short-lived download url of a file
+	SignedUrl struct {
+		Url       string    `json:"url"`
+		Key       string    `json:"key"`
+		ExpiresAt time.Time `json:"expiresAt"`
+	}
+	// UrlSigner requests signed urls from the media module and caches them until shortly
+	// before they expire, together with the file keys of the urls as they never change.
+	// Both are cached per caller token since the media module checks the access of the caller.
+	UrlSigner struct {
+		// Requested validity of the signed urls, `apis.media.signedurl.ttl` or DefaultSignedUrlTTL if zero
+		TTL time.Duration
+		// Defaults to DefaultSignedUrlRefreshBefore, must be shorter than TTL
+		RefreshBefore time.Duration
+
+		mu      sync.Mutex
+		entries map[signerKey]*signerEntry
+		now     func() time.Time
+	}
+	signerKey struct {
+		caller string
+		url    string
+	}
+	signerEntry struct {
+		key    string
+		signed *SignedUrl
+		// Time the file key was fetched, used for evicting entries never signed
+		added time.Time
+	}
+)
+
+// DefaultUrlSigner is used by FileUrl.Sign and SignUrls, its urls are cached per caller
+var DefaultUrlSigner = NewUrlSigner()
+
+func NewUrlSigner() *UrlSigner {
+	return &UrlSigner{
+		entries: map[signerKey]*signerEntry{},
+		now:     time.Now,
+	}
+}
+
+func (u FileUrl) String() string {
+	return string(u)
+}
+
+// Sign returns a signed url of u with DefaultUrlSigner
+func (u FileUrl) Sign(tk string) (string, error) {
+	return DefaultUrlSigner.SignOne(tk, string(u))
+}
+
+// ExpiresWithin returns true if the url expires within d
+func (s SignedUrl) ExpiresWithin(d time.Duration) bool {
+	return s.expiresWithin(time.Now(), d)
+}
+
+func (s SignedUrl) expiresWithin(now time.Time, d time.Duration) bool {
+	return s.ExpiresAt.Sub(now) <= d
+}
+
+// SignUrls is UrlSigner.Sign with DefaultUrlSigner
+func SignUrls(tk string, urls ...string) (map[string]SignedUrl, error) {
+	return DefaultUrlSigner.Sign(tk, urls...)
+}
+
+// Sign returns a signed url for each of the given urls, keyed by the url. Empty urls are ignored.
+// Only the urls without a signed url cached for the caller valid for longer than RefreshBefore are requested.
+// Unless signing is enabled in config, the urls are returned unsigned with a zero ExpiresAt.
+func (s *UrlSigner) Sign(tk string, urls ...string) (map[string]SignedUrl, error) {
+	if !apis.V().GetBool(signedUrlEnabledConfig) {
+		result := make(map[string]SignedUrl, len(urls))
+		for _, url := range urls {
+			if url != "" {
+				result[url] = SignedUrl{Url: url}
+			}
+		}
+		return result, nil
+	}
+	ttl, refreshBefore := s.ttl(), s.refreshBefore()
+	if refreshBefore >= ttl {
+		return nil, fmt.Errorf("signed url ttl %s must be longer than the refresh time %s", ttl, refreshBefore)
+	}
+	caller := cacheutil.CallerKey(tk)
+	result := make(map[string]SignedUrl, len(urls))
+	var toSign, noKey []string
+	s.mu.Lock()
+	now := s.now()
+	for _, url := range urls {
+		if url == "" {
+			continue
+		}
+		entry, ok := s.entries[signerKey{caller, url}]
+		if ok && entry.signed != nil && !entry.signed.expiresWithin(now, refreshBefore) {
+			result[url] = *entry.signed
+			continue
+		}
+		toSign = append(toSign, url)
+		if !ok {
+			noKey = append(noKey, url)
+		}
+	}
+	s.mu.Unlock()
+	if len(toSign) == 0 {
+		return result, nil
+	}
+
+	if len(noKey) > 0 {
+		keys, err := GetFileKeys(tk, noKey)
+		if err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		for url, key := range keys {
+			if k := (signerKey{caller, url}); key != "" && s.entries[k] == nil {
+				s.entries[k] = &signerEntry{key: key, added: now}
+			}
+		}
+		s.mu.Unlock()
+	}
+	urlsByKey := map[string][]string{}
+	var missing []string
+	s.mu.Lock()
+	for _, url := range toSign {
+		if entry, ok := s.entries[signerKey{caller, url}]; ok {
+			urlsByKey[entry.key] = append(urlsByKey[entry.key], url)
+		} else {
+			missing = append(missing, url)
+		}
+	}
+	s.mu.Unlock()
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("media module returned no file key for %s", strings.Join(missing, ", "))
+	}
+
+	keys := make([]string, 0, len(urlsByKey))
+	for key := range urlsByKey {
+		keys = append(keys, key)
+	}
+	signed, err := signFiles(tk, keys, ttl)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.evictExpired(now, ttl)
+	for _, key := range keys {
+		su, ok := signed[key]
+		if !ok {
+			return nil, fmt.Errorf("media module returned no signed url for %s", strings.Join(urlsByKey[key], ", "))
+		}
+		if su.ExpiresAt.IsZero() {
+			su.ExpiresAt = now.Add(ttl)
+		}
+		for _, url := range urlsByKey[key] {
+			su := su
+			s.entries[signerKey{caller, url}] = &signerEntry{key: key, signed: &su}
+			result[url] = su
+		}
+	}
+	return result, nil
+}
+
+// SignOne returns the signed url of url
+func (s *UrlSigner) SignOne(tk string, url string) (string, error) {
+	signed, err := s.Sign(tk, url)
+	if err != nil {
+		return "", err
+	}
+	return signed[url].Url, nil
+}
+
+// SignMedia returns a copy of media with FirebaseUrl and FirebaseUrlThumbnail replaced by signed urls
+func (s *UrlSigner) SignMedia(tk string, media []model.MediaParam) ([]model.MediaParam, error) {
+	urls := make([]string, 0, len(media)*2)
+	for _, m := range media {
+		urls = append(urls, m.FirebaseUrl, m.FirebaseUrlThumbnail)
+	}
+	signed, err := s.Sign(tk, urls...)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]model.MediaParam, len(media))
+	for i, m := range media {
+		if su, ok := signed[m.FirebaseUrl]; ok {
+			m.FirebaseUrl = su.Url
+		}
+		if su, ok := signed[m.FirebaseUrlThumbnail]; ok {
+			m.FirebaseUrlThumbnail = su.Url
+		}
+		result[i] = m
+	}
+	return result, nil
+}
+
+// Invalidate removes the cached signed urls of the given urls for all callers, e.g. when the files are replaced
+func (s *UrlSigner) Invalidate(urls ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k := range s.entries {
+		for _, url := range urls {
+			if k.url == url {
+				delete(s.entries, k)
+			}
+		}
+	}
+}
+
+// evictExpired removes the entries with an expired signed url so that the entries of past callers
+// are not kept, the file keys of urls still signed for a caller are kept for the renewal. Entries
+// with a file key only, whose signing failed, are removed once they are older than ttl.
+func (s *UrlSigner) evictExpired(now time.Time, ttl time.Duration) {
+	for k, entry := range s.entries {
+		if entry.signed == nil && now.Sub(entry.added) >= ttl ||
+			entry.signed != nil && !entry.signed.ExpiresAt.After(now) {
+			delete(s.entries, k)
+		}
+	}
+}
+
+func (s *UrlSigner) ttl() time.Duration {
+	if s.TTL > 0 {
+		return s.TTL
+	}
+	if d := apis.V().GetDuration(signedUrlTTLConfig); d > 0 {
+		return d
+	}
+	return DefaultSignedUrlTTL
+}
+
+func (s *UrlSigner) refreshBefore() time.Duration {
+	if s.RefreshBefore > 0 {
+		return s.RefreshBefore
+	}
+	return DefaultSignedUrlRefreshBefore
+}
+
+// signFiles requests signed urls of the given file keys, valid for ttl
+func signFiles(tk string, keys []string, ttl time.Duration) (map[string]SignedUrl, error) {
+	var resp struct {
+		response.Response
+		Payload []SignedUrl `json:"payload"`
+	}
+	client := common.NewResty()
+	result, err := client.R().SetAuthToken(tk).SetBody(map[string]interface{}{
+		"keys":      keys,
+		"expiresIn": int64(ttl / time.Second),
+	}).Post(fmt.Sprintf(signFileKeys, apis.V().GetString(apiMediaMdlUrlBase)))
+	if err != nil {
+		return nil, err
+	}
+	if !result.IsSuccess() {
+		return nil, fmt.Errorf("media module returned status code: %d", result.StatusCode())
+	}
+	if err = json.Unmarshal(result.Body(), &resp); err != nil {
+		return nil, err
+	}
+	signed := make(map[string]SignedUrl, len(resp.Payload))
+	for _, su := range resp.Payload {
+		signed[su.Key] = su
+	}
+	return signed, nil
+}
@@ -0,0 +1,124 @@
+package media
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/apis"
+	"github.com/Mobility-Development-Team/be-common-mdl/model"
+	"github.com/Mobility-Development-Team/be-common-mdl/util/cacheutil"
+	"github.com/spf13/viper"
+)
+
+func TestUrlSigner(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var keyCalls, signCalls int
+	var signedKeys []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Urls      []string `json:"urls"`
+			Keys      []string `json:"keys"`
+			ExpiresIn int64    `json:"expiresIn"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		switch r.URL.Path {
+		case "/file/upload/worker-mgt/file/k":
+			keyCalls++
+			keys := map[string]string{}
+			for _, url := range body.Urls {
+				if !strings.Contains(url, "missing") {
+					keys[url] = "key-" + url[strings.LastIndex(url, "/")+1:]
+				}
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"payload": keys})
+		case "/file/sign":
+			if strings.Contains(strings.Join(body.Keys, ","), "unsignable") {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			signCalls++
+			signedKeys = append(signedKeys, body.Keys...)
+			var payload []SignedUrl
+			for _, key := range body.Keys {
+				payload = append(payload, SignedUrl{
+					Url:       "https://signed/" + key,
+					Key:       key,
+					ExpiresAt: now.Add(time.Duration(body.ExpiresIn) * time.Second),
+				})
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"payload": payload})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	v := viper.New()
+	v.Set(apiMediaMdlUrlBase, srv.URL)
+	v.Set(signedUrlEnabledConfig, true)
+	apis.Init(v)
+
+	s := NewUrlSigner()
+	s.TTL = 10 * time.Minute
+	s.now = func() time.Time { return now }
+
+	media, err := s.SignMedia("tk", []model.MediaParam{{FirebaseUrl: "https://files/a.jpg", FirebaseUrlThumbnail: "https://files/a_thumbnail.jpg"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if media[0].FirebaseUrl != "https://signed/key-a.jpg" || media[0].FirebaseUrlThumbnail != "https://signed/key-a_thumbnail.jpg" {
+		t.Errorf("SignMedia() = %+v", media[0])
+	}
+
+	// Cached until shortly before expiry
+	now = now.Add(5 * time.Minute)
+	if url, err := s.SignOne("tk", "https://files/a.jpg"); err != nil || url != "https://signed/key-a.jpg" || signCalls != 1 {
+		t.Errorf("SignOne() = %s, %v, sign called %d times", url, err, signCalls)
+	}
+	now = now.Add(4 * time.Minute)
+	if _, err := s.Sign("tk", "https://files/a.jpg", "https://files/b.pdf", ""); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(signedKeys[2:])
+	if signCalls != 2 || keyCalls != 2 || strings.Join(signedKeys[2:], ",") != "key-a.jpg,key-b.pdf" {
+		t.Errorf("sign called %d times, keys called %d times, signed %v", signCalls, keyCalls, signedKeys)
+	}
+
+	if _, err := s.Sign("tk", "https://files/missing.jpg"); err == nil {
+		t.Error("Sign() expected error for a url without file key")
+	}
+
+	// Not shared with another caller
+	if _, err := s.Sign("tk2", "https://files/a.jpg"); err != nil || signCalls != 3 || keyCalls != 4 {
+		t.Errorf("Sign() error = %v, sign called %d times, keys called %d times", err, signCalls, keyCalls)
+	}
+	s.Invalidate("https://files/a.jpg")
+	if _, err := s.Sign("tk", "https://files/a.jpg"); err != nil || signCalls != 4 || keyCalls != 5 {
+		t.Errorf("Sign() after Invalidate() error = %v, sign called %d times, keys called %d times", err, signCalls, keyCalls)
+	}
+	// The file key of a url failed to be signed is cached until it is evicted as well
+	if _, err := s.Sign("tk", "https://files/unsignable.jpg"); err == nil || s.entries[signerKey{cacheutil.CallerKey("tk"), "https://files/unsignable.jpg"}] == nil {
+		t.Errorf("Sign() error = %v, want an error and the file key cached", err)
+	}
+	// Expired entries are evicted, the file key of an expired url is still reused
+	now = now.Add(time.Hour)
+	if _, err := s.Sign("tk", "https://files/b.pdf"); err != nil || keyCalls != 6 || len(s.entries) != 1 {
+		t.Errorf("Sign() error = %v, keys called %d times, %d entries cached", err, keyCalls, len(s.entries))
+	}
+
+	v.Set(signedUrlEnabledConfig, false)
+	if signed, err := s.Sign("tk", "https://files/c.jpg"); err != nil || signed["https://files/c.jpg"].Url != "https://files/c.jpg" || keyCalls != 6 {
+		t.Errorf("Sign() when disabled = %v, %v, keys called %d times", signed, err, keyCalls)
+	}
+	v.Set(signedUrlEnabledConfig, true)
+
+	short := NewUrlSigner()
+	short.TTL = time.Minute
+	if _, err := short.Sign("tk", "https://files/a.jpg"); err == nil {
+		t.Error("Sign() expected error for a ttl shorter than the refresh time")
+	}
+}
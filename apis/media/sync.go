@@ -0,0 +1,407 @@
+package media
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/model"
+	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+	"github.com/Mobility-Development-Team/be-common-mdl/util/arrutil"
+	logger "github.com/sirupsen/logrus"
+)
+
+// Actions of SyncItem, as performed by CloneMediaToBatch
+const (
+	SyncActionAdd    = "ADD"
+	SyncActionUpdate = "UPDATE"
+	SyncActionDelete = "DELETE"
+)
+
+// Statuses of SyncItemResult
+const (
+	SyncStatusPlanned = "PLANNED" // Dry run
+	SyncStatusApplied = "APPLIED"
+	SyncStatusSkipped = "SKIPPED" // Disabled by CloneOpts
+	SyncStatusFailed  = "FAILED"
+)
+
+var (
+	// ErrSyncWipesBatch is returned by ExecuteSyncPlan if the plan deletes all media in scope
+	// without adding or updating any, set SyncOptions.AllowWipe if it is intended.
+	ErrSyncWipesBatch = errors.New("sync plan deletes all media of the batch in scope")
+	// ErrSyncPlanStale is returned by ExecuteSyncPlan if the batch has changed since the plan was made
+	ErrSyncPlanStale = errors.New("media batch has changed since the sync plan was made")
+)
+
+// Fields of MediaParam not compared for SyncItem.Changes
+var syncIgnoredFields = []string{"id", "batchId", "createdAt", "createdBy", "updatedAt", "updatedBy"}
+
+type (
+	SyncOptions struct {
+		CloneOpts
+		// Only plan without calling CloneMediaToBatch
+		DryRun bool
+		// Allow a plan deleting all media in scope, see ErrSyncWipesBatch
+		AllowWipe bool
+	}
+	// SyncItem is a change CloneMediaToBatch is expected to make to the batch
+	SyncItem struct {
+		Action string
+		// The media given to the clone for ADD and UPDATE, the existing media for DELETE
+		Media model.MediaParam
+		// The media currently in the batch for UPDATE and DELETE
+		Existing *model.MediaParam
+		// JSON fields changed by an UPDATE
+		Changes []string
+		// The action is disabled by CloneOpts
+		Skipped bool
+	}
+	// SyncPlan is the reviewable result of PlanMediaSync
+	SyncPlan struct {
+		BatchId string
+		Scope   Scope
+		Opts    CloneOpts
+		Media   []model.MediaParam
+		Items   []SyncItem
+		// Media in the batch but outside the scope, left untouched
+		Untouched []model.MediaParam
+		// Ids of the media in the batch when the plan was made
+		existingIds []intstring.IntString
+	}
+	SyncItemResult struct {
+		SyncItem
+		Status string
+		Err    error
+	}
+	SyncResult struct {
+		Plan   *SyncPlan
+		DryRun bool
+		Items  []SyncItemResult
+	}
+)
+
+// PlanMediaSync computes the changes CloneMediaToBatch would make to batchId with the given
+// media, scope and opts, without changing anything.
+func PlanMediaSync(tk string, batchId string, media []model.MediaParam, scope Scope, opts CloneOpts) (*SyncPlan, error) {
+	batches, err := GetMediaBatches(tk, batchId)
+	if err != nil {
+		return nil, err
+	}
+	return planMediaSync(batchId, batches[batchId], media, scope, opts), nil
+}
+
+// SyncMediaBatch plans and, unless opts.DryRun is set, executes the sync of batchId
+func SyncMediaBatch(tk string, batchId string, media []model.MediaParam, scope Scope, opts SyncOptions) (*SyncResult, error) {
+	plan, err := PlanMediaSync(tk, batchId, media, scope, opts.CloneOpts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.DryRun {
+		return plan.dryRun(), nil
+	}
+	return ExecuteSyncPlan(tk, plan, opts)
+}
+
+// ExecuteSyncPlan performs plan with CloneMediaToBatch, then fetches the batch again to check
+// the result of each item. opts.CloneOpts is ignored, the options of the plan are used.
+func ExecuteSyncPlan(tk string, plan *SyncPlan, opts SyncOptions) (*SyncResult, error) {
+	if opts.DryRun {
+		return plan.dryRun(), nil
+	}
+	if plan.WipesBatch() && !opts.AllowWipe {
+		return nil, ErrSyncWipesBatch
+	}
+	batches, err := GetMediaBatches(tk, plan.BatchId)
+	if err != nil {
+		return nil, err
+	}
+	if !sameIds(plan.existingIds, mediaIds(batches[plan.BatchId])) {
+		return nil, ErrSyncPlanStale
+	}
+	cloneErr := CloneMediaToBatch(tk, plan.BatchId, plan.Media, plan.Scope, plan.Opts)
+	var after []model.MediaParam
+	if cloneErr == nil {
+		if batches, err = GetMediaBatches(tk, plan.BatchId); err != nil {
+			logger.Errorf("[ExecuteSyncPlan] Unable to verify batch %s: %v", plan.BatchId, err)
+			cloneErr = fmt.Errorf("unable to verify the batch: %w", err)
+		}
+		after = batches[plan.BatchId]
+	}
+	return plan.result(after, cloneErr), cloneErr
+}
+
+// Adds returns the items adding media to the batch, including skipped ones
+func (p SyncPlan) Adds() []SyncItem {
+	return p.itemsOf(SyncActionAdd)
+}
+
+func (p SyncPlan) Updates() []SyncItem {
+	return p.itemsOf(SyncActionUpdate)
+}
+
+func (p SyncPlan) Deletes() []SyncItem {
+	return p.itemsOf(SyncActionDelete)
+}
+
+// IsEmpty returns true if the plan changes nothing
+func (p SyncPlan) IsEmpty() bool {
+	for _, item := range p.Items {
+		if !item.Skipped && (item.Action != SyncActionUpdate || len(item.Changes) > 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// WipesBatch returns true if the plan deletes media without keeping or adding any in scope
+func (p SyncPlan) WipesBatch() bool {
+	deletes := 0
+	for _, item := range p.Items {
+		if item.Skipped {
+			continue
+		}
+		if item.Action != SyncActionDelete {
+			return false
+		}
+		deletes++
+	}
+	return deletes > 0
+}
+
+func (p SyncPlan) String() string {
+	count := func(items []SyncItem) (n, skipped int) {
+		for _, item := range items {
+			if item.Skipped {
+				skipped++
+			} else {
+				n++
+			}
+		}
+		return n, skipped
+	}
+	adds, addsSkipped := count(p.Adds())
+	updates, updatesSkipped := count(p.Updates())
+	deletes, deletesSkipped := count(p.Deletes())
+	return fmt.Sprintf("batch %s: %d add, %d update, %d delete (skipped %d/%d/%d), %d untouched",
+		p.BatchId, adds, updates, deletes, addsSkipped, updatesSkipped, deletesSkipped, len(p.Untouched))
+}
+
+// Failed returns the items failed to be applied
+func (r SyncResult) Failed() []SyncItemResult {
+	var result []SyncItemResult
+	for _, item := range r.Items {
+		if item.Status == SyncStatusFailed {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+func (p SyncPlan) itemsOf(action string) []SyncItem {
+	var result []SyncItem
+	for _, item := range p.Items {
+		if item.Action == action {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+func (p *SyncPlan) dryRun() *SyncResult {
+	result := &SyncResult{Plan: p, DryRun: true, Items: make([]SyncItemResult, len(p.Items))}
+	for i, item := range p.Items {
+		result.Items[i] = SyncItemResult{SyncItem: item, Status: SyncStatusPlanned}
+		if item.Skipped {
+			result.Items[i].Status = SyncStatusSkipped
+		}
+	}
+	return result
+}
+
+// result checks the items of the plan against the media in the batch after the clone
+func (p *SyncPlan) result(after []model.MediaParam, cloneErr error) *SyncResult {
+	result := &SyncResult{Plan: p, Items: make([]SyncItemResult, len(p.Items))}
+	afterById := make(map[intstring.IntString]model.MediaParam, len(after))
+	for _, m := range after {
+		afterById[m.Id] = m
+	}
+	existing := make(map[intstring.IntString]bool, len(p.existingIds))
+	for _, id := range p.existingIds {
+		existing[id] = true
+	}
+	// Added media have new ids, they are matched by their content
+	var added []model.MediaParam
+	for _, m := range after {
+		if !existing[m.Id] {
+			added = append(added, m)
+		}
+	}
+	for i, item := range p.Items {
+		r := SyncItemResult{SyncItem: item, Status: SyncStatusApplied}
+		switch {
+		case item.Skipped:
+			r.Status = SyncStatusSkipped
+		case cloneErr != nil:
+			r.Status, r.Err = SyncStatusFailed, cloneErr
+		case item.Action == SyncActionAdd:
+			found := false
+			for j, m := range added {
+				if sameMedia(m, item.Media) {
+					added = append(added[:j], added[j+1:]...)
+					found = true
+					break
+				}
+			}
+			if !found {
+				r.Status, r.Err = SyncStatusFailed, errors.New("media not found in the batch after clone")
+			}
+		case item.Action == SyncActionUpdate:
+			m, ok := afterById[item.Media.Id]
+			if !ok {
+				r.Status, r.Err = SyncStatusFailed, errors.New("media not found in the batch after clone")
+			} else if changes := mediaChanges(m, item.Media); len(changes) > 0 {
+				r.Status, r.Err = SyncStatusFailed, fmt.Errorf("fields not updated: %v", changes)
+			}
+		case item.Action == SyncActionDelete:
+			if _, ok := afterById[item.Media.Id]; ok {
+				r.Status, r.Err = SyncStatusFailed, errors.New("media still in the batch after clone")
+			}
+		}
+		result.Items[i] = r
+	}
+	return result
+}
+
+func planMediaSync(batchId string, existing []model.MediaParam, media []model.MediaParam, scope Scope, opts CloneOpts) *SyncPlan {
+	plan := &SyncPlan{
+		BatchId:     batchId,
+		Scope:       scope,
+		Opts:        opts,
+		Media:       media,
+		existingIds: mediaIds(existing),
+	}
+	inScope := map[intstring.IntString]*model.MediaParam{}
+	for i := range existing {
+		m := &existing[i]
+		if scope.Matches(*m) {
+			inScope[m.Id] = m
+		} else {
+			plan.Untouched = append(plan.Untouched, *m)
+		}
+	}
+	kept := map[intstring.IntString]bool{}
+	for _, m := range media {
+		if old, ok := inScope[m.Id]; ok && m.Id != 0 && !kept[m.Id] {
+			kept[m.Id] = true
+			plan.Items = append(plan.Items, SyncItem{
+				Action:   SyncActionUpdate,
+				Media:    m,
+				Existing: old,
+				Changes:  mediaChanges(*old, m),
+				Skipped:  opts.NoUpdate,
+			})
+			continue
+		}
+		// Outside the scope or the batch, the media is duplicated into the batch
+		plan.Items = append(plan.Items, SyncItem{Action: SyncActionAdd, Media: m, Skipped: opts.NoClone})
+	}
+	for _, m := range existing {
+		if old, ok := inScope[m.Id]; ok && !kept[m.Id] {
+			plan.Items = append(plan.Items, SyncItem{
+				Action:   SyncActionDelete,
+				Media:    *old,
+				Existing: old,
+				Skipped:  opts.NoTruncate,
+			})
+		}
+	}
+	return plan
+}
+
+// Matches returns true if m has all key-value pairs of the scope in its MediaRefInfo,
+// an empty scope matches all media.
+func (s Scope) Matches(m model.MediaParam) bool {
+	if len(s) == 0 {
+		return true
+	}
+	info := m.ShouldGetRefInfo()
+	for k, v := range s {
+		value, ok := info[k]
+		if !ok || value == nil || formatScopeValue(value) != v {
+			return false
+		}
+	}
+	return true
+}
+
+// mediaChanges returns the JSON fields of to different from from, comparing the struct fields
+func mediaChanges(from, to model.MediaParam) []string {
+	a, b := reflect.ValueOf(from), reflect.ValueOf(to)
+	var changes []string
+	for i := 0; i < a.NumField(); i++ {
+		name := strings.Split(a.Type().Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" || arrutil.ContainsStr(syncIgnoredFields, name) {
+			continue
+		}
+		if !sameFieldValue(a.Field(i).Interface(), b.Field(i).Interface()) {
+			changes = append(changes, name)
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+// sameFieldValue compares raw JSON fields by their decoded value, a missing value equals null
+func sameFieldValue(a, b interface{}) bool {
+	rawA, okA := a.(json.RawMessage)
+	rawB, okB := b.(json.RawMessage)
+	if !okA || !okB {
+		return reflect.DeepEqual(a, b)
+	}
+	var valueA, valueB interface{}
+	if len(rawA) > 0 && json.Unmarshal(rawA, &valueA) != nil {
+		return bytes.Equal(rawA, rawB)
+	}
+	if len(rawB) > 0 && json.Unmarshal(rawB, &valueB) != nil {
+		return false
+	}
+	return reflect.DeepEqual(valueA, valueB)
+}
+
+// sameMedia matches a cloned media with its source
+func sameMedia(cloned, source model.MediaParam) bool {
+	if source.FbRefId != "" {
+		return cloned.FbRefId == source.FbRefId
+	}
+	return cloned.FirebaseUrl == source.FirebaseUrl && cloned.LocalPath == source.LocalPath
+}
+
+func mediaIds(media []model.MediaParam) []intstring.IntString {
+	ids := make([]intstring.IntString, len(media))
+	for i, m := range media {
+		ids[i] = m.Id
+	}
+	return ids
+}
+
+func sameIds(a, b []intstring.IntString) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	count := map[intstring.IntString]int{}
+	for _, id := range a {
+		count[id]++
+	}
+	for _, id := range b {
+		count[id]--
+		if count[id] < 0 {
+			return false
+		}
+	}
+	return true
+}
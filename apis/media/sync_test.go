@@ -0,0 +1,248 @@
+package media
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/apis"
+	"github.com/Mobility-Development-Team/be-common-mdl/model"
+	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+	"github.com/spf13/viper"
+)
+
+func testSyncMedia(id intstring.IntString, fbRefId, taskActionType string) model.MediaParam {
+	m := model.MediaParam{Id: id, FbRefId: fbRefId, BatchId: "b1", Description: "photo " + fbRefId}
+	m.ShouldSetRefInfo("taskAction", TaskActionRefInfo{TaskActionId: 9, TaskActionType: taskActionType})
+	return m
+}
+
+func TestPlanMediaSync(t *testing.T) {
+	existing := []model.MediaParam{
+		testSyncMedia(1, "a", "REPLY"),
+		testSyncMedia(2, "b", "REPLY"),
+		testSyncMedia(3, "c", "ASSIGN"),
+	}
+	changed := testSyncMedia(1, "a", "REPLY")
+	changed.Description = "changed"
+	outOfScope := testSyncMedia(3, "c", "ASSIGN")
+	scope := Scope{}.AddTaskActionTypeRestriction("REPLY")
+
+	type action struct {
+		Action  string
+		Id      intstring.IntString
+		Skipped bool
+	}
+	tests := []struct {
+		name      string
+		media     []model.MediaParam
+		scope     Scope
+		opts      CloneOpts
+		want      []action
+		untouched int
+		changes   []string
+		wipes     bool
+	}{
+		{
+			name:      "Update, add and delete in scope",
+			media:     []model.MediaParam{changed, outOfScope, testSyncMedia(0, "d", "REPLY")},
+			scope:     scope,
+			want:      []action{{SyncActionUpdate, 1, false}, {SyncActionAdd, 3, false}, {SyncActionAdd, 0, false}, {SyncActionDelete, 2, false}},
+			untouched: 1,
+			changes:   []string{"description"},
+		},
+		{
+			name:      "No truncate",
+			media:     []model.MediaParam{changed},
+			scope:     scope,
+			opts:      CloneOpts{NoTruncate: true, NoUpdate: true},
+			want:      []action{{SyncActionUpdate, 1, true}, {SyncActionDelete, 2, true}},
+			untouched: 1,
+			changes:   []string{"description"},
+		},
+		{
+			name:  "Wipe without scope",
+			scope: nil,
+			want:  []action{{SyncActionDelete, 1, false}, {SyncActionDelete, 2, false}, {SyncActionDelete, 3, false}},
+			wipes: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := planMediaSync("b1", existing, tt.media, tt.scope, tt.opts)
+			var got []action
+			for _, item := range plan.Items {
+				got = append(got, action{item.Action, item.Media.Id, item.Skipped})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Items = %v, want %v", got, tt.want)
+			}
+			if len(plan.Untouched) != tt.untouched {
+				t.Errorf("Untouched = %d, want %d", len(plan.Untouched), tt.untouched)
+			}
+			if updates := plan.Updates(); len(updates) > 0 && !reflect.DeepEqual(updates[0].Changes, tt.changes) {
+				t.Errorf("Changes = %v, want %v", updates[0].Changes, tt.changes)
+			}
+			if plan.WipesBatch() != tt.wipes {
+				t.Errorf("WipesBatch() = %v, want %v", plan.WipesBatch(), tt.wipes)
+			}
+		})
+	}
+}
+
+func TestScopeMatchesLargeIds(t *testing.T) {
+	m := model.MediaParam{}
+	m.ShouldSetRefInfo("siteWalk", map[string]interface{}{"siteWalkId": 1234567})
+	tests := []struct {
+		name  string
+		scope Scope
+		want  bool
+	}{
+		{name: "Restrict", scope: Scope{}.Restrict(RefKeySiteWalkId, 1234567), want: true},
+		{name: "Restrict with decoded number", scope: Scope{}.Restrict(RefKeySiteWalkId, float64(1234567)), want: true},
+		{name: "NewScope", scope: NewScope(map[string]interface{}{"siteWalkId": 1234567}), want: true},
+		{name: "AddRestriction", scope: Scope{}.AddRestriction("siteWalkId", "1234567"), want: true},
+		{name: "Other id", scope: Scope{}.Restrict(RefKeySiteWalkId, 1234568)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.scope.Matches(m); got != tt.want {
+				t.Errorf("Matches() = %v with scope %v, want %v", got, tt.scope, tt.want)
+			}
+		})
+	}
+}
+
+func TestMediaChanges(t *testing.T) {
+	var fromId model.MediaParam
+	if err := json.Unmarshal([]byte(`"1"`), &fromId); err != nil {
+		t.Fatal(err)
+	}
+	reordered := testSyncMedia(1, "a", "REPLY")
+	reordered.MediaRefInfo = json.RawMessage(`{"taskActionType": "REPLY", "taskActionId": "9"}`)
+	tests := []struct {
+		name     string
+		from, to model.MediaParam
+		want     []string
+	}{
+		{name: "Unchanged", from: testSyncMedia(1, "a", "REPLY"), to: testSyncMedia(1, "a", "REPLY")},
+		{name: "Ignored fields", from: testSyncMedia(1, "a", "REPLY"), to: testSyncMedia(2, "a", "REPLY")},
+		{name: "Ref info reordered", from: testSyncMedia(1, "a", "REPLY"), to: reordered},
+		{
+			name: "Decoded from an id string",
+			from: testSyncMedia(1, "a", "REPLY"),
+			to:   fromId,
+			want: []string{"description", "fbRefId", "mediaRefInfo", "mediaRefType"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mediaChanges(tt.from, tt.to); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mediaChanges() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// testCloneServer serves GetMediaBatches and CloneMediaToBatch with the given batch
+func testCloneServer(t *testing.T, batch *[]model.MediaParam, clone func(req cloneRequest) int) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/media/batch/many":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"payload": map[string][]model.MediaParam{"b1": *batch}})
+		case "/media/batch/clone":
+			var req cloneRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Error(err)
+			}
+			for _, m := range req.Media {
+				if m.DecodedForm != model.MediaRefFormObject {
+					t.Errorf("media %s sent as %s, want an object", m.Id, m.DecodedForm)
+				}
+			}
+			w.WriteHeader(clone(req))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	v := viper.New()
+	v.Set(apiMediaMdlUrlBase, srv.URL)
+	apis.Init(v)
+}
+
+type cloneRequest struct {
+	BatchId string             `json:"batchId"`
+	Media   []model.MediaParam `json:"media"`
+	Scope   Scope              `json:"scope"`
+}
+
+func TestExecuteSyncPlan(t *testing.T) {
+	batch := []model.MediaParam{testSyncMedia(1, "a", "REPLY"), testSyncMedia(2, "b", "REPLY")}
+	cloned := 0
+	testCloneServer(t, &batch, func(req cloneRequest) int {
+		cloned++
+		// Applies the updates and adds, but fails to delete media 2
+		next := []model.MediaParam{batch[1]}
+		for _, m := range req.Media {
+			if m.Id == 0 {
+				m.Id = 100
+			}
+			next = append(next, m)
+		}
+		batch = next
+		return http.StatusOK
+	})
+	changed := testSyncMedia(1, "a", "REPLY")
+	changed.Description = "changed"
+	media := []model.MediaParam{changed, testSyncMedia(0, "d", "REPLY")}
+
+	dry, err := SyncMediaBatch("tk", "b1", media, nil, SyncOptions{DryRun: true})
+	if err != nil || cloned != 0 || !dry.DryRun || len(dry.Items) != 3 || dry.Items[0].Status != SyncStatusPlanned {
+		t.Fatalf("dry run = %+v, %v, cloned %d times", dry, err, cloned)
+	}
+
+	wipe, _ := PlanMediaSync("tk", "b1", nil, nil, CloneOpts{})
+	if _, err := ExecuteSyncPlan("tk", wipe, SyncOptions{}); !errors.Is(err, ErrSyncWipesBatch) {
+		t.Errorf("ExecuteSyncPlan() error = %v, want %v", err, ErrSyncWipesBatch)
+	}
+
+	result, err := ExecuteSyncPlan("tk", dry.Plan, SyncOptions{})
+	if err != nil || cloned != 1 {
+		t.Fatalf("ExecuteSyncPlan() error = %v, cloned %d times", err, cloned)
+	}
+	statuses := map[string]string{}
+	for _, item := range result.Items {
+		statuses[item.Action] = item.Status
+	}
+	want := map[string]string{SyncActionUpdate: SyncStatusApplied, SyncActionAdd: SyncStatusApplied, SyncActionDelete: SyncStatusFailed}
+	if !reflect.DeepEqual(statuses, want) || len(result.Failed()) != 1 {
+		t.Errorf("statuses = %v, want %v", statuses, want)
+	}
+
+	if _, err := ExecuteSyncPlan("tk", dry.Plan, SyncOptions{}); !errors.Is(err, ErrSyncPlanStale) {
+		t.Errorf("ExecuteSyncPlan() error = %v, want %v", err, ErrSyncPlanStale)
+	}
+}
+
+func TestCloneMediaToBatchSendsObjects(t *testing.T) {
+	var batch []model.MediaParam
+	var received []model.MediaParam
+	testCloneServer(t, &batch, func(req cloneRequest) int {
+		received = req.Media
+		return http.StatusOK
+	})
+	var media []model.MediaParam
+	if err := json.Unmarshal([]byte(`["12", 13]`), &media); err != nil {
+		t.Fatal(err)
+	}
+	if err := CloneMediaToBatch("tk", "b1", media, Scope{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 2 || received[0].Id != 12 || received[1].Id != 13 {
+		t.Errorf("received %+v", received)
+	}
+}
@@ -0,0 +1,370 @@
+package media
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/apis"
+	"github.com/Mobility-Development-Team/be-common-mdl/common"
+	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+	"github.com/go-resty/resty/v2"
+	logger "github.com/sirupsen/logrus"
+)
+
+// The chunked upload endpoints and the checksum header are not confirmed by the media module yet.
+// Chunked uploads are only used if enabled with `apis.internal.media.upload.chunked.enabled`,
+// otherwise the file is uploaded in one request like UploadFile. The checksum header is only read
+// if enabled with `apis.internal.media.upload.checksumHeader.enabled`.
+const (
+	chunkedEnabledConfig        = "apis.internal.media.upload.chunked.enabled"
+	checksumHeaderEnabledConfig = "apis.internal.media.upload.checksumHeader.enabled"
+
+	uploadChunkInit     = "%s/file/upload/chunk/%s"
+	uploadChunkSession  = "%s/file/upload/chunk/session/%s"
+	uploadChunkComplete = "%s/file/upload/chunk/session/%s/complete"
+
+	// Sent as the last form field of a multipart upload and with the completion of a chunked upload
+	checksumFieldName = "sha256"
+	// Header returning the checksum of the received file if the payload is a plain url, if enabled
+	checksumHeaderName = "X-Checksum-Sha256"
+
+	defaultChunkSize    = 8 << 20
+	defaultChunkRetries = 3
+)
+
+var (
+	// ErrChecksumMismatch is returned if the media module received a file different from the one sent
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// ErrChecksumMissing is returned if UploadOptions.RequireChecksum is set but the media module returned no checksum
+	ErrChecksumMissing = errors.New("media module returned no checksum")
+)
+
+type (
+	UploadOptions struct {
+		FileName    string
+		ContentType string // Defaults to application/octet-stream
+		// Total size of the file if known, only used for Progress
+		Size int64
+		// Called after each write with the number of bytes sent so far and Size
+		Progress func(sent, total int64)
+		// Additional form fields, e.g. contractId, set by the upload functions
+		FormData map[string]string
+		// Fails with ErrChecksumMissing if the media module does not return the checksum of the
+		// received file, otherwise the checksum is only verified if returned
+		RequireChecksum bool
+	}
+	ChunkedUploadOptions struct {
+		UploadOptions
+		// Defaults to 8MiB
+		ChunkSize int64
+		// Each chunk is retried this many times, defaults to 3
+		ChunkRetries int
+		// Set to the id of an interrupted upload to resume it, see OnSession
+		UploadId string
+		// Called with the id of the upload once it is created, the caller can keep it to resume
+		// the upload after a failure
+		OnSession func(uploadId string)
+	}
+	UploadResult struct {
+		Url    string `json:"url"`
+		Sha256 string `json:"sha256"`
+		Size   int64  `json:"size"`
+		// True if the checksum returned by the media module matched
+		Verified bool `json:"-"`
+	}
+)
+
+// UploadFileStream is UploadFile streaming the file from r instead of holding it in memory
+func UploadFileStream(tk string, r io.Reader, reportType string, contractId intstring.IntString, opts UploadOptions) (*UploadResult, error) {
+	opts.FormData = withFormData(opts.FormData, "contractId", contractId.String())
+	return uploadMultipart(tk, fmt.Sprintf(uploadFileUrlBase, apis.V().GetString(apiMediaMdlUrlBase), reportType), r, opts)
+}
+
+// UploadReportStream is UploadReport streaming the report from r
+func UploadReportStream(tk string, r io.Reader, reportType string, contractId intstring.IntString, publish bool, opts UploadOptions) (*UploadResult, error) {
+	folder := previewFolderName
+	if publish {
+		folder = publishedFolderName
+	}
+	// The filename specified here would only be used when it is in preview mode (publish == false)
+	opts.FileName = fmt.Sprintf("preview-file-%s.pdf", opts.FileName)
+	opts.FormData = withFormData(opts.FormData, "contractId", contractId.String())
+	return uploadMultipart(tk, fmt.Sprintf(uploadUrlBase, apis.V().GetString(apiMediaMdlUrlBase), reportType, folder), r, opts)
+}
+
+// UploadSitePlanPictureStream is UploadSitePlanPicture streaming the picture from r
+func UploadSitePlanPictureStream(tk string, r io.Reader, opts UploadOptions) (*UploadResult, error) {
+	return uploadMultipart(tk, fmt.Sprintf(uploadSitePlanPicture, apis.V().GetString(apiMediaMdlUrlBase)), r, opts)
+}
+
+// uploadMultipart posts r as the "file" field of a multipart form without buffering it.
+// The SHA-256 of r is sent as the last field.
+func uploadMultipart(tk, url string, r io.Reader, opts UploadOptions) (*UploadResult, error) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	h := sha256.New()
+	go func() {
+		pw.CloseWithError(writeMultipart(mw, r, h, opts))
+	}()
+	client := common.NewResty()
+	result, err := client.R().SetAuthToken(tk).
+		SetHeader("Content-Type", mw.FormDataContentType()).
+		SetBody(pr).
+		Post(url)
+	// Unblocks the writer if the request failed before reading the whole body
+	pr.Close()
+	if err != nil {
+		return nil, err
+	}
+	if !result.IsSuccess() {
+		return nil, fmt.Errorf("media module returned status code: %d", result.StatusCode())
+	}
+	return verifyUpload(result.Body(), result.Header(), hex.EncodeToString(h.Sum(nil)), opts.RequireChecksum)
+}
+
+func writeMultipart(mw *multipart.Writer, r io.Reader, h hash.Hash, opts UploadOptions) error {
+	for k, v := range opts.FormData {
+		if err := mw.WriteField(k, v); err != nil {
+			return err
+		}
+	}
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, escapeQuotes(opts.FileName)))
+	header.Set("Content-Type", contentTypeOrDefault(opts.ContentType))
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	w := &progressWriter{w: io.MultiWriter(part, h), total: opts.Size, progress: opts.Progress}
+	if _, err := io.Copy(w, r); err != nil {
+		return err
+	}
+	if err := mw.WriteField(checksumFieldName, hex.EncodeToString(h.Sum(nil))); err != nil {
+		return err
+	}
+	return mw.Close()
+}
+
+// UploadFileChunked uploads a large file in chunks of ChunkSize, each chunk is retried on failure.
+//
+// If the upload is interrupted, it can be resumed by calling UploadFileChunked again with the
+// UploadId given to OnSession, only the chunks not yet received by the media module are sent.
+// r is read from its start, the received part is read again to calculate the checksum.
+//
+// Unless chunked uploads are enabled in config, the whole file is uploaded with UploadFileStream
+// instead, and the chunk and session options are ignored.
+func UploadFileChunked(tk string, r io.ReadSeeker, reportType string, contractId intstring.IntString, opts ChunkedUploadOptions) (*UploadResult, error) {
+	if !apis.V().GetBool(chunkedEnabledConfig) {
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return UploadFileStream(tk, r, reportType, contractId, opts.UploadOptions)
+	}
+	base := apis.V().GetString(apiMediaMdlUrlBase)
+	chunkSize, retries := opts.ChunkSize, opts.ChunkRetries
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+	if retries <= 0 {
+		retries = defaultChunkRetries
+	}
+	client := common.NewResty()
+	var session struct {
+		Payload struct {
+			UploadId string `json:"uploadId"`
+			Received int64  `json:"received"`
+		} `json:"payload"`
+	}
+	var (
+		result *uploadResponse
+		err    error
+	)
+	if opts.UploadId == "" {
+		req := client.R().SetAuthToken(tk).SetBody(map[string]interface{}{
+			"fileName":    opts.FileName,
+			"contentType": contentTypeOrDefault(opts.ContentType),
+			"size":        opts.Size,
+			"contractId":  contractId,
+			"formData":    opts.FormData,
+		})
+		result, err = doUploadRequest(req, http.MethodPost, fmt.Sprintf(uploadChunkInit, base, reportType))
+	} else {
+		result, err = doUploadRequest(client.R().SetAuthToken(tk), http.MethodGet, fmt.Sprintf(uploadChunkSession, base, opts.UploadId))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to start chunked upload: %w", err)
+	}
+	if err := json.Unmarshal(result.body, &session); err != nil {
+		return nil, err
+	}
+	uploadId, offset := session.Payload.UploadId, session.Payload.Received
+	if uploadId == "" {
+		uploadId = opts.UploadId
+	}
+	if uploadId == "" {
+		return nil, errors.New("media module returned no upload id")
+	}
+	if opts.OnSession != nil {
+		opts.OnSession(uploadId)
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	// The received part is hashed but not sent again
+	if offset > 0 {
+		if _, err := io.CopyN(h, r, offset); err != nil {
+			return nil, fmt.Errorf("unable to resume upload %s at %d: %w", uploadId, offset, err)
+		}
+		if opts.Progress != nil {
+			opts.Progress(offset, opts.Size)
+		}
+	}
+	buf := make([]byte, chunkSize)
+	for {
+		n, readErr := io.ReadFull(r, buf)
+		if n > 0 {
+			chunk := buf[:n]
+			h.Write(chunk)
+			if err := uploadChunk(tk, base, uploadId, offset, chunk, retries); err != nil {
+				return nil, err
+			}
+			offset += int64(n)
+			if opts.Progress != nil {
+				opts.Progress(offset, opts.Size)
+			}
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+	}
+
+	checksum := hex.EncodeToString(h.Sum(nil))
+	req := client.R().SetAuthToken(tk).SetBody(map[string]interface{}{
+		checksumFieldName: checksum,
+		"size":            offset,
+	})
+	if result, err = doUploadRequest(req, http.MethodPost, fmt.Sprintf(uploadChunkComplete, base, uploadId)); err != nil {
+		return nil, fmt.Errorf("unable to complete upload %s: %w", uploadId, err)
+	}
+	return verifyUpload(result.body, result.header, checksum, opts.RequireChecksum)
+}
+
+func uploadChunk(tk, base, uploadId string, offset int64, chunk []byte, retries int) error {
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			logger.Warnf("[UploadFileChunked] Retrying chunk at %d of upload %s (attempt %d): %v", offset, uploadId, attempt, err)
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+		req := common.NewResty().R().SetAuthToken(tk).
+			SetHeader("Content-Type", "application/octet-stream").
+			SetHeader("Content-Range", fmt.Sprintf("bytes %d-%d/*", offset, offset+int64(len(chunk))-1)).
+			SetBody(chunk)
+		if _, err = doUploadRequest(req, http.MethodPut, fmt.Sprintf(uploadChunkSession, base, uploadId)); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("unable to upload chunk at %d of upload %s: %w", offset, uploadId, err)
+}
+
+// verifyUpload parses the response of an upload, the payload is either the url of the
+// file or an object with its url, checksum and size.
+func verifyUpload(body []byte, header http.Header, checksum string, requireChecksum bool) (*UploadResult, error) {
+	var resp struct {
+		Payload json.RawMessage `json:"payload"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	result := &UploadResult{}
+	if err := json.Unmarshal(resp.Payload, &result.Url); err != nil {
+		if err := json.Unmarshal(resp.Payload, result); err != nil {
+			return nil, fmt.Errorf("unexpected upload response: %w", err)
+		}
+	}
+	if result.Sha256 == "" && apis.V().GetBool(checksumHeaderEnabledConfig) {
+		result.Sha256 = header.Get(checksumHeaderName)
+	}
+	if result.Sha256 == "" {
+		if requireChecksum {
+			return nil, ErrChecksumMissing
+		}
+		logger.Debug("[verifyUpload] Media module returned no checksum, upload not verified: ", result.Url)
+		result.Sha256 = checksum
+		return result, nil
+	}
+	if !strings.EqualFold(result.Sha256, checksum) {
+		return nil, fmt.Errorf("%w: sent %s, media module received %s", ErrChecksumMismatch, checksum, result.Sha256)
+	}
+	result.Verified = true
+	return result, nil
+}
+
+type uploadResponse struct {
+	body   []byte
+	header http.Header
+}
+
+func doUploadRequest(req *resty.Request, method, url string) (*uploadResponse, error) {
+	result, err := req.Execute(method, url)
+	if err != nil {
+		return nil, err
+	}
+	if !result.IsSuccess() {
+		return nil, fmt.Errorf("media module returned status code: %d", result.StatusCode())
+	}
+	return &uploadResponse{body: result.Body(), header: result.Header()}, nil
+}
+
+func withFormData(formData map[string]string, key, value string) map[string]string {
+	result := make(map[string]string, len(formData)+1)
+	for k, v := range formData {
+		result[k] = v
+	}
+	result[key] = value
+	return result
+}
+
+func contentTypeOrDefault(contentType string) string {
+	if contentType == "" {
+		return "application/octet-stream"
+	}
+	return contentType
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
+
+type progressWriter struct {
+	w        io.Writer
+	sent     int64
+	total    int64
+	progress func(sent, total int64)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.sent += int64(n)
+	if p.progress != nil && n > 0 {
+		p.progress(p.sent, p.total)
+	}
+	return n, err
+}
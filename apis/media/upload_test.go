@@ -0,0 +1,254 @@
+package media
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/apis"
+	"github.com/spf13/viper"
+)
+
+func TestUploadFileStream(t *testing.T) {
+	content := bytes.Repeat([]byte("permit attachment "), 10000)
+	sum := sha256.Sum256(content)
+	checksum := hex.EncodeToString(sum[:])
+	tests := []struct {
+		name     string
+		respond  func(w http.ResponseWriter, received string)
+		require  bool
+		header   bool
+		wantErr  error
+		verified bool
+	}{
+		{
+			name: "Checksum in payload",
+			respond: func(w http.ResponseWriter, received string) {
+				fmt.Fprintf(w, `{"payload":{"url":"https://files/a.pdf","sha256":"%s"}}`, received)
+			},
+			verified: true,
+		},
+		{
+			name: "Checksum in header",
+			respond: func(w http.ResponseWriter, received string) {
+				w.Header().Set(checksumHeaderName, received)
+				w.Write([]byte(`{"payload":"https://files/a.pdf"}`))
+			},
+			header:   true,
+			verified: true,
+		},
+		{
+			name: "Checksum in header not enabled",
+			respond: func(w http.ResponseWriter, received string) {
+				w.Header().Set(checksumHeaderName, received)
+				w.Write([]byte(`{"payload":"https://files/a.pdf"}`))
+			},
+		},
+		{
+			name: "Mismatch",
+			respond: func(w http.ResponseWriter, received string) {
+				w.Write([]byte(`{"payload":{"url":"https://files/a.pdf","sha256":"0000"}}`))
+			},
+			wantErr: ErrChecksumMismatch,
+		},
+		{
+			name: "Missing but not required",
+			respond: func(w http.ResponseWriter, received string) {
+				w.Write([]byte(`{"payload":"https://files/a.pdf"}`))
+			},
+		},
+		{
+			name: "Missing and required",
+			respond: func(w http.ResponseWriter, received string) {
+				w.Write([]byte(`{"payload":"https://files/a.pdf"}`))
+			},
+			require: true,
+			wantErr: ErrChecksumMissing,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				f, _, err := r.FormFile("file")
+				if err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				h := sha256.New()
+				io.Copy(h, f)
+				received := hex.EncodeToString(h.Sum(nil))
+				if r.FormValue("contractId") != "38" || r.FormValue(checksumFieldName) != received {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				tt.respond(w, received)
+			}))
+			defer srv.Close()
+			v := viper.New()
+			v.Set(apiMediaMdlUrlBase, srv.URL)
+			v.Set(checksumHeaderEnabledConfig, tt.header)
+			apis.Init(v)
+
+			var lastSent int64
+			result, err := UploadFileStream("tk", bytes.NewReader(content), "permit", 38, UploadOptions{
+				FileName:        "a.pdf",
+				Size:            int64(len(content)),
+				Progress:        func(sent, total int64) { lastSent = sent },
+				RequireChecksum: tt.require,
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UploadFileStream() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if result.Url != "https://files/a.pdf" || result.Sha256 != checksum || result.Verified != tt.verified {
+				t.Errorf("UploadFileStream() = %+v", result)
+			}
+			if lastSent != int64(len(content)) {
+				t.Errorf("progress reported %d bytes, want %d", lastSent, len(content))
+			}
+		})
+	}
+}
+
+func TestUploadFileChunked(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 100)
+	var (
+		mu       sync.Mutex
+		received []byte
+		failOnce = true
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/file/upload/chunk/permit":
+			w.Write([]byte(`{"payload":{"uploadId":"u1","received":0}}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/file/upload/chunk/session/u1":
+			fmt.Fprintf(w, `{"payload":{"uploadId":"u1","received":%d}}`, len(received))
+		case r.Method == http.MethodPut && r.URL.Path == "/file/upload/chunk/session/u1":
+			var start, end int
+			fmt.Sscanf(r.Header.Get("Content-Range"), "bytes %d-%d/*", &start, &end)
+			if start != len(received) {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			if start == 300 && failOnce {
+				failOnce = false
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			b, _ := io.ReadAll(r.Body)
+			received = append(received, b...)
+		case r.Method == http.MethodPost && r.URL.Path == "/file/upload/chunk/session/u1/complete":
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			sum := sha256.Sum256(received)
+			fmt.Fprintf(w, `{"payload":{"url":"https://files/big.pdf","sha256":"%s","size":%d}}`, hex.EncodeToString(sum[:]), len(received))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	v := viper.New()
+	v.Set(apiMediaMdlUrlBase, srv.URL)
+	v.Set(chunkedEnabledConfig, true)
+	apis.Init(v)
+
+	var uploadId string
+	opts := ChunkedUploadOptions{
+		UploadOptions: UploadOptions{FileName: "big.pdf", Size: int64(len(content))},
+		ChunkSize:     100,
+		ChunkRetries:  1,
+		OnSession:     func(id string) { uploadId = id },
+	}
+	// The source fails after the 3rd chunk
+	r := &failingReader{r: bytes.NewReader(content), failAt: 300}
+	if _, err := UploadFileChunked("tk", r, "permit", 38, opts); err == nil {
+		t.Fatal("expected interrupted upload to fail")
+	}
+	if uploadId != "u1" || len(received) != 300 {
+		t.Fatalf("uploadId = %s, received %d bytes", uploadId, len(received))
+	}
+	// Resumes from the 4th chunk, which fails once and is retried
+	opts.UploadId = uploadId
+	var progress []int64
+	opts.Progress = func(sent, total int64) { progress = append(progress, sent) }
+	result, err := UploadFileChunked("tk", bytes.NewReader(content), "permit", 38, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Verified || result.Size != int64(len(content)) || !bytes.Equal(received, content) {
+		t.Errorf("UploadFileChunked() = %+v, received %d bytes", result, len(received))
+	}
+	if progress[0] != 300 || progress[len(progress)-1] != int64(len(content)) {
+		t.Errorf("progress = %v", progress)
+	}
+}
+
+func TestUploadFileChunkedDisabled(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 100)
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		f, _, err := r.FormFile("file")
+		if err != nil || r.FormValue("contractId") != "38" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		b, _ := io.ReadAll(f)
+		if !bytes.Equal(b, content) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"payload":"https://files/big.pdf"}`))
+	}))
+	defer srv.Close()
+	v := viper.New()
+	v.Set(apiMediaMdlUrlBase, srv.URL)
+	apis.Init(v)
+
+	r := bytes.NewReader(content)
+	r.Seek(500, io.SeekStart)
+	result, err := UploadFileChunked("tk", r, "permit", 38, ChunkedUploadOptions{
+		UploadOptions: UploadOptions{FileName: "big.pdf"},
+		ChunkSize:     100,
+		UploadId:      "u1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Url != "https://files/big.pdf" || len(paths) != 1 || paths[0] != fmt.Sprintf(uploadFileUrlBase, "", "permit") {
+		t.Errorf("UploadFileChunked() = %+v, requested %v", result, paths)
+	}
+}
+
+// failingReader fails reading after failAt bytes
+type failingReader struct {
+	r      *bytes.Reader
+	failAt int64
+}
+
+func (f *failingReader) Read(b []byte) (int, error) {
+	pos, _ := f.r.Seek(0, io.SeekCurrent)
+	if pos >= f.failAt {
+		return 0, errors.New("read failed")
+	}
+	if remain := f.failAt - pos; int64(len(b)) > remain {
+		b = b[:remain]
+	}
+	return f.r.Read(b)
+}
+
+func (f *failingReader) Seek(offset int64, whence int) (int64, error) {
+	return f.r.Seek(offset, whence)
+}
@@ -0,0 +1,292 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/types/floatstring"
+	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+)
+
+// Content types accepted by the default policies
+const (
+	ContentTypeJpeg = "image/jpeg"
+	ContentTypePng  = "image/png"
+	ContentTypePdf  = "application/pdf"
+	ContentTypeHeic = "image/heic"
+)
+
+const (
+	// Report type of the files uploaded by UploadSitePlanPicture
+	reportTypeSitePlan = "siteplan"
+
+	defaultMaxPhotoSize  = 10 << 20
+	defaultMaxReportSize = 30 << 20
+	// Larger images are rejected after image.DecodeConfig, before allocating the pixels
+	maxImagePixels = 50_000_000
+	// Where %%EOF must be found at the end of a pdf
+	pdfTrailerSearch = 1024
+)
+
+// Errors returned by ValidateUpload, wrapped in a *ValidationError
+var (
+	ErrFileEmpty           = errors.New("file is empty")
+	ErrFileTooLarge        = errors.New("file is too large")
+	ErrTypeNotAllowed      = errors.New("file type is not allowed")
+	ErrContentTypeMismatch = errors.New("file content does not match its declared type")
+	ErrCorruptedImage      = errors.New("image is corrupted")
+	ErrCorruptedPdf        = errors.New("pdf is corrupted")
+)
+
+type (
+	// UploadPolicy limits the files uploaded for a report type
+	UploadPolicy struct {
+		MaxSize      int64
+		AllowedTypes []string
+	}
+	ValidateOptions struct {
+		// Content type declared by the client, e.g. from the request header. The file name
+		// extension is used if empty. The sniffed content type must match it.
+		DeclaredType string
+		FileName     string
+		// Keep the Exif GPS location of photos, it is stripped by default
+		KeepLocation bool
+	}
+	ValidatedFile struct {
+		ContentType string
+		// The sanitised content to be uploaded
+		Data []byte
+		// GPS location found in the photo before it is stripped, can be set to MediaParam.Latitude / Longitude
+		Latitude  *floatstring.FloatString
+		Longitude *floatstring.FloatString
+	}
+	// ValidationError is returned by ValidateUpload, use errors.Is to check the reason, e.g. ErrFileTooLarge
+	ValidationError struct {
+		Err         error
+		ReportType  string
+		ContentType string
+		Detail      string
+	}
+)
+
+func (e *ValidationError) Error() string {
+	msg := fmt.Sprintf("invalid %s upload: %v", e.ReportType, e.Err)
+	if e.ContentType != "" {
+		msg += fmt.Sprintf(" (%s)", e.ContentType)
+	}
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	return msg
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	photoPolicy  = UploadPolicy{MaxSize: defaultMaxPhotoSize, AllowedTypes: []string{ContentTypeJpeg, ContentTypePng}}
+	reportPolicy = UploadPolicy{MaxSize: defaultMaxReportSize, AllowedTypes: []string{ContentTypePdf}}
+	// DefaultUploadPolicy applies to report types without a policy, e.g. permit reference documents
+	DefaultUploadPolicy = UploadPolicy{MaxSize: defaultMaxPhotoSize, AllowedTypes: []string{ContentTypeJpeg, ContentTypePng, ContentTypePdf}}
+
+	muUploadPolicies sync.RWMutex
+	uploadPolicies   = map[string]UploadPolicy{
+		reportTypeSitePlan:            photoPolicy,
+		ReportTypeSiteWalk:            reportPolicy,
+		ReportTypeSiteWalkAdmin:       reportPolicy,
+		ReportTypeTaskFollowUp:        reportPolicy,
+		ReportTypeRat:                 reportPolicy,
+		ReportTypePlantPermitCert:     reportPolicy,
+		ReportTypePlantPermitReport:   reportPolicy,
+		ReportTypeNCAPermitReport:     reportPolicy,
+		ReportTypeHotworkPermitReport: reportPolicy,
+		ReportTypeEXPermitReport:      reportPolicy,
+		ReportTypeELPermitReport:      reportPolicy,
+		ReportTypeEL1090PermitReport:  reportPolicy,
+		ReportTypePCPermitCert:        reportPolicy,
+		ReportTypePCPermitReport:      reportPolicy,
+		ReportTypeCSPermitReport:      reportPolicy,
+		ReportTypeCDPermitReport:      reportPolicy,
+		ReportTypeCDV2PermitReport:    reportPolicy,
+		ReportTypeLDPermitReport:      reportPolicy,
+		ReportTypeLSPermitReport:      reportPolicy,
+		ReportTypeEFPermitReport:      reportPolicy,
+		ReportTypeDocReport:           reportPolicy,
+	}
+)
+
+// SetUploadPolicy sets the policy of a report type, replacing the default one
+func SetUploadPolicy(reportType string, policy UploadPolicy) {
+	muUploadPolicies.Lock()
+	defer muUploadPolicies.Unlock()
+	uploadPolicies[reportType] = policy
+}
+
+// GetUploadPolicy returns the policy of a report type, DefaultUploadPolicy if it has none
+func GetUploadPolicy(reportType string) UploadPolicy {
+	muUploadPolicies.RLock()
+	defer muUploadPolicies.RUnlock()
+	if p, ok := uploadPolicies[reportType]; ok {
+		return p
+	}
+	return DefaultUploadPolicy
+}
+
+// ValidateUpload checks data against the policy of reportType and sanitises it before upload.
+// The content type is sniffed from data, images and pdfs are checked for corruption and the
+// GPS location is stripped from photos unless opts.KeepLocation is set.
+func ValidateUpload(reportType string, data []byte, opts ValidateOptions) (*ValidatedFile, error) {
+	policy := GetUploadPolicy(reportType)
+	fail := func(err error, contentType, detail string) (*ValidatedFile, error) {
+		return nil, &ValidationError{Err: err, ReportType: reportType, ContentType: contentType, Detail: detail}
+	}
+	if len(data) == 0 {
+		return fail(ErrFileEmpty, "", "")
+	}
+	if policy.MaxSize > 0 && int64(len(data)) > policy.MaxSize {
+		return fail(ErrFileTooLarge, "", fmt.Sprintf("%d bytes exceeds %d bytes", len(data), policy.MaxSize))
+	}
+	contentType := SniffContentType(data)
+	allowed := false
+	for _, t := range policy.AllowedTypes {
+		allowed = allowed || t == contentType
+	}
+	if !allowed {
+		return fail(ErrTypeNotAllowed, contentType, "allowed types are "+strings.Join(policy.AllowedTypes, ", "))
+	}
+	if declared := declaredContentType(opts); declared != "" && declared != contentType {
+		return fail(ErrContentTypeMismatch, contentType, "declared as "+declared)
+	}
+
+	result := &ValidatedFile{ContentType: contentType, Data: data}
+	switch contentType {
+	case ContentTypeJpeg, ContentTypePng:
+		if err := checkImage(data, contentType); err != nil {
+			return fail(ErrCorruptedImage, contentType, err.Error())
+		}
+		if contentType == ContentTypeJpeg {
+			if lat, lng, ok := jpegLocation(data); ok {
+				latitude, longitude := floatstring.FloatString(lat), floatstring.FloatString(lng)
+				result.Latitude, result.Longitude = &latitude, &longitude
+			}
+		}
+		if !opts.KeepLocation {
+			result.Data = stripLocation(data, contentType)
+		}
+	case ContentTypePdf:
+		if err := checkPdf(data); err != nil {
+			return fail(ErrCorruptedPdf, contentType, err.Error())
+		}
+	}
+	return result, nil
+}
+
+// ReadAndValidateUpload is ValidateUpload reading from r, it stops reading once the file
+// exceeds the size limit of reportType.
+func ReadAndValidateUpload(reportType string, r io.Reader, opts ValidateOptions) (*ValidatedFile, error) {
+	policy := GetUploadPolicy(reportType)
+	if policy.MaxSize > 0 {
+		r = io.LimitReader(r, policy.MaxSize+1)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return ValidateUpload(reportType, data, opts)
+}
+
+// UploadValidatedFile validates and sanitises the file with ValidateUpload before UploadFile
+func UploadValidatedFile(tk string, fileBytes []byte, fileName string, reportType string, contractId intstring.IntString, opts ValidateOptions) (string, *ValidatedFile, error) {
+	if opts.FileName == "" {
+		opts.FileName = fileName
+	}
+	file, err := ValidateUpload(reportType, fileBytes, opts)
+	if err != nil {
+		return "", nil, err
+	}
+	url, err := UploadFile(tk, file.Data, fileName, reportType, contractId)
+	return url, file, err
+}
+
+// SniffContentType detects the content type of data, HEIC photos and pdfs included
+func SniffContentType(data []byte) string {
+	if len(data) >= 12 && string(data[4:8]) == "ftyp" {
+		switch string(data[8:12]) {
+		case "heic", "heix", "hevc", "hevx", "mif1", "msf1":
+			return ContentTypeHeic
+		}
+	}
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	return contentType
+}
+
+func declaredContentType(opts ValidateOptions) string {
+	declared := opts.DeclaredType
+	if declared == "" && opts.FileName != "" {
+		switch strings.ToLower(filepath.Ext(opts.FileName)) {
+		case ".jpg", ".jpeg":
+			declared = ContentTypeJpeg
+		case ".heic", ".heif":
+			declared = ContentTypeHeic
+		default:
+			declared = mime.TypeByExtension(filepath.Ext(opts.FileName))
+		}
+	}
+	if declared == "" || declared == "application/octet-stream" {
+		return ""
+	}
+	declared, _, _ = mime.ParseMediaType(declared)
+	return declared
+}
+
+func checkImage(data []byte, contentType string) error {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxImagePixels {
+		return fmt.Errorf("unsupported dimension %dx%d", cfg.Width, cfg.Height)
+	}
+	// A full decode detects truncated files
+	if contentType == ContentTypeJpeg {
+		_, err = jpeg.Decode(bytes.NewReader(data))
+	} else {
+		_, err = png.Decode(bytes.NewReader(data))
+	}
+	return err
+}
+
+func checkPdf(data []byte) error {
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return errors.New("missing header")
+	}
+	tail := data
+	if len(tail) > pdfTrailerSearch {
+		tail = tail[len(tail)-pdfTrailerSearch:]
+	}
+	if !bytes.Contains(tail, []byte("%%EOF")) {
+		return errors.New("missing %%EOF, the file may be truncated")
+	}
+	if !bytes.Contains(data, []byte("startxref")) {
+		return errors.New("missing cross-reference table")
+	}
+	return nil
+}
+
+func stripLocation(data []byte, contentType string) []byte {
+	if contentType == ContentTypeJpeg {
+		return stripJpegGPS(stripJpegXMP(data))
+	}
+	return stripPngLocation(data)
+}
@@ -0,0 +1,188 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"testing"
+)
+
+// testExif builds the tiff structure of an Exif segment with the given orientation and a GPS
+// location of 22°18'N 114°9'E
+func testExif(orientation uint16) []byte {
+	bo := binary.LittleEndian
+	b := make([]byte, 140)
+	copy(b, "II*\x00")
+	bo.PutUint32(b[4:], 8)
+	// IFD0: orientation and GPS pointer
+	bo.PutUint16(b[8:], 2)
+	entry := func(pos int, tag, typ uint16, count, value uint32) {
+		bo.PutUint16(b[pos:], tag)
+		bo.PutUint16(b[pos+2:], typ)
+		bo.PutUint32(b[pos+4:], count)
+		bo.PutUint32(b[pos+8:], value)
+	}
+	entry(10, exifTagOrientation, exifTypeShort, 1, uint32(orientation))
+	entry(22, exifTagGPSInfo, exifTypeLong, 1, 38)
+	// GPS IFD at 38
+	bo.PutUint16(b[38:], 4)
+	entry(40, exifTagGPSLatRef, 2, 2, uint32('N'))
+	entry(52, exifTagGPSLat, exifTypeRational, 3, 92)
+	entry(64, exifTagGPSLngRef, 2, 2, uint32('E'))
+	entry(76, exifTagGPSLng, exifTypeRational, 3, 116)
+	for i, v := range []uint32{22, 1, 18, 1, 0, 1} {
+		bo.PutUint32(b[92+i*4:], v)
+	}
+	for i, v := range []uint32{114, 1, 9, 1, 0, 1} {
+		bo.PutUint32(b[116+i*4:], v)
+	}
+	return b
+}
+
+func testJpeg(t *testing.T, exif []byte) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for x := 0; x < 4; x++ {
+		img.Set(x, 0, color.RGBA{R: uint8(x * 60), A: 0xff})
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if exif == nil {
+		return data
+	}
+	seg := []byte{0xff, jpegMarkerAPP1, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(2+len(exifHeader)+len(exif)))
+	seg = append(append(seg, exifHeader...), exif...)
+	return append(append(append([]byte{}, data[:2]...), seg...), data[2:]...)
+}
+
+func testPng(t *testing.T) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestValidateUpload(t *testing.T) {
+	photo := testJpeg(t, testExif(6))
+	pdf := []byte("%PDF-1.4\n1 0 obj\n<<>>\nendobj\nstartxref\n9\n%%EOF\n")
+	tests := []struct {
+		name       string
+		reportType string
+		data       []byte
+		opts       ValidateOptions
+		wantErr    error
+		wantType   string
+		wantGPS    bool
+	}{
+		{name: "Photo", reportType: "permit", data: photo, opts: ValidateOptions{FileName: "a.jpg"}, wantType: ContentTypeJpeg},
+		{name: "Photo keeping location", reportType: "permit", data: photo, opts: ValidateOptions{KeepLocation: true}, wantType: ContentTypeJpeg, wantGPS: true},
+		{name: "Png", reportType: "permit", data: testPng(t), wantType: ContentTypePng},
+		{name: "Pdf report", reportType: ReportTypeSiteWalk, data: pdf, wantType: ContentTypePdf},
+		{name: "Photo as report", reportType: ReportTypeSiteWalk, data: photo, wantErr: ErrTypeNotAllowed},
+		{name: "Heic", reportType: "permit", data: append([]byte{0, 0, 0, 24}, []byte("ftypheic0000")...), wantErr: ErrTypeNotAllowed},
+		{name: "Mislabelled pdf", reportType: "permit", data: photo, opts: ValidateOptions{FileName: "a.pdf"}, wantErr: ErrContentTypeMismatch},
+		{name: "Truncated photo", reportType: "permit", data: photo[:len(photo)-40], wantErr: ErrCorruptedImage},
+		{name: "Truncated pdf", reportType: ReportTypeSiteWalk, data: pdf[:20], wantErr: ErrCorruptedPdf},
+		{name: "Too large", reportType: "permit", data: append(photo, make([]byte, defaultMaxPhotoSize)...), wantErr: ErrFileTooLarge},
+		{name: "Empty", reportType: "permit", wantErr: ErrFileEmpty},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ValidateUpload(tt.reportType, tt.data, tt.opts)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ValidateUpload() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				var verr *ValidationError
+				if !errors.As(err, &verr) || verr.ReportType != tt.reportType {
+					t.Errorf("ValidateUpload() error = %#v, want *ValidationError", err)
+				}
+				return
+			}
+			if got.ContentType != tt.wantType {
+				t.Errorf("ContentType = %s, want %s", got.ContentType, tt.wantType)
+			}
+			if tt.wantType != ContentTypeJpeg {
+				return
+			}
+			if got.Latitude == nil || math.Abs(float64(*got.Latitude)-22.3) > 1e-9 || math.Abs(float64(*got.Longitude)-114.15) > 1e-9 {
+				t.Errorf("location = %v, %v", got.Latitude, got.Longitude)
+			}
+			_, _, hasGPS := jpegLocation(got.Data)
+			if hasGPS != tt.wantGPS {
+				t.Errorf("GPS kept = %v, want %v", hasGPS, tt.wantGPS)
+			}
+			if jpegOrientation(got.Data) != 6 {
+				t.Errorf("orientation lost after stripping GPS")
+			}
+			if _, err := jpeg.Decode(bytes.NewReader(got.Data)); err != nil {
+				t.Errorf("sanitised photo cannot be decoded: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateUploadStripsXMP(t *testing.T) {
+	xmp := `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+		`<rdf:Description xmlns:exif="http://ns.adobe.com/exif/1.0/" exif:GPSLatitude="22,18.0N" exif:GPSLongitude="114,9.0E"/>` +
+		`</rdf:RDF></x:xmpmeta>`
+	photo := testJpeg(t, testExif(6))
+	seg := []byte{0xff, jpegMarkerAPP1, 0, 0}
+	seg = append(append(seg, xmpHeaders[0]...), xmp...)
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(seg)-2))
+	photo = append(append(append([]byte{}, photo[:2]...), seg...), photo[2:]...)
+
+	picture := testPng(t)
+	data := append(append([]byte{}, pngXmpKeyword...), 0, 0, 0, 0)
+	data = append(data, xmp...)
+	chunk := make([]byte, 4, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	chunk = append(append(chunk, "iTXt"...), data...)
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(chunk[4:]))
+	chunk = append(chunk, crc...)
+	// Inserted after the IHDR chunk
+	picture = append(append(append([]byte{}, picture[:33]...), chunk...), picture[33:]...)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		wantType string
+	}{
+		{name: "Jpeg", data: photo, wantType: ContentTypeJpeg},
+		{name: "Png", data: picture, wantType: ContentTypePng},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !bytes.Contains(tt.data, []byte("GPSLatitude")) {
+				t.Fatal("test data has no XMP location")
+			}
+			got, err := ValidateUpload("permit", tt.data, ValidateOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.ContentType != tt.wantType {
+				t.Errorf("ContentType = %s, want %s", got.ContentType, tt.wantType)
+			}
+			if bytes.Contains(got.Data, []byte("GPSLatitude")) {
+				t.Errorf("XMP location kept")
+			}
+			if _, _, err := image.Decode(bytes.NewReader(got.Data)); err != nil {
+				t.Errorf("sanitised image cannot be decoded: %v", err)
+			}
+			if tt.wantType == ContentTypeJpeg && jpegOrientation(got.Data) != 6 {
+				t.Errorf("orientation lost after stripping XMP")
+			}
+		})
+	}
+}
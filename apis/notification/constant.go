@@ -1,18 +1,20 @@
 package notification
 
+import "github.com/Mobility-Development-Team/be-common-mdl/apis/core"
+
 const (
 	// UserStatusActive 用户链接状态
-	UserStatusActive = "ACTIVE"
+	UserStatusActive = core.StatusActive
 	// ContractStatusActive 项目链接状态
-	ContractStatusActive = "ACTIVE"
+	ContractStatusActive = core.StatusActive
 	// ContractStatusInactive 项目停用状态
-	ContractStatusInactive = "INACTIVE"
+	ContractStatusInactive = core.StatusInactive
 	// UserStatusInactive 用户取消链接状态
-	UserStatusInactive = "INACTIVE"
+	UserStatusInactive = core.StatusInactive
 	// UserIsExtraSendOn 用户开启发送额外通知
-	UserIsExtraSendOn  = "on"
-	UserIsExtraSendOff = "off"
+	UserIsExtraSendOn  = core.ExtraSendOn
+	UserIsExtraSendOff = core.ExtraSendOff
 	// ContractIsExtraSendOn 项目开启额外通知
-	ContractIsExtraSendOn  = "on"
-	ContractIsExtraSendOff = "off"
+	ContractIsExtraSendOn  = core.ExtraSendOn
+	ContractIsExtraSendOff = core.ExtraSendOff
 )
@@ -0,0 +1,463 @@
+package notification
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+	logger "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultDigestWindow     = time.Minute
+	defaultDigestRateWindow = time.Hour
+)
+
+const (
+	digestRecipientUser       = "user"
+	digestRecipientGroup      = "group"
+	digestRecipientPartyAdmin = "partyAdmin"
+	// Users with extra send turned on, they are added by CreateNotifications
+	digestRecipientExtra = "extra"
+)
+
+// Digester collects notifications per recipient and template family over Window and merges
+// them into a digest notification, so that busy workflows do not flood the users.
+//
+//	d := notification.NewDigester(func(n ...*notification.Notification) error {
+//		return notification.CreateNotifications(tk, n...)
+//	}, func(family string, contractId *intstring.IntString, n []*notification.Notification) *notification.Notification {
+//		return notification.NewNotification(contractId, "PERMIT_UPDATES", len(n))
+//	})
+//	d.Urgent = []string{"*_REJECTED"}
+//	go d.Run(ctx)
+//	d.Add(notifications...)
+//
+// A recipient (user, group or party admins) receiving a single notification of a family within
+// Window gets the notification as is, otherwise it gets one digest built by Digest. The extra send
+// users of ExtraSendRule are treated as one more recipient of the contract. With RateLimit, all
+// recipients are expanded into users by ExpandRecipients first.
+//
+// Pending notifications are kept in memory only. If Send fails, the notifications are collected
+// again, sent with the next flush and do not count against RateLimit, pass a Send enqueuing them
+// with EnqueueNotifications if they must survive the process. Call Flush before exiting, Run does
+// so when ctx is done.
+type Digester struct {
+	// Sends the notifications, usually CreateNotifications
+	Send func(notifications ...*Notification) error
+	// How long notifications are collected, defaults to 1m
+	Window time.Duration
+	// Returns the family of a template type, defaults to DefaultTemplateFamily
+	Family func(templateType string) string
+	// Builds the digest of notifications of the same family and contract, its template must exist in
+	// the notification module. The recipients, idempotency key and extra send setting of the digest
+	// are set by the Digester. If it returns nil, the notifications are sent separately instead.
+	Digest func(family string, contractId *intstring.IntString, notifications []*Notification) *Notification
+	// Template types matching any of these patterns (path.Match) are sent immediately
+	Urgent []string
+	// Maximum number of notifications (digests count as one) sent to a user within RateWindow.
+	// Notifications to a user over the limit are held back and merged until the limit allows.
+	// Urgent notifications are counted but never held back. 0 means no limit.
+	RateLimit  int
+	RateWindow time.Duration // Defaults to 1h
+	// Expands the recipients of a notification into the users receiving it, required with RateLimit
+	// so that a user is limited however it is addressed, e.g. with ResolveRecipients:
+	//
+	//	d.ExpandRecipients = func(n *notification.Notification) ([]intstring.IntString, error) {
+	//		r, err := notification.ResolveRecipients(tk, nil, n)
+	//		if err != nil {
+	//			return nil, err
+	//		}
+	//		return r.RecipientIds(), nil
+	//	}
+	ExpandRecipients func(n *Notification) ([]intstring.IntString, error)
+
+	mu      sync.Mutex
+	buckets map[digestKey]*digestBucket
+	sent    map[digestRecipient][]time.Time
+}
+
+type (
+	digestRecipient struct {
+		kind string
+		id   intstring.IntString
+	}
+	digestKey struct {
+		contractId intstring.IntString
+		family     string
+		recipient  digestRecipient
+	}
+	digestSingle struct {
+		n     *Notification
+		parts int
+	}
+	digestBucket struct {
+		contractId    *intstring.IntString
+		firstAt       time.Time
+		notifications []*Notification
+	}
+)
+
+// NewDigester creates a Digester sending the notifications with send and building digests with digest
+func NewDigester(
+	send func(notifications ...*Notification) error,
+	digest func(family string, contractId *intstring.IntString, notifications []*Notification) *Notification,
+) *Digester {
+	return &Digester{
+		Send:    send,
+		Digest:  digest,
+		buckets: map[digestKey]*digestBucket{},
+		sent:    map[digestRecipient][]time.Time{},
+	}
+}
+
+// DefaultTemplateFamily removes the last part of the template type, e.g. PERMIT_APPROVED becomes PERMIT
+func DefaultTemplateFamily(templateType string) string {
+	if i := strings.LastIndex(templateType, "_"); i > 0 {
+		return templateType[:i]
+	}
+	return templateType
+}
+
+// Add collects the notifications, urgent notifications and notifications without
+// any recipients are sent immediately.
+func (d *Digester) Add(notifications ...*Notification) error {
+	if d.Send == nil || d.Digest == nil {
+		return errors.New("digester requires Send and Digest, see NewDigester")
+	}
+	if d.RateLimit > 0 {
+		expanded, err := d.expand(notifications)
+		if err != nil {
+			return err
+		}
+		notifications = expanded
+	}
+	now := time.Now()
+	var immediate []*Notification
+	d.mu.Lock()
+	if d.buckets == nil {
+		d.buckets = map[digestKey]*digestBucket{}
+		d.sent = map[digestRecipient][]time.Time{}
+	}
+	for _, n := range notifications {
+		if n == nil {
+			continue
+		}
+		if d.isUrgent(n.TemplateType) {
+			immediate = append(immediate, n)
+			for _, r := range digestRecipientsOf(n) {
+				d.sent[r] = append(d.sent[r], now)
+			}
+			continue
+		}
+		// Extra send is decided here as it depends on the template type and recipients of n
+		n := *n
+		n.Recipients.Users = append([]intstring.IntString{}, n.Recipients.Users...)
+		applyExtraSendPolicy(&n)
+		recipients := digestRecipientsOf(&n)
+		if n.EnableExtraSendUser && n.ContractID != nil {
+			recipients = append(recipients, digestRecipient{kind: digestRecipientExtra})
+		}
+		if len(recipients) == 0 {
+			immediate = append(immediate, &n)
+			continue
+		}
+		family := d.family(n.TemplateType)
+		for _, r := range recipients {
+			key := digestKey{family: family, recipient: r}
+			if n.ContractID != nil {
+				key.contractId = *n.ContractID
+			}
+			b, ok := d.buckets[key]
+			if !ok {
+				b = &digestBucket{contractId: n.ContractID, firstAt: now}
+				d.buckets[key] = b
+			}
+			b.notifications = append(b.notifications, &n)
+		}
+	}
+	d.mu.Unlock()
+	if len(immediate) == 0 {
+		return nil
+	}
+	return d.Send(immediate...)
+}
+
+// Run sends the collected notifications once their window has passed until ctx is done,
+// then sends all remaining notifications.
+func (d *Digester) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.window() / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := d.Flush(); err != nil {
+				logger.Error("[Digester] Flush failed: ", err)
+			}
+			return
+		case <-ticker.C:
+			if err := d.FlushDue(); err != nil {
+				logger.Error("[Digester] Flush failed: ", err)
+			}
+		}
+	}
+}
+
+// FlushDue sends the notifications collected for longer than Window, within the rate limits
+func (d *Digester) FlushDue() error {
+	return d.flush(time.Now(), false)
+}
+
+// Flush sends all collected notifications regardless of Window and the rate limits
+func (d *Digester) Flush() error {
+	return d.flush(time.Now(), true)
+}
+
+func (d *Digester) flush(now time.Time, all bool) error {
+	d.mu.Lock()
+	keys := make([]digestKey, 0, len(d.buckets))
+	for key, b := range d.buckets {
+		if !all && (now.Sub(b.firstAt) < d.window() || d.limited(key.recipient, now)) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	// Sorted so that notifications are sent in a stable order
+	sort.Slice(keys, func(i, j int) bool {
+		ti, tj := d.buckets[keys[i]].firstAt, d.buckets[keys[j]].firstAt
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+	})
+
+	var result []*Notification
+	// A notification that ends up alone in its buckets is sent once to all of these recipients
+	singles := map[*Notification]*digestSingle{}
+	addSingle := func(orig *Notification, r digestRecipient) {
+		single, ok := singles[orig]
+		if !ok {
+			single = &digestSingle{n: withoutRecipients(orig)}
+			singles[orig] = single
+			result = append(result, single.n)
+		}
+		r.addTo(single.n)
+		single.parts++
+	}
+	taken := make(map[digestKey]*digestBucket, len(keys))
+	for _, key := range keys {
+		b := d.buckets[key]
+		taken[key] = b
+		delete(d.buckets, key)
+		if key.recipient.kind != digestRecipientExtra {
+			d.sent[key.recipient] = append(d.sent[key.recipient], now)
+		}
+		if len(b.notifications) == 1 {
+			addSingle(b.notifications[0], key.recipient)
+			continue
+		}
+		digest := d.digest(key.family, b.contractId, b.notifications)
+		if digest == nil {
+			logger.Errorf("[Digester] No digest built for %d notification(s) of %s, sending them separately", len(b.notifications), key.family)
+			for _, n := range b.notifications {
+				addSingle(n, key.recipient)
+			}
+			continue
+		}
+		key.recipient.addTo(digest)
+		// The digest only has an idempotency key if all of its notifications have one
+		keyed := true
+		h := sha256.New()
+		fmt.Fprintf(h, "%s:%s", key.recipient.kind, key.recipient.id)
+		for _, n := range b.notifications {
+			h.Write([]byte(n.IdempotencyKey))
+			keyed = keyed && n.IdempotencyKey != ""
+			digest.IncludeSelf = digest.IncludeSelf || n.IncludeSelf
+		}
+		if keyed {
+			digest.IdempotencyKey = AppendRefKeyWithEnvironment("digest-" + hex.EncodeToString(h.Sum(nil)))
+		}
+		result = append(result, digest)
+	}
+	for orig, single := range singles {
+		if orig.IdempotencyKey != "" && single.parts < len(digestRecipientsOf(orig))+boolToInt(orig.EnableExtraSendUser && orig.ContractID != nil) {
+			// Other parts of orig are sent separately and must not be dropped as duplicates
+			single.n.IdempotencyKey = single.n.GenerateIdempotencyKey()
+		}
+	}
+	d.pruneSent(now)
+	d.mu.Unlock()
+	if len(result) == 0 {
+		return nil
+	}
+	if err := d.Send(result...); err != nil {
+		d.requeue(taken, now)
+		return err
+	}
+	return nil
+}
+
+// requeue puts the buckets taken by a flush at now back after Send failed, together with
+// the notifications collected since, and removes them from the rate limits
+func (d *Digester) requeue(taken map[digestKey]*digestBucket, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for key, b := range taken {
+		if added, ok := d.buckets[key]; ok {
+			b.notifications = append(b.notifications, added.notifications...)
+		}
+		d.buckets[key] = b
+		times := d.sent[key.recipient]
+		for i := len(times) - 1; i >= 0; i-- {
+			if times[i].Equal(now) {
+				d.sent[key.recipient] = append(times[:i], times[i+1:]...)
+				break
+			}
+		}
+		if len(d.sent[key.recipient]) == 0 {
+			delete(d.sent, key.recipient)
+		}
+	}
+}
+
+// expand replaces the recipients of the notifications with the users receiving them, extra send
+// users included, so that all recipients are users when RateLimit applies
+func (d *Digester) expand(notifications []*Notification) ([]*Notification, error) {
+	if d.ExpandRecipients == nil {
+		return nil, errors.New("digester with RateLimit requires ExpandRecipients")
+	}
+	result := make([]*Notification, 0, len(notifications))
+	for _, n := range notifications {
+		if n == nil {
+			continue
+		}
+		userIds, err := d.ExpandRecipients(n)
+		if err != nil {
+			return nil, fmt.Errorf("unable to expand recipients of notification %s: %w", n.TemplateType, err)
+		}
+		expanded := withoutRecipients(n)
+		expanded.AddUserRecipient(userIds...)
+		result = append(result, expanded)
+	}
+	return result, nil
+}
+
+// limited returns true if r has reached RateLimit, must be called with d.mu locked
+func (d *Digester) limited(r digestRecipient, now time.Time) bool {
+	if d.RateLimit <= 0 || r.kind == digestRecipientExtra {
+		return false
+	}
+	count := 0
+	for _, t := range d.sent[r] {
+		if now.Sub(t) < d.rateWindow() {
+			count++
+		}
+	}
+	return count >= d.RateLimit
+}
+
+func (d *Digester) pruneSent(now time.Time) {
+	for r, times := range d.sent {
+		kept := times[:0]
+		for _, t := range times {
+			if now.Sub(t) < d.rateWindow() {
+				kept = append(kept, t)
+			}
+		}
+		if len(kept) == 0 {
+			delete(d.sent, r)
+		} else {
+			d.sent[r] = kept
+		}
+	}
+}
+
+func (d *Digester) isUrgent(templateType string) bool {
+	for _, pattern := range d.Urgent {
+		if ok, _ := path.Match(pattern, templateType); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Digester) family(templateType string) string {
+	if d.Family != nil {
+		return d.Family(templateType)
+	}
+	return DefaultTemplateFamily(templateType)
+}
+
+func (d *Digester) digest(family string, contractId *intstring.IntString, notifications []*Notification) *Notification {
+	n := d.Digest(family, contractId, notifications)
+	if n == nil {
+		return nil
+	}
+	n.Recipients = Recipients{}
+	return n.SetupEnableExtraSendUser(false)
+}
+
+func (d *Digester) window() time.Duration {
+	if d.Window > 0 {
+		return d.Window
+	}
+	return defaultDigestWindow
+}
+
+func (d *Digester) rateWindow() time.Duration {
+	if d.RateWindow > 0 {
+		return d.RateWindow
+	}
+	return defaultDigestRateWindow
+}
+
+func digestRecipientsOf(n *Notification) []digestRecipient {
+	var result []digestRecipient
+	for _, id := range n.Recipients.Users {
+		result = append(result, digestRecipient{kind: digestRecipientUser, id: id})
+	}
+	for _, id := range n.Recipients.Groups {
+		result = append(result, digestRecipient{kind: digestRecipientGroup, id: id})
+	}
+	for _, id := range n.Recipients.PartyAdmin {
+		result = append(result, digestRecipient{kind: digestRecipientPartyAdmin, id: id})
+	}
+	return result
+}
+
+// withoutRecipients returns a copy of n without recipients and extra send turned off
+func withoutRecipients(n *Notification) *Notification {
+	c := *n
+	c.Recipients = Recipients{}
+	return c.SetupEnableExtraSendUser(false)
+}
+
+func (r digestRecipient) addTo(n *Notification) {
+	switch r.kind {
+	case digestRecipientUser:
+		n.AddUserRecipient(r.id)
+	case digestRecipientGroup:
+		n.AddGroupRecipient(r.id)
+	case digestRecipientPartyAdmin:
+		n.AddPartyAdminRecipient(r.id)
+	case digestRecipientExtra:
+		// Extra send users are added by CreateNotifications, which skips notifications without any recipients
+		n.PermitEmptyRecipients = true
+		n.SetupEnableExtraSendUser(true)
+	}
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
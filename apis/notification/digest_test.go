@@ -0,0 +1,213 @@
+package notification
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/apis"
+	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+	"github.com/spf13/viper"
+)
+
+func TestDigester(t *testing.T) {
+	v := viper.New()
+	v.Set("env.short", "dev")
+	apis.Init(v)
+	if err := SetExtraSendRules(); err != nil {
+		t.Fatal(err)
+	}
+	defer SetExtraSendRules(DefaultExtraSendRules...)
+	contractId := intstring.IntString(38)
+	tests := []struct {
+		name      string
+		rateLimit int
+		add       []*Notification
+		// Template types and user recipients sent immediately and after the window
+		wantImmediate []string
+		wantSent      map[string][]intstring.IntString
+	}{
+		{
+			name: "Single notification is sent as is",
+			add: []*Notification{
+				NewNotification(&contractId, "PERMIT_SUBMITTED").AddUserRecipient(1, 2),
+			},
+			wantSent: map[string][]intstring.IntString{"PERMIT_SUBMITTED": {1, 2}},
+		},
+		{
+			name: "Same family is merged per user",
+			add: []*Notification{
+				NewNotification(&contractId, "PERMIT_SUBMITTED").AddUserRecipient(1, 2),
+				NewNotification(&contractId, "PERMIT_APPROVED").AddUserRecipient(1),
+			},
+			wantSent: map[string][]intstring.IntString{"PERMIT_DIGEST": {1}, "PERMIT_SUBMITTED": {2}},
+		},
+		{
+			name: "Urgent bypasses",
+			add: []*Notification{
+				NewNotification(&contractId, "PERMIT_REJECTED").AddUserRecipient(1),
+				NewNotification(&contractId, "PERMIT_SUBMITTED").AddUserRecipient(1),
+			},
+			wantImmediate: []string{"PERMIT_REJECTED"},
+			wantSent:      map[string][]intstring.IntString{"PERMIT_SUBMITTED": {1}},
+		},
+		{
+			name:      "Rate limited",
+			rateLimit: 1,
+			add: []*Notification{
+				NewNotification(&contractId, "PERMIT_REJECTED").AddUserRecipient(1),
+				NewNotification(&contractId, "PERMIT_SUBMITTED").AddUserRecipient(1, 2),
+			},
+			wantImmediate: []string{"PERMIT_REJECTED"},
+			wantSent:      map[string][]intstring.IntString{"PERMIT_SUBMITTED": {2}},
+		},
+		{
+			name:      "Rate limited per user",
+			rateLimit: 1,
+			add: []*Notification{
+				NewNotification(&contractId, "PERMIT_REJECTED").AddUserRecipient(1),
+				NewNotification(&contractId, "PERMIT_SUBMITTED").AddGroupRecipient(5),
+			},
+			wantImmediate: []string{"PERMIT_REJECTED"},
+			wantSent:      map[string][]intstring.IntString{"PERMIT_SUBMITTED": {3}},
+		},
+	}
+	// Group 5 has the users 1 and 3
+	expand := func(n *Notification) ([]intstring.IntString, error) {
+		ids := append([]intstring.IntString{}, n.Recipients.Users...)
+		for _, groupId := range n.Recipients.Groups {
+			if groupId == 5 {
+				ids = append(ids, 1, 3)
+			}
+		}
+		return ids, nil
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent []*Notification
+			d := NewDigester(func(n ...*Notification) error {
+				sent = append(sent, n...)
+				return nil
+			}, func(family string, contractId *intstring.IntString, n []*Notification) *Notification {
+				return NewNotification(contractId, family+"_DIGEST", len(n))
+			})
+			d.Urgent = []string{"*_REJECTED"}
+			d.RateLimit = tt.rateLimit
+			d.ExpandRecipients = expand
+			if err := d.Add(tt.add...); err != nil {
+				t.Fatal(err)
+			}
+			if len(sent) != len(tt.wantImmediate) {
+				t.Fatalf("sent %d immediately, want %d", len(sent), len(tt.wantImmediate))
+			}
+			for i, templateType := range tt.wantImmediate {
+				if sent[i].TemplateType != templateType {
+					t.Errorf("sent %s immediately, want %s", sent[i].TemplateType, templateType)
+				}
+			}
+			sent = nil
+			if err := d.flush(time.Now().Add(time.Hour-time.Second), false); err != nil {
+				t.Fatal(err)
+			}
+			got := map[string][]intstring.IntString{}
+			keys := map[string]bool{}
+			for _, n := range sent {
+				got[n.TemplateType] = append(got[n.TemplateType], n.Recipients.Users...)
+				if n.IdempotencyKey != "" && keys[n.IdempotencyKey] {
+					t.Errorf("duplicated idempotency key %s", n.IdempotencyKey)
+				}
+				keys[n.IdempotencyKey] = true
+			}
+			if len(got) != len(tt.wantSent) {
+				t.Fatalf("sent %v, want %v", got, tt.wantSent)
+			}
+			for templateType, want := range tt.wantSent {
+				if len(got[templateType]) != len(want) {
+					t.Errorf("sent %s to %v, want %v", templateType, got[templateType], want)
+					continue
+				}
+				for i := range want {
+					if got[templateType][i] != want[i] {
+						t.Errorf("sent %s to %v, want %v", templateType, got[templateType], want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDigesterRequiresDigest(t *testing.T) {
+	d := NewDigester(func(n ...*Notification) error { return nil }, nil)
+	if err := d.Add(NewNotification(nil, "PERMIT_SUBMITTED").AddUserRecipient(1)); err == nil {
+		t.Error("Add() expected error without Digest")
+	}
+	d.Digest = func(family string, contractId *intstring.IntString, n []*Notification) *Notification {
+		return NewNotification(contractId, family+"_DIGEST", len(n))
+	}
+	d.RateLimit = 1
+	if err := d.Add(NewNotification(nil, "PERMIT_SUBMITTED").AddUserRecipient(1)); err == nil {
+		t.Error("Add() expected error with RateLimit but without ExpandRecipients")
+	}
+}
+
+func TestDigesterSendFailed(t *testing.T) {
+	v := viper.New()
+	v.Set("env.short", "dev")
+	apis.Init(v)
+	var sent []*Notification
+	fail := true
+	d := NewDigester(func(n ...*Notification) error {
+		if fail {
+			return errors.New("send failed")
+		}
+		sent = append(sent, n...)
+		return nil
+	}, func(family string, contractId *intstring.IntString, n []*Notification) *Notification {
+		return NewNotification(contractId, family+"_DIGEST", len(n))
+	})
+	d.RateLimit = 1
+	d.ExpandRecipients = func(n *Notification) ([]intstring.IntString, error) { return n.Recipients.Users, nil }
+	if err := d.Add(NewNotification(nil, "PERMIT_SUBMITTED").AddUserRecipient(1)); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Add(time.Minute)
+	if err := d.flush(now, false); err == nil {
+		t.Fatal("flush() expected error when Send fails")
+	}
+	// The failed notification is kept and merged with the ones added since, within the rate limit
+	fail = false
+	if err := d.Add(NewNotification(nil, "PERMIT_APPROVED").AddUserRecipient(1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.flush(now.Add(time.Second), false); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 1 || sent[0].TemplateType != "PERMIT_DIGEST" || sent[0].Params[0] != 2 {
+		t.Fatalf("sent %+v, want one digest of 2 notifications", sent)
+	}
+}
+
+func TestDigesterNilDigest(t *testing.T) {
+	v := viper.New()
+	v.Set("env.short", "dev")
+	apis.Init(v)
+	var sent []*Notification
+	d := NewDigester(func(n ...*Notification) error {
+		sent = append(sent, n...)
+		return nil
+	}, func(family string, contractId *intstring.IntString, n []*Notification) *Notification {
+		return nil
+	})
+	if err := d.Add(
+		NewNotification(nil, "PERMIT_SUBMITTED").AddUserRecipient(1),
+		NewNotification(nil, "PERMIT_APPROVED").AddUserRecipient(1),
+	); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 2 || sent[0].TemplateType != "PERMIT_SUBMITTED" || sent[1].TemplateType != "PERMIT_APPROVED" {
+		t.Fatalf("sent %+v, want the notifications separately", sent)
+	}
+}
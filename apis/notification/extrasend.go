@@ -0,0 +1,138 @@
+package notification
+
+import (
+	"fmt"
+	"path"
+	"sync"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/apis"
+	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+	"github.com/Mobility-Development-Team/be-common-mdl/util/arrutil"
+	logger "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const extraSendRulesConfig = "notification.extrasend.rules"
+
+// ExtraSendRule decides whether a notification is also sent to extra recipients.
+//
+// Rules are loaded from config with the following structure, the first matching rule wins:
+//
+//	notification:
+//		extrasend:
+//			rules:
+//				- template: "PERMIT_*_APPROVED"  # Pattern of path.Match
+//				  contracts: [38]                 # Optional, matches any contract if empty
+//				  parties: [2]                    # Optional, matches if any party admin recipient is listed
+//				  enable: true                    # Adds the users with extra send turned on in the contract
+//				  users: [12]                     # Optional, fixed users to add
+//
+// If no rules are configured, DefaultExtraSendRules are used.
+type ExtraSendRule struct {
+	Template  string                `mapstructure:"template"`
+	Contracts []intstring.IntString `mapstructure:"contracts"`
+	Parties   []intstring.IntString `mapstructure:"parties"`
+	Enable    bool                  `mapstructure:"enable"`
+	Users     []intstring.IntString `mapstructure:"users"`
+}
+
+// DefaultExtraSendRules sends extra notifications for all approval outcomes
+var DefaultExtraSendRules = []ExtraSendRule{
+	{Template: "*_APPROVED", Enable: true},
+	{Template: "*_ACCEPTED", Enable: true},
+	{Template: "*_REJECTED", Enable: true},
+	{Template: "*_CANCELLED", Enable: true},
+}
+
+var (
+	muExtraSendRules sync.Mutex
+	extraSendRules   []ExtraSendRule
+)
+
+// LoadExtraSendRules loads the rules from config, see ExtraSendRule for the structure
+func LoadExtraSendRules(v *viper.Viper) error {
+	var rules []ExtraSendRule
+	if v.IsSet(extraSendRulesConfig) {
+		if err := v.UnmarshalKey(extraSendRulesConfig, &rules); err != nil {
+			return fmt.Errorf("unable to load extra send rules: %w", err)
+		}
+	} else {
+		rules = DefaultExtraSendRules
+	}
+	return SetExtraSendRules(rules...)
+}
+
+// SetExtraSendRules replaces the current rules
+func SetExtraSendRules(rules ...ExtraSendRule) error {
+	for _, r := range rules {
+		if _, err := path.Match(r.Template, ""); err != nil {
+			return fmt.Errorf("invalid extra send rule template %q: %w", r.Template, err)
+		}
+	}
+	muExtraSendRules.Lock()
+	defer muExtraSendRules.Unlock()
+	extraSendRules = append([]ExtraSendRule{}, rules...)
+	return nil
+}
+
+func getExtraSendRules() []ExtraSendRule {
+	muExtraSendRules.Lock()
+	loaded := extraSendRules != nil
+	muExtraSendRules.Unlock()
+	if !loaded {
+		if err := LoadExtraSendRules(apis.V()); err != nil {
+			logger.Error("[getExtraSendRules] Using default rules: ", err)
+			SetExtraSendRules(DefaultExtraSendRules...)
+		}
+	}
+	muExtraSendRules.Lock()
+	defer muExtraSendRules.Unlock()
+	return extraSendRules
+}
+
+// MatchExtraSendRule returns the first rule matching n, or nil if there is none
+func MatchExtraSendRule(n *Notification) *ExtraSendRule {
+	for _, r := range getExtraSendRules() {
+		if r.matches(n) {
+			r := r
+			return &r
+		}
+	}
+	return nil
+}
+
+func (r ExtraSendRule) matches(n *Notification) bool {
+	if ok, _ := path.Match(r.Template, n.TemplateType); !ok {
+		return false
+	}
+	if len(r.Contracts) > 0 && (n.ContractID == nil || !arrutil.Contains(r.Contracts, *n.ContractID)) {
+		return false
+	}
+	if len(r.Parties) > 0 {
+		for _, p := range n.Recipients.PartyAdmin {
+			if arrutil.Contains(r.Parties, p) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// applyExtraSendPolicy sets EnableExtraSendUser and adds the fixed users of the matching rule.
+// An explicit SetupEnableExtraSendUser always wins over the rules.
+func applyExtraSendPolicy(n *Notification) {
+	if n.ExtraSendOverride != nil {
+		n.EnableExtraSendUser = *n.ExtraSendOverride
+		return
+	}
+	rule := MatchExtraSendRule(n)
+	if rule == nil {
+		n.EnableExtraSendUser = false
+		return
+	}
+	n.EnableExtraSendUser = rule.Enable
+	if len(rule.Users) > 0 {
+		n.AddUserRecipient(rule.Users...)
+	}
+}
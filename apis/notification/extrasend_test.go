@@ -0,0 +1,81 @@
+package notification
+
+import (
+	"testing"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+)
+
+func TestApplyExtraSendPolicy(t *testing.T) {
+	err := SetExtraSendRules(
+		ExtraSendRule{Template: "PERMIT_*_APPROVED", Contracts: []intstring.IntString{38}, Enable: true, Users: []intstring.IntString{99}},
+		ExtraSendRule{Template: "PERMIT_*", Parties: []intstring.IntString{2}, Enable: true},
+		ExtraSendRule{Template: "*_REJECTED", Enable: false},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer SetExtraSendRules(DefaultExtraSendRules...)
+	contract38, contract40 := intstring.IntString(38), intstring.IntString(40)
+	tests := []struct {
+		name      string
+		noti      *Notification
+		wantExtra bool
+		wantUsers []intstring.IntString
+	}{
+		{
+			name:      "Contract matched",
+			noti:      NewNotification(&contract38, "PERMIT_PTW_APPROVED"),
+			wantExtra: true,
+			wantUsers: []intstring.IntString{99},
+		},
+		{
+			name: "Contract not matched, no party",
+			noti: NewNotification(&contract40, "PERMIT_PTW_APPROVED"),
+		},
+		{
+			name:      "Party matched",
+			noti:      NewNotification(&contract40, "PERMIT_PTW_APPROVED").AddPartyAdminRecipient(2),
+			wantExtra: true,
+		},
+		{
+			name: "Rule disables extra send",
+			noti: NewNotification(&contract38, "SITE_DIARY_REJECTED"),
+		},
+		{
+			name: "No rule matched",
+			noti: NewNotification(nil, "SITE_DIARY_SUBMITTED"),
+		},
+		{
+			name:      "Override enables",
+			noti:      NewNotification(nil, "SITE_DIARY_SUBMITTED").SetupEnableExtraSendUser(true),
+			wantExtra: true,
+		},
+		{
+			name: "Override disables",
+			noti: NewNotification(&contract38, "PERMIT_PTW_APPROVED").SetupEnableExtraSendUser(false),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			applyExtraSendPolicy(tt.noti)
+			if tt.noti.EnableExtraSendUser != tt.wantExtra {
+				t.Errorf("EnableExtraSendUser = %v, want %v", tt.noti.EnableExtraSendUser, tt.wantExtra)
+			}
+			if len(tt.noti.Recipients.Users) != len(tt.wantUsers) {
+				t.Fatalf("users = %v, want %v", tt.noti.Recipients.Users, tt.wantUsers)
+			}
+			for i, u := range tt.wantUsers {
+				if tt.noti.Recipients.Users[i] != u {
+					t.Errorf("users = %v, want %v", tt.noti.Recipients.Users, tt.wantUsers)
+				}
+			}
+		})
+	}
+}
+
+func TestSetExtraSendRulesInvalid(t *testing.T) {
+	if err := SetExtraSendRules(ExtraSendRule{Template: "[PERMIT"}); err == nil {
+		t.Error("expected error for malformed pattern")
+	}
+}
@@ -0,0 +1,251 @@
+package notification
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/apis"
+	"github.com/Mobility-Development-Team/be-common-mdl/common"
+	"github.com/Mobility-Development-Team/be-common-mdl/genericjson"
+	"github.com/Mobility-Development-Team/be-common-mdl/model"
+	"github.com/Mobility-Development-Team/be-common-mdl/model/pagination"
+	"github.com/Mobility-Development-Team/be-common-mdl/response"
+	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+)
+
+// The inbox endpoints are not confirmed by the notification module yet. They are only called if
+// enabled with `apis.internal.notification.inbox.enabled`, otherwise ErrInboxDisabled is returned.
+const (
+	inboxEnabledConfig     = "apis.internal.notification.inbox.enabled"
+	listInboxNotifications = "%s/notification/inbox"
+	getInboxUnreadCounts   = "%s/notification/inbox/unread/count"
+	markInboxNotifications = "%s/notification/inbox/mark"
+)
+
+// Statuses of InboxNotification
+const (
+	InboxStatusUnread   = "UNREAD"
+	InboxStatusRead     = "READ"
+	InboxStatusArchived = "ARCHIVED"
+)
+
+// ErrInboxDisabled is returned by the inbox functions unless the inbox endpoints are enabled in config
+var ErrInboxDisabled = errors.New("notification inbox is not enabled")
+
+type (
+	// InboxNotification is a notification received by a user, as returned by ListInboxNotifications
+	InboxNotification struct {
+		model.Model
+		NotificationType string               `json:"notificationType"`
+		TemplateType     string               `json:"templateType"`
+		ContractID       *intstring.IntString `json:"contractId"`
+		Params           NotificationParams   `json:"params"`
+		Actions          []Action             `json:"actions"`
+		// Content rendered by the notification module in the language of the user
+		Title   string     `json:"title"`
+		Content string     `json:"content"`
+		Status  string     `json:"status"`
+		ReadAt  *time.Time `json:"readAt"`
+	}
+	// InboxCriteria filters the notifications of the current user (the owner of the token)
+	InboxCriteria struct {
+		ContractIds   []intstring.IntString  `json:"contractIds,omitempty"`
+		TemplateTypes []string               `json:"templateTypes,omitempty"`
+		Statuses      []string               `json:"statuses,omitempty"`
+		Since         *time.Time             `json:"since,omitempty"`
+		Pagination    *pagination.Pagination `json:"-"`
+	}
+	InboxPage struct {
+		Notifications []InboxNotification `json:"notifications"`
+		TotalRows     int64               `json:"totalRows"`
+		TotalPages    int                 `json:"totalPages"`
+	}
+	// InboxUnreadCount is the number of unread notifications of a contract, ContractId is nil
+	// for notifications not related to any contract
+	InboxUnreadCount struct {
+		ContractId *intstring.IntString `json:"contractId"`
+		Count      int64                `json:"count"`
+	}
+	// InboxMark changes the status of notifications, either Ids or All must be set.
+	// All applies to all notifications of the current user, optionally of ContractId only.
+	InboxMark struct {
+		Ids        []intstring.IntString `json:"ids,omitempty"`
+		All        bool                  `json:"all"`
+		ContractId *intstring.IntString  `json:"contractId,omitempty"`
+		Status     string                `json:"status"`
+	}
+)
+
+func NewInboxCriteria() *InboxCriteria {
+	return &InboxCriteria{}
+}
+
+func (c *InboxCriteria) InContracts(ids ...intstring.IntString) *InboxCriteria {
+	c.ContractIds = append(c.ContractIds, ids...)
+	return c
+}
+
+func (c *InboxCriteria) WithTemplateTypes(templateTypes ...string) *InboxCriteria {
+	c.TemplateTypes = append(c.TemplateTypes, templateTypes...)
+	return c
+}
+
+func (c *InboxCriteria) WithStatus(statuses ...string) *InboxCriteria {
+	c.Statuses = append(c.Statuses, statuses...)
+	return c
+}
+
+func (c *InboxCriteria) UnreadOnly() *InboxCriteria {
+	return c.WithStatus(InboxStatusUnread)
+}
+
+func (c *InboxCriteria) CreatedSince(t time.Time) *InboxCriteria {
+	c.Since = &t
+	return c
+}
+
+func (c *InboxCriteria) Paginate(p *pagination.Pagination) *InboxCriteria {
+	c.Pagination = p
+	return c
+}
+
+func (c InboxCriteria) Validate() error {
+	for _, s := range c.Statuses {
+		if err := validateInboxStatus(s); err != nil {
+			return fmt.Errorf("invalid criteria: %w", err)
+		}
+	}
+	return nil
+}
+
+func (m InboxMark) Validate() error {
+	if len(m.Ids) == 0 && !m.All {
+		return errors.New("invalid mark: either ids or all must be specified")
+	}
+	if len(m.Ids) > 0 && m.All {
+		return errors.New("invalid mark: ids and all cannot be specified together")
+	}
+	return validateInboxStatus(m.Status)
+}
+
+// ListInboxNotifications lists the notifications of the current user, newest first.
+// The first page of 10 notifications is returned if c has no pagination.
+func ListInboxNotifications(tk string, c InboxCriteria) (*InboxPage, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	p := c.Pagination
+	if p == nil {
+		p = &pagination.Pagination{}
+	}
+	body := genericjson.NewObject(c, p.Params())
+	var resp struct {
+		response.Response
+		Payload struct {
+			Pager         *pagination.Pagination `json:"pager"`
+			Notifications []InboxNotification    `json:"notifications"`
+		} `json:"payload"`
+	}
+	if err := postInbox(tk, listInboxNotifications, body, &resp); err != nil {
+		return nil, err
+	}
+	page := &InboxPage{Notifications: resp.Payload.Notifications}
+	if page.Notifications == nil {
+		page.Notifications = []InboxNotification{}
+	}
+	if pager := resp.Payload.Pager; pager != nil {
+		page.TotalRows, page.TotalPages = pager.TotalRows, pager.TotalPages
+		p.TotalRows, p.TotalPages = pager.TotalRows, pager.TotalPages
+	}
+	return page, nil
+}
+
+// GetInboxUnreadCounts returns the number of unread notifications of the current user per contract,
+// all contracts of the user are returned if contractIds is empty.
+func GetInboxUnreadCounts(tk string, contractIds ...intstring.IntString) ([]InboxUnreadCount, error) {
+	var resp struct {
+		response.Response
+		Payload []InboxUnreadCount `json:"payload"`
+	}
+	body := map[string]interface{}{
+		"contractIds": contractIds,
+	}
+	if err := postInbox(tk, getInboxUnreadCounts, body, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Payload == nil {
+		return []InboxUnreadCount{}, nil
+	}
+	return resp.Payload, nil
+}
+
+// GetInboxUnreadTotal returns the total number of unread notifications, e.g. for a badge
+func GetInboxUnreadTotal(tk string, contractIds ...intstring.IntString) (int64, error) {
+	counts, err := GetInboxUnreadCounts(tk, contractIds...)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, c := range counts {
+		total += c.Count
+	}
+	return total, nil
+}
+
+// MarkInboxNotifications changes the status of notifications of the current user
+// and returns the number of notifications changed.
+func MarkInboxNotifications(tk string, m InboxMark) (int64, error) {
+	if err := m.Validate(); err != nil {
+		return 0, err
+	}
+	var resp struct {
+		response.Response
+		Payload response.RespAffectedRow `json:"payload"`
+	}
+	if err := postInbox(tk, markInboxNotifications, m, &resp); err != nil {
+		return 0, err
+	}
+	return resp.Payload.RowAffected, nil
+}
+
+// MarkInboxRead marks the given notifications as read
+func MarkInboxRead(tk string, ids ...intstring.IntString) (int64, error) {
+	return MarkInboxNotifications(tk, InboxMark{Ids: ids, Status: InboxStatusRead})
+}
+
+// MarkAllInboxRead marks all notifications as read, of the given contract only if contractId is not nil
+func MarkAllInboxRead(tk string, contractId *intstring.IntString) (int64, error) {
+	return MarkInboxNotifications(tk, InboxMark{All: true, ContractId: contractId, Status: InboxStatusRead})
+}
+
+// ArchiveInbox archives the given notifications
+func ArchiveInbox(tk string, ids ...intstring.IntString) (int64, error) {
+	return MarkInboxNotifications(tk, InboxMark{Ids: ids, Status: InboxStatusArchived})
+}
+
+func validateInboxStatus(status string) error {
+	switch status {
+	case InboxStatusUnread, InboxStatusRead, InboxStatusArchived:
+		return nil
+	}
+	return fmt.Errorf("status must be one of UNREAD, READ or ARCHIVED, got %q", status)
+}
+
+func postInbox(tk, url string, body interface{}, resp interface{}) error {
+	if !apis.V().GetBool(inboxEnabledConfig) {
+		return ErrInboxDisabled
+	}
+	client := common.NewResty()
+	result, err := client.R().SetAuthToken(tk).SetBody(body).Post(
+		fmt.Sprintf(url, apis.V().GetString(apiNotificationMdlUrlBase)),
+	)
+	if err != nil {
+		return err
+	}
+	if !result.IsSuccess() {
+		return fmt.Errorf("Notification module returned status code: %d", result.StatusCode())
+	}
+	return json.Unmarshal(result.Body(), resp)
+}
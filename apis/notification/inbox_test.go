@@ -0,0 +1,94 @@
+package notification
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/apis"
+	"github.com/Mobility-Development-Team/be-common-mdl/model/pagination"
+	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+	"github.com/spf13/viper"
+)
+
+func TestInbox(t *testing.T) {
+	var lastBody map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastBody = nil
+		json.NewDecoder(r.Body).Decode(&lastBody)
+		switch r.URL.Path {
+		case "/notification/inbox":
+			w.Write([]byte(`{"payload":{"pager":{"totalRows":11,"totalPages":2},"notifications":[{"id":"5","templateType":"PERMIT_APPROVED","contractId":"38","status":"UNREAD","actions":[{"actionId":"VIEW"}]}]}}`))
+		case "/notification/inbox/unread/count":
+			w.Write([]byte(`{"payload":[{"contractId":"38","count":3},{"contractId":null,"count":2}]}`))
+		case "/notification/inbox/mark":
+			w.Write([]byte(`{"payload":{"rowAffected":2}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	v := viper.New()
+	v.Set(apiNotificationMdlUrlBase, srv.URL)
+	v.Set(inboxEnabledConfig, true)
+	apis.Init(v)
+
+	p := &pagination.Pagination{Limit: 10, Page: 2}
+	page, err := ListInboxNotifications("tk", *NewInboxCriteria().InContracts(38).UnreadOnly().Paginate(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Notifications) != 1 || page.Notifications[0].Id != 5 || page.Notifications[0].Actions[0].ActionID != "VIEW" {
+		t.Errorf("ListInboxNotifications() = %+v", page.Notifications)
+	}
+	if page.TotalRows != 11 || p.TotalPages != 2 {
+		t.Errorf("ListInboxNotifications() totalRows = %d, totalPages = %d", page.TotalRows, p.TotalPages)
+	}
+	if lastBody["page"] != float64(2) || lastBody["statuses"].([]interface{})[0] != InboxStatusUnread {
+		t.Errorf("ListInboxNotifications() sent %v", lastBody)
+	}
+
+	total, err := GetInboxUnreadTotal("tk")
+	if err != nil || total != 5 {
+		t.Errorf("GetInboxUnreadTotal() = %d, %v, want 5", total, err)
+	}
+
+	contractId := intstring.IntString(38)
+	n, err := MarkAllInboxRead("tk", &contractId)
+	if err != nil || n != 2 {
+		t.Errorf("MarkAllInboxRead() = %d, %v, want 2", n, err)
+	}
+	if lastBody["all"] != true || lastBody["status"] != InboxStatusRead {
+		t.Errorf("MarkAllInboxRead() sent %v", lastBody)
+	}
+
+	if _, err := MarkInboxNotifications("tk", InboxMark{Status: InboxStatusRead}); err == nil {
+		t.Error("MarkInboxNotifications() without ids should fail")
+	}
+	if _, err := ListInboxNotifications("tk", *NewInboxCriteria().WithStatus("DELETED")); err == nil {
+		t.Error("ListInboxNotifications() with invalid status should fail")
+	}
+}
+
+func TestInboxDisabled(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer srv.Close()
+	v := viper.New()
+	v.Set(apiNotificationMdlUrlBase, srv.URL)
+	apis.Init(v)
+
+	if _, err := GetInboxUnreadTotal("tk"); !errors.Is(err, ErrInboxDisabled) {
+		t.Errorf("GetInboxUnreadTotal() error = %v, want ErrInboxDisabled", err)
+	}
+	if _, err := MarkInboxRead("tk", 5); !errors.Is(err, ErrInboxDisabled) {
+		t.Errorf("MarkInboxRead() error = %v, want ErrInboxDisabled", err)
+	}
+	if requests != 0 {
+		t.Errorf("%d requests sent while the inbox is disabled", requests)
+	}
+}
@@ -0,0 +1,215 @@
+package notification
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"reflect"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/genericjson"
+	"github.com/Mobility-Development-Team/be-common-mdl/model"
+)
+
+type (
+	// TypedMailTemplate is implemented by the body struct of each mail template, e.g.
+	//
+	//	type PermitApprovedMail struct {
+	//		PermitNo string `json:"permitNo"`
+	//	}
+	//	func (PermitApprovedMail) Id() string { return "PERMIT_APPROVED" }
+	//	func (m PermitApprovedMail) Validate() error { ... }
+	TypedMailTemplate interface {
+		MailTemplate
+		Validate() error
+	}
+	// MailLayout is a local copy of a remote mail template used by RenderMail.
+	// Subjects and texts are text/template, htmls are html/template, all executed with the
+	// body merged with the language specific payload, fields are referred by their json name.
+	MailLayout struct {
+		TemplateId string
+		SubjectEn  string
+		SubjectZh  string
+		HtmlEn     string
+		HtmlZh     string
+		TextEn     string
+		TextZh     string
+	}
+	RenderedMail struct {
+		Lang    string
+		Subject string
+		Html    string
+		Text    string
+	}
+)
+
+var (
+	muMailLayouts sync.RWMutex
+	mailLayouts   = map[string]*compiledMailLayout{}
+)
+
+type compiledMailLayout struct {
+	subject map[string]*texttemplate.Template
+	html    map[string]*htmltemplate.Template
+	text    map[string]*texttemplate.Template
+}
+
+// MailLang returns the language of the mails sent to u, LangZh or LangEn
+func MailLang(u model.UserInfo) string {
+	if u.DefaultLang != nil && IsLangZh(*u.DefaultLang) {
+		return LangZh
+	}
+	return LangEn
+}
+
+// NewTypedMail creates a validated mail to u. bodyEn and bodyZh are merged into body by
+// the notification module according to the language of u, they may be nil if body
+// is not localized and are validated as well if they implement Validate() error.
+func NewTypedMail[T TypedMailTemplate, L any](u model.UserInfo, body T, bodyEn, bodyZh *L) (Mail, error) {
+	if u.Email == "" {
+		return Mail{}, fmt.Errorf("mail %s: user %s has no email", body.Id(), u.Id)
+	}
+	if err := validateMailTemplate(body); err != nil {
+		return Mail{}, err
+	}
+	m := Mail{
+		Recipients: []string{u.Email},
+		UserId:     u.Id,
+		Body:       body,
+	}
+	for _, localized := range []struct {
+		body *L
+		dst  *interface{}
+	}{{bodyEn, &m.BodyEn}, {bodyZh, &m.BodyZh}} {
+		if localized.body == nil {
+			continue
+		}
+		if reflect.Indirect(reflect.ValueOf(localized.body)).Kind() != reflect.Struct {
+			return Mail{}, fmt.Errorf("mail %s: localized body must be a struct, got %T", body.Id(), *localized.body)
+		}
+		if v, ok := interface{}(localized.body).(interface{ Validate() error }); ok {
+			if err := v.Validate(); err != nil {
+				return Mail{}, fmt.Errorf("mail %s: %w", body.Id(), err)
+			}
+		}
+		*localized.dst = *localized.body
+	}
+	return m, nil
+}
+
+// TrySetMail is SetMail but returns an error instead of ignoring the mails if they have different
+// templates or a TypedMailTemplate body fails validation. A mail without a body is rejected as
+// well, as its template id cannot be determined.
+func (n *Notification) TrySetMail(mail ...Mail) error {
+	if len(mail) == 0 {
+		return nil
+	}
+	templateId := ""
+	for i, m := range mail {
+		if m.Body == nil {
+			return fmt.Errorf("mail %d has no body", i)
+		}
+		if i == 0 {
+			templateId = m.Body.Id()
+		} else if m.Body.Id() != templateId {
+			return fmt.Errorf("sending mails with different templates (%s, %s) within the same notification is not supported", templateId, m.Body.Id())
+		}
+		if err := validateMailTemplate(m.Body); err != nil {
+			return err
+		}
+	}
+	n.WithMail = &MailOptions{
+		TemplateId: templateId,
+		Mails:      mail,
+	}
+	return nil
+}
+
+func validateMailTemplate(t MailTemplate) error {
+	typed, ok := t.(TypedMailTemplate)
+	if !ok {
+		return nil
+	}
+	if err := typed.Validate(); err != nil {
+		return fmt.Errorf("mail %s: %w", t.Id(), err)
+	}
+	return nil
+}
+
+// RegisterMailLayout parses and registers a layout for RenderMail, replacing any layout of the same template
+func RegisterMailLayout(l MailLayout) error {
+	if l.TemplateId == "" {
+		return errors.New("mail template id must not be empty")
+	}
+	c := &compiledMailLayout{
+		subject: map[string]*texttemplate.Template{},
+		html:    map[string]*htmltemplate.Template{},
+		text:    map[string]*texttemplate.Template{},
+	}
+	for _, src := range []struct {
+		lang, subject, html, text string
+	}{{LangEn, l.SubjectEn, l.HtmlEn, l.TextEn}, {LangZh, l.SubjectZh, l.HtmlZh, l.TextZh}} {
+		name := fmt.Sprintf("%s_%s", l.TemplateId, src.lang)
+		var err error
+		if c.subject[src.lang], err = texttemplate.New(name).Option("missingkey=error").Parse(src.subject); err != nil {
+			return fmt.Errorf("mail %s: invalid subject: %w", name, err)
+		}
+		if c.html[src.lang], err = htmltemplate.New(name).Option("missingkey=error").Parse(src.html); err != nil {
+			return fmt.Errorf("mail %s: invalid html: %w", name, err)
+		}
+		if c.text[src.lang], err = texttemplate.New(name).Option("missingkey=error").Parse(src.text); err != nil {
+			return fmt.Errorf("mail %s: invalid text: %w", name, err)
+		}
+	}
+	muMailLayouts.Lock()
+	defer muMailLayouts.Unlock()
+	mailLayouts[l.TemplateId] = c
+	return nil
+}
+
+// RenderMail renders m locally with its registered layout in lang (LangEn or LangZh), e.g. with
+// MailLang. It is intended for tests, the actual mail is rendered by the notification module.
+func RenderMail(m Mail, lang string) (*RenderedMail, error) {
+	if m.Body == nil {
+		return nil, errors.New("mail has no body")
+	}
+	muMailLayouts.RLock()
+	layout, ok := mailLayouts[m.Body.Id()]
+	muMailLayouts.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("mail layout %s is not registered", m.Body.Id())
+	}
+	lang = strings.ToLower(lang)
+	localized := m.BodyEn
+	if IsLangZh(lang) {
+		lang, localized = LangZh, m.BodyZh
+	} else {
+		lang = LangEn
+	}
+	data := genericjson.NewObject(m.Body)
+	if localized != nil {
+		if err := data.Merge(localized); err != nil {
+			return nil, fmt.Errorf("mail %s: unable to merge localized body: %w", m.Body.Id(), err)
+		}
+	}
+	result := &RenderedMail{Lang: lang}
+	var buf bytes.Buffer
+	for _, t := range []struct {
+		execute func() error
+		dst     *string
+	}{
+		{func() error { return layout.subject[lang].Execute(&buf, data) }, &result.Subject},
+		{func() error { return layout.html[lang].Execute(&buf, data) }, &result.Html},
+		{func() error { return layout.text[lang].Execute(&buf, data) }, &result.Text},
+	} {
+		buf.Reset()
+		if err := t.execute(); err != nil {
+			return nil, fmt.Errorf("mail %s: %w", m.Body.Id(), err)
+		}
+		*t.dst = buf.String()
+	}
+	return result, nil
+}
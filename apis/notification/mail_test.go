@@ -0,0 +1,127 @@
+package notification
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/model"
+	"github.com/Mobility-Development-Team/be-common-mdl/util/strutil"
+)
+
+type testPermitMail struct {
+	PermitNo string `json:"permitNo"`
+}
+
+func (testPermitMail) Id() string { return "TEST_PERMIT_APPROVED" }
+
+func (m testPermitMail) Validate() error {
+	if m.PermitNo == "" {
+		return errors.New("permitNo is required")
+	}
+	return nil
+}
+
+type testPermitMailLocalized struct {
+	Status string `json:"status"`
+}
+
+func TestTypedMail(t *testing.T) {
+	err := RegisterMailLayout(MailLayout{
+		TemplateId: "TEST_PERMIT_APPROVED",
+		SubjectEn:  "Permit {{.permitNo}} {{.status}}",
+		SubjectZh:  "許可證 {{.permitNo}} {{.status}}",
+		HtmlEn:     "<p>Permit <b>{{.permitNo}}</b> is {{.status}}</p>",
+		HtmlZh:     "<p>許可證 <b>{{.permitNo}}</b> {{.status}}</p>",
+		TextEn:     "Permit {{.permitNo}} is {{.status}}",
+		TextZh:     "許可證 {{.permitNo}} {{.status}}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	en := &testPermitMailLocalized{Status: "approved"}
+	zh := &testPermitMailLocalized{Status: "已批准"}
+	tests := []struct {
+		name    string
+		user    model.UserInfo
+		body    testPermitMail
+		want    RenderedMail
+		wantErr bool
+	}{
+		{
+			name: "English",
+			user: model.UserInfo{Email: "a@example.com", DefaultLang: strutil.NewPtr("en")},
+			body: testPermitMail{PermitNo: "<PTW-001>"},
+			want: RenderedMail{
+				Lang:    LangEn,
+				Subject: "Permit <PTW-001> approved",
+				Html:    "<p>Permit <b>&lt;PTW-001&gt;</b> is approved</p>",
+				Text:    "Permit <PTW-001> is approved",
+			},
+		},
+		{
+			name: "Chinese",
+			user: model.UserInfo{Email: "a@example.com", DefaultLang: strutil.NewPtr("zh-HK")},
+			body: testPermitMail{PermitNo: "PTW-001"},
+			want: RenderedMail{
+				Lang:    LangZh,
+				Subject: "許可證 PTW-001 已批准",
+				Html:    "<p>許可證 <b>PTW-001</b> 已批准</p>",
+				Text:    "許可證 PTW-001 已批准",
+			},
+		},
+		{
+			name:    "Invalid body",
+			user:    model.UserInfo{Email: "a@example.com"},
+			wantErr: true,
+		},
+		{
+			name:    "No email",
+			body:    testPermitMail{PermitNo: "PTW-001"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewTypedMail(tt.user, tt.body, en, zh)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewTypedMail() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got, err := RenderMail(m, MailLang(tt.user))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != tt.want {
+				t.Errorf("RenderMail() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrySetMail(t *testing.T) {
+	valid := Mail{Body: testPermitMail{PermitNo: "PTW-001"}}
+	tests := []struct {
+		name    string
+		mails   []Mail
+		wantErr bool
+	}{
+		{name: "Valid", mails: []Mail{valid, valid}},
+		{name: "Mixed templates", mails: []Mail{valid, {Body: NewMailTemplate("OTHER", nil)}}, wantErr: true},
+		{name: "Invalid typed body", mails: []Mail{{Body: testPermitMail{}}}, wantErr: true},
+		{name: "No body", mails: []Mail{{}}, wantErr: true},
+		{name: "Empty template id", mails: []Mail{{Body: QuickMailTemplate{}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := NewNotification(nil, "PERMIT_APPROVED")
+			if err := n.TrySetMail(tt.mails...); (err != nil) != tt.wantErr {
+				t.Fatalf("TrySetMail() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (n.WithMail == nil) != tt.wantErr {
+				t.Errorf("WithMail = %v", n.WithMail)
+			}
+		})
+	}
+}
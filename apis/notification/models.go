@@ -1,10 +1,16 @@
 package notification
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+	"github.com/Mobility-Development-Team/be-common-mdl/util/arrutil"
 	"github.com/Mobility-Development-Team/be-common-mdl/util/strutil"
 	logger "github.com/sirupsen/logrus"
 )
@@ -26,6 +32,8 @@ type (
 		WithPush            []*CloudMessage      `json:"withPush"`
 		AutoPush            *AutoPushParams      `json:"autoPush"`
 		EnableExtraSendUser bool                 `json:"enableExtraSendUser"`
+		// Set by SetupEnableExtraSendUser, takes precedence over the extra send rules if not nil
+		ExtraSendOverride *bool `json:"-"`
 
 		// Setting this to true will not ignore the sender (caller of this API) if the sender
 		// is the recipient user or as a group member of the recipent group / party.
@@ -34,6 +42,19 @@ type (
 
 		// Setting this to true allows the notification to be submitted even if the recipients are emptyd
 		PermitEmptyRecipients bool `json:"-"`
+
+		// Sent to the notification module to identify the notification. The notification module
+		// does not define whether or for how long it drops a notification with a key it has
+		// already received, hence the key does not make a retry safe and CreateNotifications
+		// never retries. Empty unless set by SetIdempotencyKey or UseGeneratedIdempotencyKey,
+		// or by EnqueueNotifications for enqueued notifications.
+		IdempotencyKey string `json:"idempotencyKey,omitempty"`
+
+		// Only honoured by EnqueueNotifications, the notification is sent at SendAt and dropped if
+		// it cannot be sent before ExpiresAt. CreateNotifications skips a notification with SendAt
+		// in the future and ignores ExpiresAt.
+		SendAt    *time.Time `json:"-"`
+		ExpiresAt *time.Time `json:"-"`
 	}
 	Recipients struct {
 		Users      []intstring.IntString `json:"users"`
@@ -128,23 +149,13 @@ func (n *Notification) AddAction(actionId, actionLabel interface{}, optActionTyp
 }
 
 // Attaches a mail payload to the notification.
-// All mails MUST be of the same template id.
+// All mails MUST be of the same template id, otherwise they are
+// ignored with an error logged. Use TrySetMail to handle the error.
 // Note that the notification module may decide not to send
 // the email even though it is provided.
 func (n *Notification) SetMail(mail ...Mail) *Notification {
-	if len(mail) == 0 {
-		return n
-	}
-	templateId := mail[0].Body.Id()
-	for _, m := range mail[1:] {
-		if m.Body.Id() != templateId {
-			logger.Error("[SetMail] Sending mails with different templates within the same notification is not supported, mail ignored...")
-			return n
-		}
-	}
-	n.WithMail = &MailOptions{
-		TemplateId: templateId,
-		Mails:      mail,
+	if err := n.TrySetMail(mail...); err != nil {
+		logger.Error("[SetMail] Mail ignored: ", err)
 	}
 	return n
 }
@@ -159,7 +170,7 @@ func (n *Notification) AllowEmptyRecipients() *Notification {
 	return n
 }
 
-// Note: Use GeneratePush if possible unless the default behavior is not preffered
+// Note: Use NewPushBuilder if possible unless the default behavior is not preffered
 //
 // Attaches a push notification payload to the notification.
 // Note that the notification module may decide not to send
@@ -188,8 +199,69 @@ func (n *Notification) AttachPushAutoDefault(additionalBody ...string) *Notifica
 	return n
 }
 
+// SetIdempotencyKey sets the key explicitly, e.g. derived from the business event causing the
+// notification. The key is prefixed with the environment by AppendRefKeyWithEnvironment.
+func (n *Notification) SetIdempotencyKey(refKey string) *Notification {
+	n.IdempotencyKey = AppendRefKeyWithEnvironment(refKey)
+	return n
+}
+
+// UseGeneratedIdempotencyKey sets the key generated by GenerateIdempotencyKey. Note that identical
+// notifications then share the same key and may be dropped by the notification module as duplicates
+// if it deduplicates them, hence it must only be used for notifications that are never repeated intentionally.
+func (n *Notification) UseGeneratedIdempotencyKey() *Notification {
+	n.IdempotencyKey = n.GenerateIdempotencyKey()
+	return n
+}
+
+// GenerateIdempotencyKey generates a key from the contract, template type, params and recipients.
+// The order of the recipients does not affect the key.
+func (n *Notification) GenerateIdempotencyKey() string {
+	sorted := func(ids []intstring.IntString) []intstring.IntString {
+		result := arrutil.Unique(ids)
+		sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+		return result
+	}
+	b, err := json.Marshal(struct {
+		ContractID   *intstring.IntString `json:"contractId"`
+		TemplateType string               `json:"templateType"`
+		Params       NotificationParams   `json:"params"`
+		Recipients   Recipients           `json:"recipients"`
+	}{
+		ContractID:   n.ContractID,
+		TemplateType: n.TemplateType,
+		Params:       n.Params,
+		Recipients: Recipients{
+			Users:      sorted(n.Recipients.Users),
+			Groups:     sorted(n.Recipients.Groups),
+			PartyAdmin: sorted(n.Recipients.PartyAdmin),
+		},
+	})
+	if err != nil {
+		// Params cannot be marshalled, the notification module would fail anyway
+		logger.Errorf("[GenerateIdempotencyKey] Unable to marshal notification %s: %v", n.TemplateType, err)
+		return ""
+	}
+	sum := sha256.Sum256(b)
+	return AppendRefKeyWithEnvironment(hex.EncodeToString(sum[:]))
+}
+
+// SetSendAt delays the notification until t, see EnqueueNotifications
+func (n *Notification) SetSendAt(t time.Time) *Notification {
+	n.SendAt = &t
+	return n
+}
+
+// SetExpiresAt drops the notification if it is not sent before t, see EnqueueNotifications
+func (n *Notification) SetExpiresAt(t time.Time) *Notification {
+	n.ExpiresAt = &t
+	return n
+}
+
+// SetupEnableExtraSendUser overrides the extra send rules for this notification, see ExtraSendRule
 func (n *Notification) SetupEnableExtraSendUser(extra bool) *Notification {
 	n.EnableExtraSendUser = extra
+	n.ExtraSendOverride = &extra
 	return n
 }
 
@@ -0,0 +1,61 @@
+package notification
+
+import (
+	"testing"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/apis"
+	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+	"github.com/spf13/viper"
+)
+
+func TestGenerateIdempotencyKey(t *testing.T) {
+	v := viper.New()
+	v.Set("env.short", "dev")
+	apis.Init(v)
+	contractId := intstring.IntString(38)
+	base := func() *Notification {
+		return NewNotification(&contractId, "PERMIT_APPROVED", "PTW-001", 3).
+			AddUserRecipient(12, 179).
+			AddGroupRecipient(5)
+	}
+	key := base().GenerateIdempotencyKey()
+	tests := []struct {
+		name     string
+		noti     *Notification
+		wantSame bool
+	}{
+		{
+			name:     "Identical",
+			noti:     base(),
+			wantSame: true,
+		},
+		{
+			name:     "Recipients reordered and duplicated",
+			noti:     NewNotification(&contractId, "PERMIT_APPROVED", "PTW-001", 3).AddUserRecipient(179, 12, 12).AddGroupRecipient(5),
+			wantSame: true,
+		},
+		{
+			name: "Different params",
+			noti: NewNotification(&contractId, "PERMIT_APPROVED", "PTW-002", 3).AddUserRecipient(12, 179).AddGroupRecipient(5),
+		},
+		{
+			name: "Different recipients",
+			noti: base().AddPartyAdminRecipient(2),
+		},
+		{
+			name: "Different template",
+			noti: NewNotification(&contractId, "PERMIT_REJECTED", "PTW-001", 3).AddUserRecipient(12, 179).AddGroupRecipient(5),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.noti.GenerateIdempotencyKey()
+			if (got == key) != tt.wantSame {
+				t.Errorf("GenerateIdempotencyKey() = %s, base key = %s, wantSame %v", got, key, tt.wantSame)
+			}
+		})
+	}
+	if explicit := base().SetIdempotencyKey("permit-1").IdempotencyKey; explicit != "dev-permit-1" {
+		t.Errorf("SetIdempotencyKey() = %s", explicit)
+	}
+}
@@ -1,8 +1,9 @@
 package notification
 
 import (
+	"errors"
 	"fmt"
-	"strings"
+	"time"
 
 	"github.com/Mobility-Development-Team/be-common-mdl/apis"
 	"github.com/Mobility-Development-Team/be-common-mdl/apis/core"
@@ -44,7 +45,7 @@ func handleExtraNotification(tk string, notifications ...*Notification) (map[int
 	var extraContractIDs []intstring.IntString
 	// 循环取出需要去检查的项目
 	for _, notification := range notifications {
-		if notification.EnableExtraSendUser {
+		if notification.EnableExtraSendUser && notification.ContractID != nil {
 			extraContractIDs = append(extraContractIDs, *notification.ContractID)
 		}
 	}
@@ -52,15 +53,10 @@ func handleExtraNotification(tk string, notifications ...*Notification) (map[int
 		return contractUserIDMap, nil
 	}
 	// 查询配置的 contract 是否能开启发送额外用户，有组装map返回
-	req := map[string]interface{}{
-		"contractIds":         extraContractIDs,
-		"contractIsExtraSend": ContractIsExtraSendOn,
-		"userIsExtraSend":     UserIsExtraSendOn,
-		"userStatus":          UserStatusActive,
-		"contractStatus":      ContractStatusActive,
-	}
-	userDetails, err := core.GetManyContractMapUsers(
-		tk, req)
+	criteria := core.NewContractUserMapCriteria(extraContractIDs...).
+		WithExtraSend(ContractIsExtraSendOn, UserIsExtraSendOn).
+		WithStatus(ContractStatusActive, UserStatusActive)
+	userDetails, err := core.GetManyContractMapUsersByCriteria(tk, *criteria)
 	if err != nil {
 		return nil, err
 	}
@@ -71,42 +67,75 @@ func handleExtraNotification(tk string, notifications ...*Notification) (map[int
 	return contractUserIDMap, nil
 }
 
-// checkSuffix 判断哪些是需要根据额外发送配置去发送额外用户的
-func checkSuffix(typeName string) bool {
-	suffixes := []string{"_APPROVED", "_ACCEPTED", "_REJECTED", "_CANCELLED"}
-	for _, suffix := range suffixes {
-		if strings.HasSuffix(typeName, suffix) {
-			return true
-		}
-	}
-	return false
-}
+// ErrNotificationSkipped is returned by the outbox when a notification would be skipped by
+// CreateNotifications, e.g. because it does not match its template or has no recipients
+var ErrNotificationSkipped = errors.New("notification skipped")
+
+// CreateNotifications sends the notifications to the notification module.
+//
+// The request is sent once and not retried on failure, even if the notifications carry an
+// idempotency key, as the notification module does not guarantee any window within which it
+// drops duplicates. Use EnqueueNotifications for a reliable delivery. Notifications with
+// SendAt in the future are skipped, they can only be scheduled with EnqueueNotifications.
 func CreateNotifications(tk string, notifications ...*Notification) error {
-	validNotifications := make([]*Notification, 0, len(notifications))
+	return createNotifications(tk, false, notifications...)
+}
+
+// createNotifications is CreateNotifications, if strict is set, nothing is sent and an error
+// wrapping ErrNotificationSkipped is returned instead of skipping a notification
+func createNotifications(tk string, strict bool, notifications ...*Notification) error {
+	nonNil := make([]*Notification, 0, len(notifications))
 	for _, notification := range notifications {
-		notification.SetupEnableExtraSendUser(checkSuffix(notification.TemplateType))
+		if notification == nil {
+			if strict {
+				return fmt.Errorf("%w: notification is nil", ErrNotificationSkipped)
+			}
+			logger.Warn("[CreateNotification] Skipped: notifcation is nil.")
+			continue
+		}
+		applyExtraSendPolicy(notification)
+		nonNil = append(nonNil, notification)
 	}
-	contractUserIDMap, err := handleExtraNotification(tk, notifications...)
+	contractUserIDMap, err := handleExtraNotification(tk, nonNil...)
 	if err != nil {
 		logger.Warn(fmt.Sprintf("[CreateNotification] Skipped: extra notifcation has error: %v", err))
 		return err
 	}
-	for _, noti := range notifications {
-		if noti == nil {
-			logger.Warn("[CreateNotification] Skipped: notifcation is nil.")
-			continue
-		}
+	validNotifications := make([]*Notification, 0, len(nonNil))
+	for _, noti := range nonNil {
 		if noti.TemplateType == "" {
+			if strict {
+				return fmt.Errorf("%w: notification does not have a templateType", ErrNotificationSkipped)
+			}
 			logger.Warn("[CreateNotification] Skipped: notifcation does not have a templateType: ", *noti)
 			continue
 		}
+		if noti.SendAt != nil && noti.SendAt.After(time.Now()) {
+			if strict {
+				return fmt.Errorf("%w: notification %s is scheduled", ErrNotificationSkipped, noti.TemplateType)
+			}
+			logger.Error("[CreateNotification] Skipped: scheduled notification must be sent with EnqueueNotifications: ", noti.TemplateType)
+			continue
+		}
+		if err := noti.Validate(); err != nil {
+			if strict {
+				return fmt.Errorf("%w: %v", ErrNotificationSkipped, err)
+			}
+			logger.Error("[CreateNotification] Skipped: notification does not match its template: ", err)
+			continue
+		}
 		if !noti.PermitEmptyRecipients && len(noti.Recipients.Groups) == 0 && len(noti.Recipients.Users) == 0 && len(noti.Recipients.PartyAdmin) == 0 {
+			if strict {
+				return fmt.Errorf("%w: notification %s has no recipients", ErrNotificationSkipped, noti.TemplateType)
+			}
 			logger.Debug("[CreateNotification] Notification has no recipents, ignoring: ", noti.TemplateType)
 			continue
 		}
 		// 项目开启配置有配置额外发送人且GetExtraSendUser is True额外发送
-		if extraUserIds, exist := contractUserIDMap[*noti.ContractID]; exist && noti.EnableExtraSendUser {
-			noti.AddUserRecipient(extraUserIds...)
+		if noti.ContractID != nil && noti.EnableExtraSendUser {
+			if extraUserIds, exist := contractUserIDMap[*noti.ContractID]; exist {
+				noti.AddUserRecipient(extraUserIds...)
+			}
 		}
 
 		validNotifications = append(validNotifications, noti)
@@ -119,20 +148,11 @@ func CreateNotifications(tk string, notifications ...*Notification) error {
 	return createOneOrManyNotifications(tk, validNotifications)
 }
 
+// createOneOrManyNotifications sends body once. The request is never retried, since the
+// notification module does not define for how long it drops a notification with a known
+// idempotency key, if at all, and a retried request may deliver the notifications twice.
 func createOneOrManyNotifications(tk string, body interface{}) error {
 	client := common.NewResty()
-	// Set retries (base on legor requiremnt since duplicate notifications)
-	// client.
-	// 	SetRetryCount(5).
-	// 	SetRetryWaitTime(5 * time.Minute).
-	// 	SetRetryMaxWaitTime(10 * time.Minute).
-	// 	AddRetryCondition(func(r *resty.Response, err error) bool {
-	// 		if !r.IsSuccess() {
-	// 			logger.Warnf("[CreateNotification]: API returns status code %d. Retrying...", r.StatusCode())
-	// 			return true
-	// 		}
-	// 		return false
-	// 	})
 	// Send request
 	result, err := client.R().
 		SetAuthToken(tk).
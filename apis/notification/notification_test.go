@@ -0,0 +1,67 @@
+package notification
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/apis"
+	"github.com/spf13/viper"
+)
+
+func TestCreateNotifications(t *testing.T) {
+	var keys []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body []Notification
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		for _, n := range body {
+			keys = append(keys, n.IdempotencyKey)
+		}
+	}))
+	defer srv.Close()
+	v := viper.New()
+	v.Set("env.short", "dev")
+	v.Set("apis.internal.notification.module.url.base", srv.URL)
+	apis.Init(v)
+
+	notice := func() *Notification {
+		return NewNotification(nil, "TEST_NOTICE", "PTW-001").AddUserRecipient(12)
+	}
+	// A nil notification is skipped, identical notifications are not given the same key
+	if err := CreateNotifications("tk", nil, notice(), notice(), notice().UseGeneratedIdempotencyKey()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"", "", notice().GenerateIdempotencyKey()}
+	if len(keys) != len(want) {
+		t.Fatalf("keys = %q, want %q", keys, want)
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Errorf("keys = %q, want %q", keys, want)
+		}
+	}
+}
+
+func TestCreateNotificationsNotRetried(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	v := viper.New()
+	v.Set("env.short", "dev")
+	v.Set("apis.internal.notification.module.url.base", srv.URL)
+	apis.Init(v)
+
+	noti := NewNotification(nil, "TEST_NOTICE", "PTW-001").AddUserRecipient(12).UseGeneratedIdempotencyKey()
+	if err := CreateNotifications("tk", noti); err == nil {
+		t.Error("CreateNotifications() error = nil, want an error")
+	}
+	if requests != 1 {
+		t.Errorf("%d requests sent, want 1", requests)
+	}
+}
@@ -0,0 +1,425 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+	logger "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Statuses of OutboxRecord
+const (
+	OutboxStatusPending = "PENDING"
+	OutboxStatusSent    = "SENT"
+	OutboxStatusFailed  = "FAILED"
+	// Cancelled by CancelNotifications before being sent
+	OutboxStatusCancelled = "CANCELLED"
+	// Not sent before Notification.ExpiresAt
+	OutboxStatusExpired = "EXPIRED"
+)
+
+const (
+	defaultOutboxBatchSize   = 20
+	defaultOutboxInterval    = 10 * time.Second
+	defaultOutboxMaxAttempts = 8
+	defaultOutboxBaseBackoff = 30 * time.Second
+	defaultOutboxMaxBackoff  = time.Hour
+	defaultOutboxClaimTTL    = 10 * time.Minute
+)
+
+// OutboxRecord is a notification persisted by EnqueueNotifications and waiting to be sent
+// by an OutboxDispatcher. Use AutoMigrateOutbox to create the table.
+type OutboxRecord struct {
+	Id             intstring.IntString `gorm:"primaryKey" json:"id"`
+	CreatedAt      time.Time           `json:"createdAt"`
+	UpdatedAt      time.Time           `json:"updatedAt"`
+	IdempotencyKey string              `gorm:"size:191;uniqueIndex" json:"idempotencyKey"`
+	RefKey         string              `gorm:"size:191;index" json:"refKey"`
+	Generation     int                 `gorm:"not null;default:0" json:"generation"` // Incremented when RefKey is enqueued again after a cancel
+	Payload        string              `gorm:"type:text" json:"payload"`
+	// Fields of Notification that are not part of the payload
+	PermitEmptyRecipients bool       `json:"permitEmptyRecipients"`
+	ExtraSendOverride     *bool      `json:"extraSendOverride"`
+	Status                string     `gorm:"size:16;index:idx_notification_outbox_due,priority:1" json:"status"`
+	NextAttemptAt         time.Time  `gorm:"index:idx_notification_outbox_due,priority:2" json:"nextAttemptAt"`
+	Attempts              int        `json:"attempts"`
+	LastError             *string    `gorm:"type:text" json:"lastError"`
+	SentAt                *time.Time `json:"sentAt"`
+	ExpiresAt             *time.Time `json:"expiresAt"`
+}
+
+func (OutboxRecord) TableName() string {
+	return "notification_outbox"
+}
+
+func AutoMigrateOutbox(db *gorm.DB) error {
+	return db.AutoMigrate(&OutboxRecord{})
+}
+
+// EnqueueNotifications persists notifications with tx, which should be the caller's own
+// transaction, so that the notifications are only sent if the transaction commits.
+//
+// refKey identifies the business event causing the notifications (e.g. "permit-123-APPROVED"),
+// the idempotency key of each notification is derived from it with AppendRefKeyWithEnvironment
+// unless it is set explicitly with SetIdempotencyKey.
+// Enqueuing the same refKey again is a no-op, hence it is safe to retry the caller's transaction.
+// Once notifications of refKey have been cancelled, enqueuing refKey again starts a new generation
+// with new idempotency keys, so that e.g. a reminder can be set up again. Explicit keys are used
+// as is, they must be changed to send the notifications again.
+//
+// Notifications with SendAt are not sent before that time, e.g. for reminders, and those with
+// ExpiresAt are dropped if they are not sent in time. Pending notifications can be revoked with
+// CancelNotifications or delayed with RescheduleNotifications using the same refKey.
+func EnqueueNotifications(tx *gorm.DB, refKey string, notifications ...*Notification) error {
+	if refKey == "" {
+		return errors.New("refKey must not be empty")
+	}
+	generation, err := outboxGeneration(tx, refKey)
+	if err != nil {
+		return err
+	}
+	records := make([]OutboxRecord, 0, len(notifications))
+	now := time.Now()
+	for i, noti := range notifications {
+		if noti == nil {
+			logger.Warn("[EnqueueNotifications] Skipped: notifcation is nil.")
+			continue
+		}
+		record, err := newOutboxRecord(refKey, generation, i, noti, now)
+		if err != nil {
+			return err
+		}
+		records = append(records, record)
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&records).Error
+}
+
+// outboxGeneration returns the generation to enqueue refKey with, which is the latest one unless
+// any of its notifications has been cancelled
+func outboxGeneration(tx *gorm.DB, refKey string) (int, error) {
+	var latest []struct {
+		Generation int
+		Cancelled  int64
+	}
+	if err := tx.Model(&OutboxRecord{}).
+		Select("generation, COUNT(CASE WHEN status = ? THEN 1 END) AS cancelled", OutboxStatusCancelled).
+		Where("ref_key = ?", refKey).
+		Group("generation").
+		Order("generation DESC").
+		Limit(1).
+		Find(&latest).Error; err != nil {
+		return 0, err
+	}
+	if len(latest) == 0 {
+		return 0, nil
+	}
+	if latest[0].Cancelled > 0 {
+		return latest[0].Generation + 1, nil
+	}
+	return latest[0].Generation, nil
+}
+
+// newOutboxRecord creates the record of the i-th notification enqueued with refKey. The payload is
+// validated as the dispatcher decodes it, so a notification which does not survive the round trip
+// is rejected now instead of failing when it is sent.
+func newOutboxRecord(refKey string, generation, i int, noti *Notification, now time.Time) (OutboxRecord, error) {
+	payload, err := json.Marshal(noti)
+	if err != nil {
+		return OutboxRecord{}, fmt.Errorf("unable to marshal notification %s: %w", noti.TemplateType, err)
+	}
+	var decoded Notification
+	if err := json.Unmarshal(payload, &decoded); err != nil {
+		return OutboxRecord{}, fmt.Errorf("unable to unmarshal notification %s: %w", noti.TemplateType, err)
+	}
+	if err := decoded.Validate(); err != nil {
+		return OutboxRecord{}, err
+	}
+	key := noti.IdempotencyKey
+	if key == "" && generation == 0 {
+		key = AppendRefKeyWithEnvironment(fmt.Sprintf("%s-%d", refKey, i))
+	} else if key == "" {
+		key = AppendRefKeyWithEnvironment(fmt.Sprintf("%s-g%d-%d", refKey, generation, i))
+	}
+	nextAttemptAt := now
+	if noti.SendAt != nil && noti.SendAt.After(now) {
+		nextAttemptAt = *noti.SendAt
+	}
+	return OutboxRecord{
+		IdempotencyKey:        key,
+		RefKey:                refKey,
+		Generation:            generation,
+		Payload:               string(payload),
+		PermitEmptyRecipients: noti.PermitEmptyRecipients,
+		ExtraSendOverride:     noti.ExtraSendOverride,
+		Status:                OutboxStatusPending,
+		NextAttemptAt:         nextAttemptAt,
+		ExpiresAt:             noti.ExpiresAt,
+	}, nil
+}
+
+// CancelNotifications cancels the pending notifications enqueued with refKey, e.g. when a permit
+// is closed before its expiry reminder is sent. It returns the number of notifications cancelled.
+//
+// A notification being sent by an OutboxDispatcher at that moment is counted as cancelled and
+// stays CANCELLED, but may still be delivered. Enqueuing refKey again then starts a new generation
+// regardless, so the notification may be received from both generations.
+func CancelNotifications(tx *gorm.DB, refKey string) (int64, error) {
+	result := tx.Model(&OutboxRecord{}).
+		Where("ref_key = ? AND status = ?", refKey, OutboxStatusPending).
+		Update("status", OutboxStatusCancelled)
+	return result.RowsAffected, result.Error
+}
+
+// RescheduleNotifications changes the time the pending notifications enqueued with refKey are sent.
+// It returns the number of notifications rescheduled.
+//
+// A notification already claimed by an OutboxDispatcher is sent regardless of the new time, and
+// if sending it fails, its next attempt follows the backoff of the dispatcher instead.
+func RescheduleNotifications(tx *gorm.DB, refKey string, sendAt time.Time) (int64, error) {
+	result := tx.Model(&OutboxRecord{}).
+		Where("ref_key = ? AND status = ?", refKey, OutboxStatusPending).
+		Update("next_attempt_at", sendAt)
+	return result.RowsAffected, result.Error
+}
+
+// OutboxDispatcher sends the notifications persisted by EnqueueNotifications.
+//
+// Multiple dispatchers can run against the same table. Due records are claimed with
+// SELECT ... FOR UPDATE SKIP LOCKED in a short transaction, which postpones them by ClaimTTL,
+// and are sent after the transaction commits. A record is sent again if its dispatcher stops
+// before updating it, or if the notification module fails after receiving it. The delivery is
+// hence at least once: the idempotency key is sent along, but the notification module does not
+// guarantee to drop duplicates.
+// The status of a claimed record is checked again right before it is sent, and its outcome is only
+// saved if it is still PENDING, so that a record cancelled while being sent stays CANCELLED.
+type OutboxDispatcher struct {
+	DB *gorm.DB
+	// Token returns the token used for calling the notification module
+	Token       func() (string, error)
+	BatchSize   int           // Defaults to 20
+	Interval    time.Duration // Time between polls, defaults to 10s
+	MaxAttempts int           // Records are marked as FAILED after this many attempts, defaults to 8
+	BaseBackoff time.Duration // Delay after the first failure, doubled on each attempt, defaults to 30s
+	MaxBackoff  time.Duration // Defaults to 1h
+	// Claimed records are not picked up by any dispatcher for this long, it must be longer
+	// than sending a batch takes. Defaults to 10m.
+	ClaimTTL time.Duration
+}
+
+// NewOutboxDispatcher creates a dispatcher with the default settings, db and token are required
+func NewOutboxDispatcher(db *gorm.DB, token func() (string, error)) (*OutboxDispatcher, error) {
+	if db == nil {
+		return nil, errors.New("outbox dispatcher requires a db")
+	}
+	if token == nil {
+		return nil, errors.New("outbox dispatcher requires a token")
+	}
+	return &OutboxDispatcher{DB: db, Token: token}, nil
+}
+
+// Run dispatches pending records every Interval until ctx is done
+func (d *OutboxDispatcher) Run(ctx context.Context) {
+	interval := d.Interval
+	if interval <= 0 {
+		interval = defaultOutboxInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := d.DispatchOnce(ctx); err != nil {
+			logger.Error("[OutboxDispatcher] Dispatch failed: ", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DispatchOnce sends up to BatchSize due records and returns the number of records sent
+func (d *OutboxDispatcher) DispatchOnce(ctx context.Context) (int, error) {
+	if d.DB == nil || d.Token == nil {
+		return 0, errors.New("outbox dispatcher requires a db and a token, see NewOutboxDispatcher")
+	}
+	tk, err := d.Token()
+	if err != nil {
+		return 0, fmt.Errorf("unable to get token: %w", err)
+	}
+	records, err := d.claim(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return d.dispatch(ctx, tk, records)
+}
+
+// dispatch sends the claimed records and saves their outcome
+func (d *OutboxDispatcher) dispatch(ctx context.Context, tk string, records []OutboxRecord) (int, error) {
+	sent := 0
+	var updateErr error
+	for i := range records {
+		record := &records[i]
+		status, err := d.currentStatus(ctx, record)
+		if err != nil {
+			logger.Errorf("[OutboxDispatcher] Unable to check notification %s: %v", record.IdempotencyKey, err)
+			updateErr = err
+			continue
+		}
+		if status != OutboxStatusPending {
+			logger.Infof("[OutboxDispatcher] Skipped notification %s: %s since it was claimed", record.IdempotencyKey, status)
+			record.Status = status
+			continue
+		}
+		if d.send(tk, record) {
+			sent++
+		}
+		saved, err := d.saveOutcome(ctx, record)
+		if err != nil {
+			logger.Errorf("[OutboxDispatcher] Unable to update notification %s: %v", record.IdempotencyKey, err)
+			updateErr = err
+			continue
+		}
+		if !saved {
+			logger.Warnf("[OutboxDispatcher] Notification %s was cancelled while being sent, %s is not saved", record.IdempotencyKey, record.Status)
+			record.Status = OutboxStatusCancelled
+		}
+	}
+	return sent, updateErr
+}
+
+// currentStatus returns the status of the record in the db, which is no longer PENDING if the
+// record has been cancelled since it was claimed
+func (d *OutboxDispatcher) currentStatus(ctx context.Context, record *OutboxRecord) (string, error) {
+	var statuses []string
+	if err := d.DB.WithContext(ctx).Model(&OutboxRecord{}).
+		Where("id = ?", record.Id).
+		Pluck("status", &statuses).Error; err != nil {
+		return "", err
+	}
+	if len(statuses) == 0 {
+		return "", fmt.Errorf("notification %s no longer exists", record.IdempotencyKey)
+	}
+	return statuses[0], nil
+}
+
+// saveOutcome updates the record with the outcome of send if it is still PENDING, false is
+// returned if it is not, i.e. it has been cancelled in the meantime
+func (d *OutboxDispatcher) saveOutcome(ctx context.Context, record *OutboxRecord) (bool, error) {
+	result := d.DB.WithContext(ctx).Model(&OutboxRecord{}).
+		Where("id = ? AND status = ?", record.Id, OutboxStatusPending).
+		Updates(map[string]interface{}{
+			"status":          record.Status,
+			"attempts":        record.Attempts,
+			"next_attempt_at": record.NextAttemptAt,
+			"last_error":      record.LastError,
+			"sent_at":         record.SentAt,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// claim locks up to BatchSize due records and postpones them by ClaimTTL, so that no dispatcher
+// picks them up while they are being sent. The locks are released before returning.
+func (d *OutboxDispatcher) claim(ctx context.Context) ([]OutboxRecord, error) {
+	batchSize := d.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultOutboxBatchSize
+	}
+	claimTTL := d.ClaimTTL
+	if claimTTL <= 0 {
+		claimTTL = defaultOutboxClaimTTL
+	}
+	var records []OutboxRecord
+	err := d.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", OutboxStatusPending, now).
+			Order("next_attempt_at").
+			Limit(batchSize).
+			Find(&records).Error; err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			return nil
+		}
+		ids := make([]intstring.IntString, len(records))
+		for i := range records {
+			ids[i] = records[i].Id
+			records[i].NextAttemptAt = now.Add(claimTTL)
+		}
+		return tx.Model(&OutboxRecord{}).Where("id IN ?", ids).Update("next_attempt_at", now.Add(claimTTL)).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// send sends one record and updates its status accordingly, returns true if it is sent.
+// A record which CreateNotifications would skip is marked as FAILED without retrying.
+func (d *OutboxDispatcher) send(tk string, record *OutboxRecord) bool {
+	if record.ExpiresAt != nil && time.Now().After(*record.ExpiresAt) {
+		logger.Infof("[OutboxDispatcher] Dropped notification %s: expired at %s", record.IdempotencyKey, record.ExpiresAt.Format(time.RFC3339))
+		record.Status = OutboxStatusExpired
+		return false
+	}
+	record.Attempts++
+	var noti Notification
+	err := json.Unmarshal([]byte(record.Payload), &noti)
+	if err == nil {
+		noti.PermitEmptyRecipients = record.PermitEmptyRecipients
+		noti.ExtraSendOverride = record.ExtraSendOverride
+		noti.IdempotencyKey = record.IdempotencyKey
+		err = createNotifications(tk, true, &noti)
+	} else {
+		err = fmt.Errorf("%w: %v", ErrNotificationSkipped, err)
+	}
+	if err == nil {
+		now := time.Now()
+		record.Status = OutboxStatusSent
+		record.SentAt = &now
+		record.LastError = nil
+		return true
+	}
+	msg := err.Error()
+	record.LastError = &msg
+	maxAttempts := d.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultOutboxMaxAttempts
+	}
+	if record.Attempts >= maxAttempts || errors.Is(err, ErrNotificationSkipped) {
+		logger.Errorf("[OutboxDispatcher] Giving up notification %s after %d attempts: %s", record.IdempotencyKey, record.Attempts, msg)
+		record.Status = OutboxStatusFailed
+		return false
+	}
+	record.NextAttemptAt = time.Now().Add(d.backoff(record.Attempts))
+	logger.Warnf("[OutboxDispatcher] Failed sending notification %s (attempt %d), retrying at %s: %s",
+		record.IdempotencyKey, record.Attempts, record.NextAttemptAt.Format(time.RFC3339), msg)
+	return false
+}
+
+func (d *OutboxDispatcher) backoff(attempts int) time.Duration {
+	base, max := d.BaseBackoff, d.MaxBackoff
+	if base <= 0 {
+		base = defaultOutboxBaseBackoff
+	}
+	if max <= 0 {
+		max = defaultOutboxMaxBackoff
+	}
+	delay := base
+	for i := 1; i < attempts && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
@@ -0,0 +1,425 @@
+package notification
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/apis"
+	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+	gormlogger "gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+// dryRunDialector builds the SQL of statements without a database
+type dryRunDialector struct{}
+
+func (dryRunDialector) Name() string { return "dryrun" }
+func (dryRunDialector) Initialize(db *gorm.DB) error {
+	callbacks.RegisterDefaultCallbacks(db, &callbacks.Config{})
+	return nil
+}
+func (dryRunDialector) Migrator(*gorm.DB) gorm.Migrator   { return nil }
+func (dryRunDialector) DataTypeOf(*schema.Field) string   { return "" }
+func (dryRunDialector) QuoteTo(w clause.Writer, s string) { _, _ = w.WriteString(s) }
+func (dryRunDialector) BindVarTo(w clause.Writer, _ *gorm.Statement, _ interface{}) {
+	_ = w.WriteByte('?')
+}
+func (dryRunDialector) DefaultValueOf(*schema.Field) clause.Expression {
+	return clause.Expr{SQL: "DEFAULT"}
+}
+func (dryRunDialector) Explain(sql string, vars ...interface{}) string {
+	return gormlogger.ExplainSQL(sql, nil, `'`, vars...)
+}
+
+// sqlRecorder records the SQL of all statements traced
+type sqlRecorder struct {
+	gormlogger.Interface
+	sqls []string
+}
+
+func (r *sqlRecorder) Trace(_ context.Context, _ time.Time, fc func() (string, int64), _ error) {
+	sql, _ := fc()
+	r.sqls = append(r.sqls, sql)
+}
+
+func newDryRunDB(t *testing.T) (*gorm.DB, *sqlRecorder) {
+	rec := &sqlRecorder{Interface: gormlogger.Discard}
+	db, err := gorm.Open(dryRunDialector{}, &gorm.Config{DryRun: true, DisableAutomaticPing: true, Logger: rec})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, rec
+}
+
+// memTable is a table kept in memory for the single table statements built by gorm, i.e.
+// SELECT and UPDATE with WHERE clauses of "column = ?" joined by AND
+type memTable struct {
+	mu   sync.Mutex
+	rows []map[string]driver.Value
+}
+
+func (m *memTable) Connect(context.Context) (driver.Conn, error) { return memConn{m}, nil }
+func (m *memTable) Driver() driver.Driver                        { return nil }
+
+type memConn struct{ table *memTable }
+
+func (memConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("prepare not supported") }
+func (memConn) Close() error                        { return nil }
+func (memConn) Begin() (driver.Tx, error)           { return nil, errors.New("transactions not supported") }
+
+// where returns the rows matching the WHERE clause of query with args
+func (m *memTable) where(query string, args []driver.NamedValue) []map[string]driver.Value {
+	cond := query[strings.Index(query, " WHERE ")+len(" WHERE "):]
+	for _, end := range []string{" ORDER BY ", " LIMIT "} {
+		if i := strings.Index(cond, end); i >= 0 {
+			cond = cond[:i]
+		}
+	}
+	var result []map[string]driver.Value
+	for _, row := range m.rows {
+		match := true
+		for i, c := range strings.Split(cond, " AND ") {
+			column := strings.TrimSuffix(c, " = ?")
+			match = match && fmt.Sprint(row[column]) == fmt.Sprint(args[i].Value)
+		}
+		if match {
+			result = append(result, row)
+		}
+	}
+	return result
+}
+
+func (c memConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.table.mu.Lock()
+	defer c.table.mu.Unlock()
+	set := strings.TrimPrefix(query[:strings.Index(query, " WHERE ")], "UPDATE notification_outbox SET ")
+	columns := strings.Split(set, ",")
+	rows := c.table.where(query, args[len(columns):])
+	for _, row := range rows {
+		for i, column := range columns {
+			row[strings.TrimSuffix(column, "=?")] = args[i].Value
+		}
+	}
+	return driver.RowsAffected(len(rows)), nil
+}
+
+func (c memConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.table.mu.Lock()
+	defer c.table.mu.Unlock()
+	columns := strings.Split(strings.TrimPrefix(query[:strings.Index(query, " FROM ")], "SELECT "), ",")
+	rows := &memRows{columns: columns}
+	for _, row := range c.table.where(query, args) {
+		values := make([]driver.Value, len(columns))
+		for i, column := range columns {
+			values[i] = row[column]
+		}
+		rows.values = append(rows.values, values)
+	}
+	return rows, nil
+}
+
+type memRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *memRows) Columns() []string { return r.columns }
+func (r *memRows) Close() error      { return nil }
+func (r *memRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// memDialector runs the statements against a memTable
+type memDialector struct {
+	dryRunDialector
+	table *memTable
+}
+
+func (d memDialector) Initialize(db *gorm.DB) error {
+	callbacks.RegisterDefaultCallbacks(db, &callbacks.Config{})
+	db.ConnPool = sql.OpenDB(d.table)
+	return nil
+}
+
+// newMemDB returns a db of the outbox records with the given statuses, with ids from 1
+func newMemDB(t *testing.T, statuses ...string) (*gorm.DB, *memTable) {
+	table := &memTable{}
+	for i, status := range statuses {
+		table.rows = append(table.rows, map[string]driver.Value{"id": int64(i + 1), "ref_key": "test", "status": status})
+	}
+	db, err := gorm.Open(memDialector{table: table}, &gorm.Config{SkipDefaultTransaction: true, Logger: gormlogger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, table
+}
+
+// newTestOutbox starts a notification module responding with status and returns a pointer to the
+// number of notifications it received
+func newTestOutbox(t *testing.T, status int) *int {
+	return newTestOutboxFunc(t, status, nil)
+}
+
+// newTestOutboxFunc is newTestOutbox calling onReceive before responding
+func newTestOutboxFunc(t *testing.T, status int, onReceive func()) *int {
+	received := new(int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body []Notification
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		*received += len(body)
+		if onReceive != nil {
+			onReceive()
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	v := viper.New()
+	v.Set("env.short", "dev")
+	v.Set("apis.internal.notification.module.url.base", srv.URL)
+	apis.Init(v)
+	return received
+}
+
+func newTestRecord(t *testing.T, noti *Notification) OutboxRecord {
+	payload, err := json.Marshal(noti)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return OutboxRecord{
+		IdempotencyKey: "dev-test-0",
+		RefKey:         "test",
+		Payload:        string(payload),
+		Status:         OutboxStatusPending,
+		NextAttemptAt:  time.Now(),
+		ExpiresAt:      noti.ExpiresAt,
+	}
+}
+
+func TestOutboxDispatcherSend(t *testing.T) {
+	if _, err := NewOutboxDispatcher(nil, nil); err == nil {
+		t.Error("NewOutboxDispatcher() expected error without db and token")
+	}
+	notice := func() *Notification {
+		return NewNotification(nil, "TEST_OUTBOX_NOTICE", "PTW-001").AddUserRecipient(12)
+	}
+	d := &OutboxDispatcher{MaxAttempts: 3, BaseBackoff: time.Minute}
+
+	tests := []struct {
+		name         string
+		noti         *Notification
+		attempts     int
+		status       int
+		wantSent     bool
+		wantStatus   string
+		wantAttempts int
+		wantReceived int
+	}{
+		{name: "Sent", noti: notice(), status: http.StatusOK, wantSent: true, wantStatus: OutboxStatusSent, wantAttempts: 1, wantReceived: 1},
+		{name: "Retried", noti: notice(), status: http.StatusBadRequest, wantStatus: OutboxStatusPending, wantAttempts: 1, wantReceived: 1},
+		{name: "Gave up", noti: notice(), attempts: 2, status: http.StatusBadRequest, wantStatus: OutboxStatusFailed, wantAttempts: 3, wantReceived: 1},
+		{name: "Expired", noti: notice().SetExpiresAt(time.Now().Add(-time.Minute)), status: http.StatusOK, wantStatus: OutboxStatusExpired},
+		{name: "Skipped without recipients", noti: NewNotification(nil, "TEST_OUTBOX_NOTICE"), status: http.StatusOK, wantStatus: OutboxStatusFailed, wantAttempts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received := newTestOutbox(t, tt.status)
+			record := newTestRecord(t, tt.noti)
+			record.Attempts = tt.attempts
+			if got := d.send("tk", &record); got != tt.wantSent {
+				t.Errorf("send() = %v, want %v", got, tt.wantSent)
+			}
+			if record.Status != tt.wantStatus || record.Attempts != tt.wantAttempts {
+				t.Errorf("status %s after %d attempts, want %s after %d", record.Status, record.Attempts, tt.wantStatus, tt.wantAttempts)
+			}
+			if *received != tt.wantReceived {
+				t.Errorf("%d notifications received, want %d", *received, tt.wantReceived)
+			}
+			switch record.Status {
+			case OutboxStatusSent:
+				if record.SentAt == nil || record.LastError != nil {
+					t.Errorf("sent record has sentAt %v, lastError %v", record.SentAt, record.LastError)
+				}
+			case OutboxStatusPending:
+				if record.LastError == nil || time.Until(record.NextAttemptAt) < 50*time.Second {
+					t.Errorf("retried record has lastError %v, next attempt at %s", record.LastError, record.NextAttemptAt)
+				}
+			case OutboxStatusFailed:
+				if record.LastError == nil {
+					t.Errorf("failed record has no error")
+				}
+			}
+		})
+	}
+}
+
+func TestOutboxDispatcherCancelledWhileSending(t *testing.T) {
+	notice := NewNotification(nil, "TEST_OUTBOX_NOTICE", "PTW-001").AddUserRecipient(12)
+	for _, status := range []int{http.StatusOK, http.StatusBadRequest} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			db, table := newMemDB(t, OutboxStatusPending, OutboxStatusPending)
+			cancel := false
+			received := newTestOutboxFunc(t, status, func() {
+				if cancel {
+					if n, err := CancelNotifications(db, "test"); err != nil || n != 1 {
+						t.Errorf("CancelNotifications() = %d, %v", n, err)
+					}
+				}
+			})
+			d := &OutboxDispatcher{DB: db}
+			sent, first := newTestRecord(t, notice), newTestRecord(t, notice)
+			sent.Id, first.Id = 1, 2
+			// The first record is saved, the second one is cancelled while it is being sent
+			if _, err := d.dispatch(context.Background(), "tk", []OutboxRecord{sent}); err != nil {
+				t.Fatal(err)
+			}
+			table.rows[0]["status"] = OutboxStatusSent
+			cancel = true
+			records := []OutboxRecord{first}
+			if _, err := d.dispatch(context.Background(), "tk", records); err != nil {
+				t.Fatal(err)
+			}
+			if *received != 2 || records[0].Status != OutboxStatusCancelled || table.rows[1]["status"] != OutboxStatusCancelled {
+				t.Errorf("%d received, record %s saved as %v, want it to stay cancelled", *received, records[0].Status, table.rows[1]["status"])
+			}
+			if table.rows[1]["attempts"] != nil {
+				t.Errorf("attempts of the cancelled record saved as %v", table.rows[1]["attempts"])
+			}
+		})
+	}
+}
+
+func TestOutboxDispatcherCancelledAfterClaim(t *testing.T) {
+	db, table := newMemDB(t, OutboxStatusPending)
+	received := newTestOutbox(t, http.StatusOK)
+	d := &OutboxDispatcher{DB: db}
+	record := newTestRecord(t, NewNotification(nil, "TEST_OUTBOX_NOTICE", "PTW-001").AddUserRecipient(12))
+	record.Id = 1
+	// Cancelled once claimed, before the dispatcher gets to send it
+	if n, err := CancelNotifications(db, "test"); err != nil || n != 1 {
+		t.Fatalf("CancelNotifications() = %d, %v", n, err)
+	}
+	records := []OutboxRecord{record}
+	sent, err := d.dispatch(context.Background(), "tk", records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent != 0 || *received != 0 || records[0].Status != OutboxStatusCancelled || table.rows[0]["status"] != OutboxStatusCancelled {
+		t.Errorf("%d sent, %d received, record %s saved as %v, want it not sent", sent, *received, records[0].Status, table.rows[0]["status"])
+	}
+}
+
+func TestOutboxRoundTrip(t *testing.T) {
+	received := newTestOutbox(t, http.StatusOK)
+	registerTestTemplate(t, Template{
+		Type:   "TEST_OUTBOX_APPROVED",
+		Params: []TemplateParam{{Name: "permitNo", Type: ParamString}, {Name: "level", Type: ParamNumber}},
+	})
+	contractId := intstring.IntString(38)
+	// IntString is marshalled as a string, it must still match the number param when dispatched
+	noti := NewNotification(&contractId, "TEST_OUTBOX_APPROVED", "PTW-001", intstring.IntString(2)).
+		AddUserRecipient(12).
+		SetupEnableExtraSendUser(false)
+	record, err := newOutboxRecord("permit-1-APPROVED", 0, 0, noti, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.IdempotencyKey != "dev-permit-1-APPROVED-0" {
+		t.Errorf("idempotency key = %s", record.IdempotencyKey)
+	}
+	d := &OutboxDispatcher{}
+	if !d.send("tk", &record) || record.Status != OutboxStatusSent || *received != 1 {
+		t.Errorf("record %s after sending, %d notifications received, last error %v", record.Status, *received, record.LastError)
+	}
+
+	if _, err := newOutboxRecord("permit-1-APPROVED", 0, 0, NewNotification(&contractId, "TEST_OUTBOX_APPROVED", "PTW-001"), time.Now()); err == nil {
+		t.Error("newOutboxRecord() expected error for a notification not matching its template")
+	}
+}
+
+func TestEnqueueNotifications(t *testing.T) {
+	newTestOutbox(t, http.StatusOK)
+	now := time.Now()
+	sendAt, expiresAt := now.Add(time.Hour), now.Add(2*time.Hour)
+	reminder := func() *Notification {
+		return NewNotification(nil, "TEST_OUTBOX_REMINDER", "PTW-001").AddUserRecipient(12).SetSendAt(sendAt).SetExpiresAt(expiresAt)
+	}
+
+	record, err := newOutboxRecord("permit-1-EXPIRY", 0, 1, reminder(), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !record.NextAttemptAt.Equal(sendAt) || record.ExpiresAt == nil || !record.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("record due at %s expiring at %v, want %s and %s", record.NextAttemptAt, record.ExpiresAt, sendAt, expiresAt)
+	}
+	if record.IdempotencyKey != "dev-permit-1-EXPIRY-1" {
+		t.Errorf("idempotency key = %s", record.IdempotencyKey)
+	}
+	// Enqueued again after a cancel, the notifications must not be dropped as duplicates
+	record, err = newOutboxRecord("permit-1-EXPIRY", 2, 1, reminder().SetSendAt(now.Add(-time.Minute)), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.IdempotencyKey != "dev-permit-1-EXPIRY-g2-1" || record.Generation != 2 || !record.NextAttemptAt.Equal(now) {
+		t.Errorf("record %s of generation %d due at %s", record.IdempotencyKey, record.Generation, record.NextAttemptAt)
+	}
+
+	db, rec := newDryRunDB(t)
+	if err := EnqueueNotifications(db, "permit-1-EXPIRY", reminder()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CancelNotifications(db, "permit-1-EXPIRY"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RescheduleNotifications(db, "permit-1-EXPIRY", sendAt); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"SELECT generation, COUNT(CASE WHEN status = 'CANCELLED' THEN 1 END) AS cancelled FROM notification_outbox WHERE ref_key = 'permit-1-EXPIRY' GROUP BY generation ORDER BY generation DESC LIMIT 1",
+		"INSERT INTO notification_outbox",
+		"UPDATE notification_outbox SET status='CANCELLED'",
+		"UPDATE notification_outbox SET next_attempt_at=",
+	}
+	if len(rec.sqls) != len(want) {
+		t.Fatalf("executed %q", rec.sqls)
+	}
+	for i, sql := range rec.sqls {
+		if !strings.HasPrefix(sql, want[i]) {
+			t.Errorf("statement %d = %s, want %s...", i, sql, want[i])
+		}
+	}
+	if !strings.Contains(rec.sqls[1], "'dev-permit-1-EXPIRY-0'") || !strings.HasSuffix(rec.sqls[1], "ON CONFLICT DO NOTHING") {
+		t.Errorf("insert = %s", rec.sqls[1])
+	}
+	for _, sql := range rec.sqls[2:] {
+		if !strings.HasSuffix(sql, "WHERE ref_key = 'permit-1-EXPIRY' AND status = 'PENDING'") {
+			t.Errorf("only pending notifications must be updated: %s", sql)
+		}
+	}
+
+	// A scheduled notification cannot be sent directly
+	if err := createNotifications("tk", true, reminder()); !errors.Is(err, ErrNotificationSkipped) {
+		t.Errorf("createNotifications() of scheduled notification error = %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+package notification
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+)
+
+// Priorities of CloudMessage, as defined by FCM
+const (
+	PushPriorityNormal = "normal"
+	PushPriorityHigh   = "high"
+)
+
+const (
+	// FCM rejects messages with a larger payload
+	pushMaxPayloadSize = 4096
+)
+
+var (
+	// Data keys added by the notification module, see CloudMessage.Data
+	pushReservedDataKeys = []string{"id", "templateType", "actions"}
+	// Data keys and prefixes reserved by FCM
+	pushFcmReservedDataKeys     = []string{"from", "notification", "message_type", "collapse_key"}
+	pushFcmReservedDataPrefixes = []string{"google.", "gcm."}
+	regexPushTopic              = regexp.MustCompile(`^[a-zA-Z0-9\-_.~%]{1,900}$`)
+)
+
+type (
+	// PushBuilder builds a validated CloudMessage of a notification, e.g.
+	//
+	//	err := notification.NewPushBuilder(n).
+	//		ToUser(userId).
+	//		Title("Permit approved", "許可證已批准").
+	//		Body("Permit PTW-001 is approved", "許可證 PTW-001 已批准").
+	//		Data("permitId", "123").
+	//		Attach()
+	//
+	// The body must be given explicitly, the content of the notification is only known to be used
+	// as the body by auto push, see AttachPushAutoDefault. The keys of the data are up to the app
+	// receiving the message.
+	PushBuilder struct {
+		n   *Notification
+		msg CloudMessage
+		// Set by the targeting methods so that user 0 can be told apart from no user
+		targeted bool
+		errs     []error
+	}
+	PushPreview struct {
+		Lang  string
+		Title string
+		Body  string
+		Data  map[string]string
+	}
+)
+
+func NewPushBuilder(n *Notification) *PushBuilder {
+	return &PushBuilder{
+		n: n,
+		msg: CloudMessage{
+			Priority: PushPriorityNormal,
+			Data:     map[string]string{},
+		},
+	}
+}
+
+// ToUser sends the message to the devices of a user, it cannot be combined with ToTopic
+func (b *PushBuilder) ToUser(userId intstring.IntString) *PushBuilder {
+	if b.targeted {
+		b.errs = append(b.errs, errors.New("push message can only have one target"))
+	}
+	b.targeted = true
+	b.msg.UserId = userId
+	return b
+}
+
+// ToTopic sends the message to all devices subscribed to a topic, it cannot be combined with ToUser
+func (b *PushBuilder) ToTopic(topic string) *PushBuilder {
+	if b.targeted {
+		b.errs = append(b.errs, errors.New("push message can only have one target"))
+	}
+	if !regexPushTopic.MatchString(topic) {
+		b.errs = append(b.errs, fmt.Errorf("invalid push topic %q", topic))
+	}
+	b.targeted = true
+	b.msg.Topic = topic
+	return b
+}
+
+func (b *PushBuilder) Priority(priority string) *PushBuilder {
+	switch priority {
+	case PushPriorityNormal, PushPriorityHigh:
+	default:
+		b.errs = append(b.errs, fmt.Errorf("invalid push priority %q", priority))
+	}
+	b.msg.Priority = priority
+	return b
+}
+
+// Title sets the title in English and Chinese, en is used if zh is empty
+func (b *PushBuilder) Title(en, zh string) *PushBuilder {
+	b.msg.Title, b.msg.TitleZh = en, zh
+	if zh == "" {
+		b.msg.TitleZh = en
+	}
+	return b
+}
+
+// Body sets the body in English and Chinese, en is used if zh is empty
+func (b *PushBuilder) Body(en, zh string) *PushBuilder {
+	b.msg.Body, b.msg.BodyZh = en, zh
+	if zh == "" {
+		b.msg.BodyZh = en
+	}
+	return b
+}
+
+// Data adds a custom data entry, reserved keys are rejected
+func (b *PushBuilder) Data(key, value string) *PushBuilder {
+	if err := validatePushDataKey(key); err != nil {
+		b.errs = append(b.errs, err)
+	}
+	b.msg.Data[key] = value
+	return b
+}
+
+// Build validates and returns the message
+func (b *PushBuilder) Build() (*CloudMessage, error) {
+	errs := append([]error{}, b.errs...)
+	if !b.targeted {
+		errs = append(errs, errors.New("push message must be sent to either a user or a topic"))
+	}
+	if b.msg.Title == "" && b.msg.Body == "" {
+		errs = append(errs, errors.New("push message must have a title or body"))
+	}
+	if strings.Contains(b.msg.Body, cloudMessageMagicDefault) || strings.Contains(b.msg.BodyZh, cloudMessageMagicDefault) {
+		errs = append(errs, fmt.Errorf("push body must not contain %s, which is only supported by auto push", cloudMessageMagicDefault))
+	}
+	for _, lang := range []string{LangEn, LangZh} {
+		if size := pushPayloadSize(b.n, &b.msg, lang); size > pushMaxPayloadSize {
+			errs = append(errs, fmt.Errorf("push payload (%s) is %d bytes, exceeding %d bytes", lang, size, pushMaxPayloadSize))
+		}
+	}
+	if len(errs) > 0 {
+		msgs := make([]string, len(errs))
+		for i, err := range errs {
+			msgs[i] = err.Error()
+		}
+		return nil, fmt.Errorf("invalid push message of %s: %s", b.n.TemplateType, strings.Join(msgs, "; "))
+	}
+	msg := b.msg
+	msg.Data = make(map[string]string, len(b.msg.Data))
+	for k, v := range b.msg.Data {
+		msg.Data[k] = v
+	}
+	return &msg, nil
+}
+
+// Attach builds and attaches the message to the notification with AttachPushExtra
+func (b *PushBuilder) Attach() error {
+	msg, err := b.Build()
+	if err != nil {
+		return err
+	}
+	b.n.AttachPushExtra(msg)
+	return nil
+}
+
+// PreviewPush renders msg of n locally in the given language. The data added by the
+// notification module are included with placeholder values.
+func PreviewPush(n *Notification, msg *CloudMessage, lang string) (*PushPreview, error) {
+	result := &PushPreview{Lang: LangEn, Title: msg.Title, Body: msg.Body}
+	if IsLangZh(lang) {
+		result.Lang, result.Title, result.Body = LangZh, msg.TitleZh, msg.BodyZh
+	}
+	result.Data = pushData(n, msg)
+	return result, nil
+}
+
+func validatePushDataKey(key string) error {
+	if key == "" {
+		return errors.New("push data key must not be empty")
+	}
+	for _, k := range pushReservedDataKeys {
+		if key == k {
+			return fmt.Errorf("push data key %s is added by the notification module", key)
+		}
+	}
+	for _, k := range pushFcmReservedDataKeys {
+		if key == k {
+			return fmt.Errorf("push data key %s is reserved by FCM", key)
+		}
+	}
+	for _, p := range pushFcmReservedDataPrefixes {
+		if strings.HasPrefix(key, p) {
+			return fmt.Errorf("push data key %s is reserved by FCM", key)
+		}
+	}
+	return nil
+}
+
+// pushData returns the data of msg including those added by the notification module
+func pushData(n *Notification, msg *CloudMessage) map[string]string {
+	data := make(map[string]string, len(msg.Data)+len(pushReservedDataKeys))
+	for k, v := range msg.Data {
+		data[k] = v
+	}
+	actions, _ := json.Marshal(n.Actions)
+	data["id"] = "0"
+	data["templateType"] = n.TemplateType
+	data["actions"] = string(actions)
+	return data
+}
+
+// pushPayloadSize estimates the size of the FCM payload of msg in lang
+func pushPayloadSize(n *Notification, msg *CloudMessage, lang string) int {
+	title, body := msg.Title, msg.Body
+	if lang == LangZh {
+		title, body = msg.TitleZh, msg.BodyZh
+	}
+	size := len(title) + len(body)
+	for k, v := range pushData(n, msg) {
+		size += len(k) + len(v)
+	}
+	return size
+}
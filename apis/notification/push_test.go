@@ -0,0 +1,127 @@
+package notification
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPushBuilder(t *testing.T) {
+	base := func() *Notification {
+		return NewNotification(nil, "TEST_PUSH_APPROVED").AddAction("VIEW", "View")
+	}
+	tests := []struct {
+		name    string
+		build   func(b *PushBuilder) *PushBuilder
+		wantErr string
+	}{
+		{
+			name: "Valid user push",
+			build: func(b *PushBuilder) *PushBuilder {
+				return b.ToUser(12).Title("Approved", "已批准").Body("Permit approved", "許可證已批准").Data("permitId", "1")
+			},
+		},
+		{
+			name: "Valid topic push",
+			build: func(b *PushBuilder) *PushBuilder {
+				return b.ToTopic("contract-38").Priority(PushPriorityHigh).Body("Approved", "")
+			},
+		},
+		{
+			name:    "No target",
+			build:   func(b *PushBuilder) *PushBuilder { return b.Title("Approved", "") },
+			wantErr: "either a user or a topic",
+		},
+		{
+			name:    "User and topic",
+			build:   func(b *PushBuilder) *PushBuilder { return b.ToUser(12).ToTopic("contract-38").Title("Approved", "") },
+			wantErr: "only have one target",
+		},
+		{
+			name:    "Invalid topic",
+			build:   func(b *PushBuilder) *PushBuilder { return b.ToTopic("contract 38").Title("Approved", "") },
+			wantErr: "invalid push topic",
+		},
+		{
+			name:    "Invalid priority",
+			build:   func(b *PushBuilder) *PushBuilder { return b.ToUser(12).Priority("urgent").Title("Approved", "") },
+			wantErr: "invalid push priority",
+		},
+		{
+			name:    "Reserved data key",
+			build:   func(b *PushBuilder) *PushBuilder { return b.ToUser(12).Title("Approved", "").Data("templateType", "X") },
+			wantErr: "added by the notification module",
+		},
+		{
+			name: "FCM reserved data key",
+			build: func(b *PushBuilder) *PushBuilder {
+				return b.ToUser(12).Title("Approved", "").Data("google.sent_time", "1")
+			},
+			wantErr: "reserved by FCM",
+		},
+		{
+			name: "Default body",
+			build: func(b *PushBuilder) *PushBuilder {
+				return b.ToUser(12).Title("Approved", "").Body(cloudMessageMagicDefault, "")
+			},
+			wantErr: "only supported by auto push",
+		},
+		{
+			name: "Payload too large",
+			build: func(b *PushBuilder) *PushBuilder {
+				return b.ToUser(12).Title("Approved", "").Body(strings.Repeat("a", 4096), "")
+			},
+			wantErr: "exceeding 4096 bytes",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := base()
+			err := tt.build(NewPushBuilder(n)).Attach()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Attach() error = %v", err)
+				}
+				if len(n.WithPush) != 1 {
+					t.Errorf("WithPush has %d messages, want 1", len(n.WithPush))
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Attach() error = %v, want %q", err, tt.wantErr)
+			}
+			if len(n.WithPush) != 0 {
+				t.Errorf("invalid message attached")
+			}
+		})
+	}
+}
+
+func TestPreviewPush(t *testing.T) {
+	n := NewNotification(nil, "TEST_PUSH_PREVIEW", "PTW-001").AddAction("VIEW", "View")
+	msg, err := NewPushBuilder(n).ToUser(12).Title("Approved", "已批准").Body("Tap to view", "").Data("permitId", "1").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		lang      string
+		wantTitle string
+		wantBody  string
+	}{
+		{lang: "en", wantTitle: "Approved", wantBody: "Tap to view"},
+		{lang: "zh-HK", wantTitle: "已批准", wantBody: "Tap to view"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.lang, func(t *testing.T) {
+			got, err := PreviewPush(n, msg, tt.lang)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Title != tt.wantTitle || got.Body != tt.wantBody {
+				t.Errorf("PreviewPush() = %q / %q, want %q / %q", got.Title, got.Body, tt.wantTitle, tt.wantBody)
+			}
+			if got.Data["templateType"] != "TEST_PUSH_PREVIEW" || got.Data["permitId"] != "1" {
+				t.Errorf("PreviewPush() data = %v", got.Data)
+			}
+		})
+	}
+}
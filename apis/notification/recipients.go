@@ -0,0 +1,182 @@
+package notification
+
+import (
+	"fmt"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/apis/user"
+	"github.com/Mobility-Development-Team/be-common-mdl/org"
+	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+	"github.com/Mobility-Development-Team/be-common-mdl/util/concutil"
+	logger "github.com/sirupsen/logrus"
+)
+
+// Types of RecipientReason
+const (
+	ReasonUser           = "USER"            // Added with AddUserRecipient
+	ReasonGroup          = "GROUP"           // Member of a group added with AddGroupRecipient, RefId is the group id
+	ReasonPartyAdmin     = "PARTY_ADMIN"     // Admin of a party added with AddPartyAdminRecipient, RefId is the party id
+	ReasonExtraSendRule  = "EXTRA_SEND_RULE" // Fixed user of the matching ExtraSendRule
+	ReasonExtraSendUser  = "EXTRA_SEND_USER" // User with extra send turned on in the contract, RefId is the contract id
+	ReasonExcludedSender = "EXCLUDED_SENDER" // The sender is not notified unless IncludeSelf is set
+)
+
+type (
+	// RecipientResolution is the result of ResolveRecipients
+	RecipientResolution struct {
+		// Users receiving the notification, in order of first appearance
+		Recipients []ResolvedRecipient `json:"recipients"`
+		// Users that were added but will not receive the notification
+		Excluded []ResolvedRecipient `json:"excluded"`
+		// Whether extra send users are included, see ExtraSendRule
+		EnableExtraSendUser bool `json:"enableExtraSendUser"`
+		// The rule deciding EnableExtraSendUser, nil if it is set with SetupEnableExtraSendUser or no rule matches
+		ExtraSendRule *ExtraSendRule `json:"extraSendRule"`
+	}
+	ResolvedRecipient struct {
+		UserId  intstring.IntString `json:"userId"`
+		Reasons []RecipientReason   `json:"reasons"`
+	}
+	RecipientReason struct {
+		Type  string               `json:"type"`
+		RefId *intstring.IntString `json:"refId,omitempty"`
+	}
+)
+
+// ResolveRecipients expands the recipients of n into the users that will actually receive it,
+// with the reasons each user is included. It is intended for debugging and audits, n is not modified.
+//
+// Groups are expanded via the user module and party admins via the core module. senderId is the
+// user calling CreateNotifications, it is excluded unless n.IncludeSelf is set. Pass nil if unknown.
+func ResolveRecipients(tk string, senderId *intstring.IntString, n *Notification) (*RecipientResolution, error) {
+	if n == nil {
+		return nil, fmt.Errorf("notification is nil")
+	}
+	// Same as applyExtraSendPolicy but the fixed users of the rule are added by resolveRecipients
+	noti := *n
+	var rule *ExtraSendRule
+	if noti.ExtraSendOverride != nil {
+		noti.EnableExtraSendUser = *noti.ExtraSendOverride
+	} else {
+		rule = MatchExtraSendRule(&noti)
+		noti.EnableExtraSendUser = rule != nil && rule.Enable
+	}
+
+	groupAwaiter := concutil.Async(func() (interface{}, error) {
+		return getGroupMemberIds(tk, noti.ContractID, noti.Recipients.Groups)
+	})
+	adminAwaiter := concutil.Async(func() (interface{}, error) {
+		return getPartyAdminIds(tk, noti.ContractID, noti.Recipients.PartyAdmin)
+	})
+	extraAwaiter := concutil.Async(func() (interface{}, error) {
+		return handleExtraNotification(tk, &noti)
+	})
+	for _, a := range []*concutil.Awaiter{groupAwaiter, adminAwaiter, extraAwaiter} {
+		if err := a.Await(); err != nil {
+			return nil, err
+		}
+	}
+	var extraUserIds []intstring.IntString
+	if noti.ContractID != nil {
+		extraUserIds = extraAwaiter.Get().(map[intstring.IntString][]intstring.IntString)[*noti.ContractID]
+	}
+	return resolveRecipients(
+		&noti, rule, senderId,
+		groupAwaiter.Get().(map[intstring.IntString][]intstring.IntString),
+		adminAwaiter.Get().(map[intstring.IntString][]intstring.IntString),
+		extraUserIds,
+	), nil
+}
+
+// resolveRecipients merges the expanded recipients of n, with EnableExtraSendUser already decided by rule.
+func resolveRecipients(
+	n *Notification, rule *ExtraSendRule, senderId *intstring.IntString,
+	groupMembers, partyAdmins map[intstring.IntString][]intstring.IntString, extraUserIds []intstring.IntString,
+) *RecipientResolution {
+	var (
+		order   []intstring.IntString
+		reasons = map[intstring.IntString][]RecipientReason{}
+	)
+	add := func(reason RecipientReason, ids ...intstring.IntString) {
+		for _, id := range ids {
+			if id == 0 {
+				continue
+			}
+			if _, ok := reasons[id]; !ok {
+				order = append(order, id)
+			}
+			reasons[id] = append(reasons[id], reason)
+		}
+	}
+	add(RecipientReason{Type: ReasonUser}, n.Recipients.Users...)
+	if rule != nil {
+		add(RecipientReason{Type: ReasonExtraSendRule}, rule.Users...)
+	}
+	for _, groupId := range n.Recipients.Groups {
+		groupId := groupId
+		add(RecipientReason{Type: ReasonGroup, RefId: &groupId}, groupMembers[groupId]...)
+	}
+	for _, partyId := range n.Recipients.PartyAdmin {
+		partyId := partyId
+		add(RecipientReason{Type: ReasonPartyAdmin, RefId: &partyId}, partyAdmins[partyId]...)
+	}
+	if n.EnableExtraSendUser && n.ContractID != nil {
+		contractId := *n.ContractID
+		add(RecipientReason{Type: ReasonExtraSendUser, RefId: &contractId}, extraUserIds...)
+	}
+
+	result := &RecipientResolution{
+		Recipients:          []ResolvedRecipient{},
+		Excluded:            []ResolvedRecipient{},
+		EnableExtraSendUser: n.EnableExtraSendUser,
+		ExtraSendRule:       rule,
+	}
+	for _, id := range order {
+		r := ResolvedRecipient{UserId: id, Reasons: reasons[id]}
+		if senderId != nil && id == *senderId && !n.IncludeSelf {
+			r.Reasons = append(r.Reasons, RecipientReason{Type: ReasonExcludedSender})
+			result.Excluded = append(result.Excluded, r)
+			continue
+		}
+		result.Recipients = append(result.Recipients, r)
+	}
+	return result
+}
+
+// RecipientIds returns the user ids of the recipients
+func (r *RecipientResolution) RecipientIds() []intstring.IntString {
+	ids := make([]intstring.IntString, 0, len(r.Recipients))
+	for _, recipient := range r.Recipients {
+		ids = append(ids, recipient.UserId)
+	}
+	return ids
+}
+
+// getGroupMemberIds returns the member ids of the groups of the contract by group id, see org.GroupMemberIds
+func getGroupMemberIds(tk string, contractId *intstring.IntString, groupIds []intstring.IntString) (map[intstring.IntString][]intstring.IntString, error) {
+	if len(groupIds) == 0 {
+		return map[intstring.IntString][]intstring.IntString{}, nil
+	}
+	groups, err := user.GetAllGroupInfoByCriteria(tk, user.GroupCriteria{ContractId: contractId, Ids: groupIds})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get groups: %w", err)
+	}
+	result, err := org.GroupMemberIds(tk, groups)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range groupIds {
+		if _, ok := result[id]; !ok {
+			logger.Warnf("[ResolveRecipients] Group %s not found, ignoring", id)
+		}
+	}
+	return result, nil
+}
+
+// getPartyAdminIds returns the admin ids of the parties of the contract by party id, see org.PartyAdminIds
+func getPartyAdminIds(tk string, contractId *intstring.IntString, partyIds []intstring.IntString) (map[intstring.IntString][]intstring.IntString, error) {
+	var cid intstring.IntString
+	if contractId != nil {
+		cid = *contractId
+	}
+	return org.PartyAdminIds(tk, cid, partyIds)
+}
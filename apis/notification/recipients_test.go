@@ -0,0 +1,87 @@
+package notification
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+)
+
+func TestResolveRecipients(t *testing.T) {
+	contractId := intstring.IntString(38)
+	sender := intstring.IntString(12)
+	groupMembers := map[intstring.IntString][]intstring.IntString{5: {12, 20, 21}}
+	partyAdmins := map[intstring.IntString][]intstring.IntString{2: {21, 30}}
+	extraUsers := []intstring.IntString{30, 40}
+	rule := &ExtraSendRule{Template: "*_APPROVED", Enable: true, Users: []intstring.IntString{50}}
+	base := func() *Notification {
+		return NewNotification(&contractId, "PERMIT_APPROVED").
+			AddUserRecipient(12, 13).
+			AddGroupRecipient(5).
+			AddPartyAdminRecipient(2)
+	}
+	tests := []struct {
+		name         string
+		noti         *Notification
+		rule         *ExtraSendRule
+		wantIds      []intstring.IntString
+		wantExcluded []intstring.IntString
+		wantReasons  map[intstring.IntString][]string
+	}{
+		{
+			name:         "Sender excluded",
+			noti:         base(),
+			wantIds:      []intstring.IntString{13, 20, 21, 30},
+			wantExcluded: []intstring.IntString{12},
+			wantReasons: map[intstring.IntString][]string{
+				12: {ReasonUser, ReasonGroup, ReasonExcludedSender},
+				21: {ReasonGroup, ReasonPartyAdmin},
+			},
+		},
+		{
+			name:         "Include self",
+			noti:         base().AllowSelf(),
+			wantIds:      []intstring.IntString{12, 13, 20, 21, 30},
+			wantExcluded: []intstring.IntString{},
+		},
+		{
+			name:         "Extra send",
+			noti:         base().SetupEnableExtraSendUser(true),
+			rule:         rule,
+			wantIds:      []intstring.IntString{13, 50, 20, 21, 30, 40},
+			wantExcluded: []intstring.IntString{12},
+			wantReasons: map[intstring.IntString][]string{
+				30: {ReasonPartyAdmin, ReasonExtraSendUser},
+				50: {ReasonExtraSendRule},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := resolveRecipients(tt.noti, tt.rule, &sender, groupMembers, partyAdmins, extraUsers)
+			if ids := got.RecipientIds(); !reflect.DeepEqual(ids, tt.wantIds) {
+				t.Errorf("recipients = %v, want %v", ids, tt.wantIds)
+			}
+			excluded := []intstring.IntString{}
+			for _, r := range got.Excluded {
+				excluded = append(excluded, r.UserId)
+			}
+			if !reflect.DeepEqual(excluded, tt.wantExcluded) {
+				t.Errorf("excluded = %v, want %v", excluded, tt.wantExcluded)
+			}
+			for _, r := range append(got.Recipients, got.Excluded...) {
+				want, ok := tt.wantReasons[r.UserId]
+				if !ok {
+					continue
+				}
+				var types []string
+				for _, reason := range r.Reasons {
+					types = append(types, reason.Type)
+				}
+				if !reflect.DeepEqual(types, want) {
+					t.Errorf("reasons of %s = %v, want %v", r.UserId, types, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package notification
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/types/floatstring"
+	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+	"github.com/Mobility-Development-Team/be-common-mdl/util/strutil"
+)
+
+// Types of TemplateParam
+const (
+	ParamString = "string"
+	ParamNumber = "number"
+	ParamBool   = "bool"
+	ParamAny    = "any"
+)
+
+// Languages supported by previews
+const (
+	LangEn = "en"
+	LangZh = "zh"
+)
+
+type (
+	// Template describes a remote notification template so notifications can be validated before sending.
+	//
+	// Previews refer to params by name with {{name}} and should match the remote template as closely as possible.
+	Template struct {
+		Type      string
+		Params    []TemplateParam
+		PreviewEn string
+		PreviewZh string
+		// Action ids allowed to be attached, any action is allowed if empty
+		Actions []string
+	}
+	TemplateParam struct {
+		Name string
+		Type string
+	}
+)
+
+var (
+	muTemplates        sync.RWMutex
+	templates          = map[string]Template{}
+	regexTemplateParam = regexp.MustCompile(`{{\s*(\w+)\s*}}`)
+)
+
+// RegisterTemplate adds a template to the registry, replacing any template of the same type.
+// The definition itself is validated, e.g. previews must only refer to declared params.
+func RegisterTemplate(t Template) error {
+	if t.Type == "" {
+		return fmt.Errorf("template type must not be empty")
+	}
+	declared := map[string]struct{}{}
+	for _, p := range t.Params {
+		if p.Name == "" {
+			return fmt.Errorf("template %s: param name must not be empty", t.Type)
+		}
+		if _, ok := declared[p.Name]; ok {
+			return fmt.Errorf("template %s: duplicated param %s", t.Type, p.Name)
+		}
+		switch p.Type {
+		case ParamString, ParamNumber, ParamBool, ParamAny:
+		default:
+			return fmt.Errorf("template %s: unknown type %q of param %s", t.Type, p.Type, p.Name)
+		}
+		declared[p.Name] = struct{}{}
+	}
+	for _, preview := range []string{t.PreviewEn, t.PreviewZh} {
+		for _, m := range regexTemplateParam.FindAllStringSubmatch(preview, -1) {
+			if _, ok := declared[m[1]]; !ok {
+				return fmt.Errorf("template %s: preview refers to undeclared param %s", t.Type, m[1])
+			}
+		}
+	}
+	muTemplates.Lock()
+	defer muTemplates.Unlock()
+	templates[t.Type] = t
+	return nil
+}
+
+// MustRegisterTemplate is RegisterTemplate but panics on error, to be used in init()
+func MustRegisterTemplate(t Template) {
+	if err := RegisterTemplate(t); err != nil {
+		panic(err)
+	}
+}
+
+func LookupTemplate(templateType string) (Template, bool) {
+	muTemplates.RLock()
+	defer muTemplates.RUnlock()
+	t, ok := templates[templateType]
+	return t, ok
+}
+
+// NewTemplatedNotification is NewNotification with named params.
+// The params are put in the order declared by the registered template and validated.
+func NewTemplatedNotification(contractId *intstring.IntString, templateType string, params map[string]interface{}) (*Notification, error) {
+	t, ok := LookupTemplate(templateType)
+	if !ok {
+		return nil, fmt.Errorf("template %s is not registered", templateType)
+	}
+	positional := make([]interface{}, len(t.Params))
+	for i, p := range t.Params {
+		v, ok := params[p.Name]
+		if !ok {
+			return nil, fmt.Errorf("template %s: missing param %s", templateType, p.Name)
+		}
+		positional[i] = v
+	}
+	if len(params) != len(t.Params) {
+		for name := range params {
+			if _, ok := t.param(name); !ok {
+				return nil, fmt.Errorf("template %s: unknown param %s", templateType, name)
+			}
+		}
+	}
+	n := NewNotification(contractId, templateType, positional...)
+	if err := n.Validate(); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// Validate checks the params and actions of n against its registered template.
+// Notifications of unregistered templates are not validated.
+func (n *Notification) Validate() error {
+	t, ok := LookupTemplate(n.TemplateType)
+	if !ok {
+		return nil
+	}
+	if len(n.Params) != len(t.Params) {
+		return fmt.Errorf("template %s: expected %d params, got %d", t.Type, len(t.Params), len(n.Params))
+	}
+	for i, p := range t.Params {
+		if !matchParamType(p.Type, n.Params[i]) {
+			return fmt.Errorf("template %s: param %s should be %s, got %T", t.Type, p.Name, p.Type, n.Params[i])
+		}
+	}
+	if len(t.Actions) > 0 {
+		for _, a := range n.Actions {
+			allowed := false
+			for _, id := range t.Actions {
+				allowed = allowed || id == a.ActionID
+			}
+			if !allowed {
+				return fmt.Errorf("template %s: action %s is not allowed", t.Type, a.ActionID)
+			}
+		}
+	}
+	return nil
+}
+
+// Preview renders n locally with the preview of its registered template in the given language (LangEn or LangZh).
+// It is intended for tests and debugging, the actual content is rendered by the notification module.
+func Preview(n *Notification, lang string) (string, error) {
+	if err := n.Validate(); err != nil {
+		return "", err
+	}
+	t, ok := LookupTemplate(n.TemplateType)
+	if !ok {
+		return "", fmt.Errorf("template %s is not registered", n.TemplateType)
+	}
+	preview := t.PreviewEn
+	if IsLangZh(lang) && t.PreviewZh != "" {
+		preview = t.PreviewZh
+	}
+	return regexTemplateParam.ReplaceAllStringFunc(preview, func(m string) string {
+		name := regexTemplateParam.FindStringSubmatch(m)[1]
+		i, _ := t.param(name)
+		return strutil.StrOrEmptyFromInterface(n.Params[i])
+	}), nil
+}
+
+// IsLangZh returns true for any Chinese language code, e.g. zh, zh-HK or zh_TW
+func IsLangZh(lang string) bool {
+	return strings.HasPrefix(strings.ToLower(lang), LangZh)
+}
+
+func (t Template) param(name string) (int, bool) {
+	for i, p := range t.Params {
+		if p.Name == name {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+func matchParamType(paramType string, v interface{}) bool {
+	switch v.(type) {
+	case intstring.IntString, *intstring.IntString, floatstring.FloatString, *floatstring.FloatString:
+		return paramType == ParamNumber || paramType == ParamAny
+	}
+	value := reflect.Indirect(reflect.ValueOf(v))
+	if !value.IsValid() {
+		// nil is accepted for any type, it is sent as null
+		return true
+	}
+	switch paramType {
+	case ParamString:
+		_, ok := value.Interface().(fmt.Stringer)
+		return ok || value.Kind() == reflect.String
+	case ParamNumber:
+		switch value.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			return true
+		case reflect.String:
+			// IntString and FloatString are sent as strings, e.g. decoded from the outbox
+			_, err := strconv.ParseFloat(value.String(), 64)
+			return err == nil
+		}
+		return false
+	case ParamBool:
+		return value.Kind() == reflect.Bool
+	}
+	return true
+}
@@ -0,0 +1,77 @@
+package notification
+
+import (
+	"testing"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+)
+
+// registerTestTemplate registers tmpl for the duration of the test
+func registerTestTemplate(t *testing.T, tmpl Template) {
+	t.Helper()
+	if err := RegisterTemplate(tmpl); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		muTemplates.Lock()
+		defer muTemplates.Unlock()
+		delete(templates, tmpl.Type)
+	})
+}
+
+func TestTemplateRegistry(t *testing.T) {
+	registerTestTemplate(t, Template{
+		Type: "TEST_PERMIT_APPROVED",
+		Params: []TemplateParam{
+			{Name: "permitNo", Type: ParamString},
+			{Name: "level", Type: ParamNumber},
+		},
+		PreviewEn: "Permit {{permitNo}} is approved at level {{ level }}",
+		PreviewZh: "許可證 {{permitNo}} 已於第 {{level}} 級批准",
+		Actions:   []string{"VIEW"},
+	})
+	contractId := intstring.IntString(38)
+
+	if err := RegisterTemplate(Template{Type: "TEST_BAD", PreviewEn: "{{missing}}"}); err == nil {
+		t.Error("RegisterTemplate() expected error for undeclared param")
+	}
+
+	tests := []struct {
+		name    string
+		noti    *Notification
+		wantErr bool
+	}{
+		{name: "Valid", noti: NewNotification(&contractId, "TEST_PERMIT_APPROVED", "PTW-001", intstring.IntString(2)).AddAction("VIEW", "View")},
+		{name: "Missing param", noti: NewNotification(&contractId, "TEST_PERMIT_APPROVED", "PTW-001"), wantErr: true},
+		{name: "Wrong type", noti: NewNotification(&contractId, "TEST_PERMIT_APPROVED", "PTW-001", "two"), wantErr: true},
+		{name: "Numeric string", noti: NewNotification(&contractId, "TEST_PERMIT_APPROVED", "PTW-001", "2")},
+		{name: "Action not allowed", noti: NewNotification(&contractId, "TEST_PERMIT_APPROVED", "PTW-001", 2).AddAction("DELETE", "Delete"), wantErr: true},
+		{name: "Unregistered", noti: NewNotification(&contractId, "TEST_UNKNOWN", 1, 2, 3)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.noti.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	n, err := NewTemplatedNotification(&contractId, "TEST_PERMIT_APPROVED", map[string]interface{}{
+		"level":    3,
+		"permitNo": "PTW-002",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := Preview(n, LangEn); got != "Permit PTW-002 is approved at level 3" {
+		t.Errorf("Preview() en = %s", got)
+	}
+	if got, _ := Preview(n, "zh-HK"); got != "許可證 PTW-002 已於第 3 級批准" {
+		t.Errorf("Preview() zh = %s", got)
+	}
+	if _, err := NewTemplatedNotification(&contractId, "TEST_PERMIT_APPROVED", map[string]interface{}{
+		"level": 3, "permitNo": "PTW-002", "extra": true,
+	}); err == nil {
+		t.Error("NewTemplatedNotification() expected error for unknown param")
+	}
+}
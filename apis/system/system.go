@@ -180,16 +180,16 @@ func GetLocations(tk string, body map[string]interface{}) (map[intstring.IntStri
 	return resp.Payload, nil
 }
 
-// A version of GetSupportInfo that logs the error and retruns the initialized map value on error
+// A version of GetSupportInfo that logs the error and retruns the initialized map value on error.
+// The value is served from GetCachedSupportInfo, so the last good value is returned during outages.
 func ShouldGetSupportInfo() map[string]string {
-	supportInfo, err := GetSupportInfo()
+	supportInfo, freshness, err := GetCachedSupportInfo()
 	if err != nil {
-		logger.Error("[ShouldGetSupportInfo] Unable to get support info, support info would be missing for functions depending on it")
+		logger.Error("[ShouldGetSupportInfo] Unable to get support info, support info would be missing for functions depending on it: ", err)
 		return map[string]string{}
 	}
-	if supportInfo == nil {
-		logger.Error("[ShouldGetSupportInfo] Call was successful but a nil support info was received")
-		return map[string]string{}
+	if freshness.LastError != nil {
+		logger.Warnf("[ShouldGetSupportInfo] Using support info fetched %s ago: %v", freshness.Age(), freshness.LastError)
 	}
 	return supportInfo
 }
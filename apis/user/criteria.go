@@ -0,0 +1,72 @@
+package user
+
+import (
+	"errors"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/apis/core"
+	"github.com/Mobility-Development-Team/be-common-mdl/model"
+	"github.com/Mobility-Development-Team/be-common-mdl/model/pagination"
+	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+)
+
+// GroupCriteria is the request body of GetAllGroupInfo
+type GroupCriteria struct {
+	ContractId    *intstring.IntString   `json:"contractId,omitempty"`
+	PartyId       *intstring.IntString   `json:"partyId,omitempty"`
+	Ids           []intstring.IntString  `json:"ids,omitempty"`
+	Name          string                 `json:"name,omitempty"`
+	Status        string                 `json:"status,omitempty"`
+	IsSystemGroup *bool                  `json:"isSystemGroup,omitempty"`
+	Pagination    *pagination.Pagination `json:"-"`
+}
+
+func NewGroupCriteria(contractId intstring.IntString) *GroupCriteria {
+	return &GroupCriteria{
+		ContractId: &contractId,
+	}
+}
+
+func (c *GroupCriteria) InParty(partyId intstring.IntString) *GroupCriteria {
+	c.PartyId = &partyId
+	return c
+}
+
+func (c *GroupCriteria) WithIds(ids ...intstring.IntString) *GroupCriteria {
+	c.Ids = append(c.Ids, ids...)
+	return c
+}
+
+func (c *GroupCriteria) WithName(name string) *GroupCriteria {
+	c.Name = name
+	return c
+}
+
+func (c *GroupCriteria) WithStatus(status string) *GroupCriteria {
+	c.Status = status
+	return c
+}
+
+func (c *GroupCriteria) SystemGroupOnly(isSystemGroup bool) *GroupCriteria {
+	c.IsSystemGroup = &isSystemGroup
+	return c
+}
+
+func (c *GroupCriteria) Paginate(p *pagination.Pagination) *GroupCriteria {
+	c.Pagination = p
+	return c
+}
+
+func (c GroupCriteria) Validate() error {
+	if c.ContractId == nil && len(c.Ids) == 0 {
+		return errors.New("invalid criteria: either contractId or ids must be specified")
+	}
+	return core.ValidateStatus("status", c.Status)
+}
+
+func GetAllGroupInfoByCriteria(tk string, c GroupCriteria) ([]model.GroupInfo, error) {
+	body, err := core.CriteriaBody(c, c.Pagination)
+	if err != nil {
+		return nil, err
+	}
+	return GetAllGroupInfo(tk, body)
+}
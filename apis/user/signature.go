@@ -0,0 +1,301 @@
+package user
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strings"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/apis"
+	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+	"github.com/Mobility-Development-Team/be-common-mdl/util/cacheutil"
+	logger "github.com/sirupsen/logrus"
+)
+
+const (
+	cacheSignatureConfig  = "apis.cache.signature"
+	signatureBatchSize    = 50
+	signatureMaxDimension = 4096
+	// Pixels with alpha or any color channel below these values are considered ink when trimming
+	signatureAlphaThreshold = 0x10
+	signatureWhiteThreshold = 0xf0
+)
+
+var (
+	ErrNoSignature      = errors.New("user has no signature")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrBlankSignature   = errors.New("signature is blank")
+)
+
+type (
+	// SignatureOptions controls how signatures are post-processed by GetSignatureImages.
+	// Processing is applied to a copy, the cached image is always the original one.
+	SignatureOptions struct {
+		// Crops the signature to the bounding box of its ink
+		Trim bool
+		// If both are set, the signature is scaled to fit inside the box keeping its
+		// aspect ratio and centered on a transparent canvas of exactly this size.
+		// If only one is set, the signature is scaled to it and the other one follows the aspect ratio.
+		Width  int
+		Height int
+	}
+	Signature struct {
+		UserId intstring.IntString
+		// Nil if Err is set
+		Image image.Image
+		// ErrNoSignature if the user has no signature saved, ErrInvalidSignature if it cannot be decoded
+		Err error
+	}
+	signatureEntry struct {
+		img image.Image
+		err error
+	}
+)
+
+// Signatures are personal data, so they are cached per caller
+var signatureCache = cacheutil.Lazy(func() *cacheutil.CallerCache[intstring.IntString, signatureEntry] {
+	return cacheutil.NewCallerCacheFromConfig[intstring.IntString, signatureEntry](apis.V(), cacheSignatureConfig)
+})
+
+// GetSignatureImages gets and decodes the signatures of the given users.
+//
+// Signatures not cached yet are fetched in batches and cached per caller and user, see
+// cacheutil.CallerCache configured by `apis.cache.signature`. Call InvalidateSignatures when
+// a signature is updated. A result is returned for every given id, check Signature.Err for
+// users without a valid signature. Every image returned is a copy the caller is free to modify.
+func GetSignatureImages(tk string, ids []intstring.IntString, opts SignatureOptions) (map[intstring.IntString]*Signature, error) {
+	cache := signatureCache()
+	result := make(map[intstring.IntString]*Signature, len(ids))
+	var toFetch []intstring.IntString
+	for _, id := range ids {
+		if _, ok := result[id]; ok {
+			continue
+		}
+		result[id] = nil
+		if !cache.Contains(tk, id) {
+			toFetch = append(toFetch, id)
+		}
+	}
+
+	for start := 0; start < len(toFetch); start += signatureBatchSize {
+		end := start + signatureBatchSize
+		if end > len(toFetch) {
+			end = len(toFetch)
+		}
+		entries, err := fetchSignatures(tk, toFetch[start:end])
+		if err != nil {
+			return nil, err
+		}
+		for id, e := range entries {
+			cache.Set(tk, id, e)
+		}
+	}
+
+	for id := range result {
+		id := id
+		e, _, err := cache.Get(tk, id, func() (signatureEntry, error) {
+			entries, err := fetchSignatures(tk, []intstring.IntString{id})
+			return entries[id], err
+		})
+		if err != nil {
+			return nil, err
+		}
+		sig := &Signature{UserId: id, Err: e.err}
+		if sig.Err == nil {
+			if sig.Image, sig.Err = ProcessSignature(e.img, opts); sig.Err != nil {
+				sig.Image = nil
+			}
+		}
+		result[id] = sig
+	}
+	return result, nil
+}
+
+// InvalidateSignatures removes the cached signatures of the given users.
+// Calling it without ids clears the whole cache.
+func InvalidateSignatures(ids ...intstring.IntString) {
+	if len(ids) == 0 {
+		signatureCache().InvalidateAll()
+		return
+	}
+	for _, id := range ids {
+		signatureCache().Invalidate(id)
+	}
+}
+
+func fetchSignatures(tk string, ids []intstring.IntString) (map[intstring.IntString]signatureEntry, error) {
+	sigs, err := GetUserSignatures(tk, ids)
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[intstring.IntString]signatureEntry, len(ids))
+	for _, id := range ids {
+		img, err := DecodeSignature(sigs[id])
+		if err != nil && err != ErrNoSignature {
+			logger.Warnf("[GetSignatureImages] Invalid signature of user %s: %v", id, err)
+		}
+		entries[id] = signatureEntry{img: img, err: err}
+	}
+	return entries, nil
+}
+
+// DecodeSignature decodes and validates a base64 encoded png signature as returned by GetUserSignatures.
+// A data uri prefix (data:image/png;base64,) is accepted.
+func DecodeSignature(sig string) (image.Image, error) {
+	if sig == "" {
+		return nil, ErrNoSignature
+	}
+	if i := strings.Index(sig, ","); strings.HasPrefix(sig, "data:") && i >= 0 {
+		sig = sig[i+1:]
+	}
+	b, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	if format != "png" {
+		return nil, fmt.Errorf("%w: expected png, got %s", ErrInvalidSignature, format)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > signatureMaxDimension || cfg.Height > signatureMaxDimension {
+		return nil, fmt.Errorf("%w: unsupported dimension %dx%d", ErrInvalidSignature, cfg.Width, cfg.Height)
+	}
+	img, err := png.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	return img, nil
+}
+
+// ProcessSignature applies opts to img and returns the processed copy, img is never modified
+func ProcessSignature(img image.Image, opts SignatureOptions) (image.Image, error) {
+	if opts.Width < 0 || opts.Height < 0 {
+		return nil, fmt.Errorf("invalid signature size %dx%d", opts.Width, opts.Height)
+	}
+	bounds := img.Bounds()
+	if opts.Trim {
+		bounds = inkBounds(img)
+		if bounds.Empty() {
+			return nil, ErrBlankSignature
+		}
+	}
+	w, h := opts.Width, opts.Height
+	switch {
+	case w == 0 && h == 0:
+		return crop(img, bounds), nil
+	case h == 0:
+		h = scaledSize(bounds.Dy(), w, bounds.Dx())
+	case w == 0:
+		w = scaledSize(bounds.Dx(), h, bounds.Dy())
+	}
+	if opts.Trim {
+		img = crop(img, bounds)
+	}
+	return fit(img, w, h), nil
+}
+
+// scaledSize returns size scaled by to/from, at least 1
+func scaledSize(size, to, from int) int {
+	if s := int(float64(size)*float64(to)/float64(from) + 0.5); s > 1 {
+		return s
+	}
+	return 1
+}
+
+// EncodeSignature encodes a signature as png, e.g. for embedding into a pdf
+func EncodeSignature(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// inkBounds returns the smallest rectangle containing all non-transparent, non-white pixels
+func inkBounds(img image.Image) image.Rectangle {
+	b := img.Bounds()
+	ink := image.Rectangle{}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A < signatureAlphaThreshold {
+				continue
+			}
+			if c.R >= signatureWhiteThreshold && c.G >= signatureWhiteThreshold && c.B >= signatureWhiteThreshold {
+				continue
+			}
+			ink = ink.Union(image.Rect(x, y, x+1, y+1))
+		}
+	}
+	return ink
+}
+
+func crop(img image.Image, r image.Rectangle) image.Image {
+	dst := image.NewNRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, r.Min, draw.Src)
+	return dst
+}
+
+// fit scales img to fit inside w x h keeping its aspect ratio, centered on a transparent canvas of w x h
+func fit(img image.Image, w, h int) image.Image {
+	src := img.Bounds()
+	scale := float64(w) / float64(src.Dx())
+	if s := float64(h) / float64(src.Dy()); s < scale {
+		scale = s
+	}
+	sw, sh := int(float64(src.Dx())*scale+0.5), int(float64(src.Dy())*scale+0.5)
+	if sw < 1 {
+		sw = 1
+	}
+	if sh < 1 {
+		sh = 1
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	offX, offY := (w-sw)/2, (h-sh)/2
+	for y := 0; y < sh; y++ {
+		for x := 0; x < sw; x++ {
+			dst.Set(offX+x, offY+y, sampleBox(img, src, scale, x, y))
+		}
+	}
+	return dst
+}
+
+// sampleBox averages the source pixels covered by the destination pixel (x, y)
+func sampleBox(img image.Image, src image.Rectangle, scale float64, x, y int) color.NRGBA {
+	x0, y0 := src.Min.X+int(float64(x)/scale), src.Min.Y+int(float64(y)/scale)
+	x1, y1 := src.Min.X+int(float64(x+1)/scale), src.Min.Y+int(float64(y+1)/scale)
+	if x1 <= x0 {
+		x1 = x0 + 1
+	}
+	if y1 <= y0 {
+		y1 = y0 + 1
+	}
+	if x1 > src.Max.X {
+		x1 = src.Max.X
+	}
+	if y1 > src.Max.Y {
+		y1 = src.Max.Y
+	}
+	var r, g, b, a, n uint32
+	for sy := y0; sy < y1; sy++ {
+		for sx := x0; sx < x1; sx++ {
+			c := color.NRGBAModel.Convert(img.At(sx, sy)).(color.NRGBA)
+			r += uint32(c.R)
+			g += uint32(c.G)
+			b += uint32(c.B)
+			a += uint32(c.A)
+			n++
+		}
+	}
+	if n == 0 {
+		return color.NRGBA{}
+	}
+	return color.NRGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: uint8(a / n)}
+}
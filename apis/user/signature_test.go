@@ -0,0 +1,169 @@
+package user
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/apis"
+	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+	"github.com/spf13/viper"
+)
+
+func encodeTestImage(t *testing.T, jpg bool) string {
+	img := image.NewNRGBA(image.Rect(0, 0, 100, 50))
+	for x := 20; x < 60; x++ {
+		for y := 10; y < 30; y++ {
+			img.Set(x, y, color.Black)
+		}
+	}
+	var buf bytes.Buffer
+	var err error
+	if jpg {
+		err = jpeg.Encode(&buf, img, nil)
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestDecodeSignature(t *testing.T) {
+	tests := []struct {
+		name    string
+		sig     string
+		wantErr error
+	}{
+		{name: "Empty", sig: "", wantErr: ErrNoSignature},
+		{name: "Not base64", sig: "!!!", wantErr: ErrInvalidSignature},
+		{name: "Not an image", sig: base64.StdEncoding.EncodeToString([]byte("hello")), wantErr: ErrInvalidSignature},
+		{name: "Jpeg", sig: encodeTestImage(t, true), wantErr: ErrInvalidSignature},
+		{name: "Png", sig: encodeTestImage(t, false)},
+		{name: "Png data uri", sig: "data:image/png;base64," + encodeTestImage(t, false)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeSignature(tt.sig)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("DecodeSignature() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProcessSignature(t *testing.T) {
+	img, err := DecodeSignature(encodeTestImage(t, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	trimmed, err := ProcessSignature(img, SignatureOptions{Trim: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := trimmed.Bounds().Size(); got != image.Pt(40, 20) {
+		t.Errorf("trimmed size = %v, want 40x20", got)
+	}
+	fitted, err := ProcessSignature(img, SignatureOptions{Trim: true, Width: 200, Height: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fitted.Bounds().Size(); got != image.Pt(200, 200) {
+		t.Errorf("fitted size = %v, want 200x200", got)
+	}
+	// Scaled to 200x100 and vertically centered
+	if _, _, _, a := fitted.At(100, 10).RGBA(); a != 0 {
+		t.Errorf("expected transparent padding at top")
+	}
+	if r, _, _, a := fitted.At(100, 100).RGBA(); a == 0 || r != 0 {
+		t.Errorf("expected ink at center")
+	}
+	if _, err := ProcessSignature(image.NewNRGBA(image.Rect(0, 0, 10, 10)), SignatureOptions{Trim: true}); !errors.Is(err, ErrBlankSignature) {
+		t.Errorf("ProcessSignature() of blank image error = %v", err)
+	}
+	if _, err := ProcessSignature(img, SignatureOptions{Width: -1}); err == nil {
+		t.Errorf("ProcessSignature() of negative size expected an error")
+	}
+
+	// Only one dimension set, the other one follows the aspect ratio
+	for _, tt := range []struct {
+		opts SignatureOptions
+		want image.Point
+	}{
+		{opts: SignatureOptions{Trim: true, Width: 80}, want: image.Pt(80, 40)},
+		{opts: SignatureOptions{Trim: true, Height: 10}, want: image.Pt(20, 10)},
+		{opts: SignatureOptions{Width: 50}, want: image.Pt(50, 25)},
+	} {
+		scaled, err := ProcessSignature(img, tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := scaled.Bounds().Size(); got != tt.want {
+			t.Errorf("ProcessSignature(%+v) size = %v, want %v", tt.opts, got, tt.want)
+		}
+	}
+
+	// Without options a copy is returned
+	copied, err := ProcessSignature(img, SignatureOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	copied.(draw.Image).Set(0, 0, color.Black)
+	if _, _, _, a := img.At(0, 0).RGBA(); a != 0 {
+		t.Errorf("ProcessSignature() modified the original image")
+	}
+}
+
+func TestGetSignatureImages(t *testing.T) {
+	sig := encodeTestImage(t, false)
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"payload": map[string]string{"1": sig, "2": ""}})
+	}))
+	defer srv.Close()
+	v := viper.New()
+	v.Set("apis.internal.user.module.url.base", srv.URL)
+	apis.Init(v)
+	defer InvalidateSignatures()
+
+	get := func(tk string) map[intstring.IntString]*Signature {
+		sigs, err := GetSignatureImages(tk, []intstring.IntString{1, 2, 1}, SignatureOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sigs
+	}
+	sigs := get("tk-a")
+	if len(sigs) != 2 || sigs[1].Err != nil || !errors.Is(sigs[2].Err, ErrNoSignature) {
+		t.Fatalf("GetSignatureImages() = %+v", sigs)
+	}
+	// Modifying a result does not affect the cached signature
+	sigs[1].Image.(draw.Image).Set(0, 0, color.Black)
+	if _, _, _, a := get("tk-a")[1].Image.At(0, 0).RGBA(); a != 0 {
+		t.Errorf("cached signature modified by a caller")
+	}
+	if requests != 1 {
+		t.Errorf("%d requests, want 1 batch", requests)
+	}
+	// Another caller fetches its own signatures
+	get("tk-b")
+	if requests != 2 {
+		t.Errorf("%d requests, want 2", requests)
+	}
+	InvalidateSignatures(1)
+	get("tk-a")
+	if requests != 3 {
+		t.Errorf("%d requests after invalidation, want 3", requests)
+	}
+}
@@ -0,0 +1,240 @@
+/*
+This package parses hashtags out of free text (e.g. media descriptions and findings),
+resolves them into model.HashTags for a contract and renders them back for display.
+
+A hashtag starts with '#' and ends at the next whitespace or '#'. Trailing punctuation
+is ignored. Names are matched case-insensitively with whitespaces removed, hence Render
+writes "#PeterChan" for "Peter Chan" so that the rendered text is parsed back to the same tags. Locations are
+named "Name NameZh" by the core module and can be matched by either name as well, so that
+"#BlockA" and "#甲座" match the location "Block A 甲座". Unmatched hashtags are kept as custom tags.
+*/
+package hashtag
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/apis/core"
+	"github.com/Mobility-Development-Team/be-common-mdl/model"
+	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+	logger "github.com/sirupsen/logrus"
+)
+
+// Types of model.HashtagInfo returned by the core module
+const (
+	TypeUser      = "USER"
+	TypeUserGroup = "USERGROUP"
+	TypeRole      = "ROLE"
+	TypeLocation  = "LOCATION"
+)
+
+const prefix = "#"
+
+// Resolver resolves hashtags against the known users, groups, roles and locations of a contract
+type Resolver struct {
+	ContractId intstring.IntString
+	byName     map[string]model.HashtagInfo
+	byUuid     map[string]model.HashtagInfo
+}
+
+// NewResolver loads all user, role and location hashtags of a contract from the core module
+func NewResolver(tk string, contractId intstring.IntString) (*Resolver, error) {
+	userTags, err := core.GetAllUserHashTag(tk, contractId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get user hashtags: %w", err)
+	}
+	roleTags, err := core.GetRoleHastag(tk)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get role hashtags: %w", err)
+	}
+	locationTags, err := core.GetLocationHashtagByContractId(tk, contractId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get location hashtags: %w", err)
+	}
+	infos := make([]model.HashtagInfo, 0, len(userTags)+len(roleTags)+len(locationTags))
+	infos = append(infos, userTags...)
+	infos = append(infos, roleTags...)
+	infos = append(infos, locationTags...)
+	r := NewResolverFromInfo(infos...)
+	r.ContractId = contractId
+	return r, nil
+}
+
+// NewResolverFromInfo creates a resolver from already loaded hashtag info.
+// If more than one info shares the same name, the first one given wins. Full names
+// take precedence over the English or Chinese name of a location.
+func NewResolverFromInfo(infos ...model.HashtagInfo) *Resolver {
+	r := &Resolver{
+		byName: make(map[string]model.HashtagInfo, len(infos)),
+		byUuid: make(map[string]model.HashtagInfo, len(infos)),
+	}
+	for _, info := range infos {
+		key := normalize(info.Name)
+		if key == "" {
+			continue
+		}
+		if _, ok := r.byName[key]; ok {
+			logger.Debugf("[hashtag][NewResolverFromInfo] Duplicated hashtag name %q, ignoring %s %s", info.Name, info.Type, info.Id)
+		} else {
+			r.byName[key] = info
+		}
+		if info.UserRefKey != "" {
+			r.byUuid[info.UserRefKey] = info
+		}
+	}
+	for _, info := range infos {
+		if info.Type != TypeLocation {
+			continue
+		}
+		for _, alias := range splitLocationName(info.Name) {
+			if key := normalize(alias); key != "" {
+				if _, ok := r.byName[key]; !ok {
+					r.byName[key] = info
+				}
+			}
+		}
+	}
+	return r
+}
+
+// Parse returns the hashtags found in text without the leading '#', in the order they appear.
+// Duplicated hashtags are only returned once.
+func Parse(text string) []string {
+	var tags []string
+	seen := map[string]struct{}{}
+	for _, field := range strings.FieldsFunc(text, unicode.IsSpace) {
+		for _, part := range strings.Split(field, prefix)[1:] {
+			tag := strings.TrimRightFunc(part, unicode.IsPunct)
+			if tag == "" {
+				continue
+			}
+			if _, ok := seen[tag]; ok {
+				continue
+			}
+			seen[tag] = struct{}{}
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// Resolve parses text and resolves the hashtags found into their typed structure
+func (r *Resolver) Resolve(text string) model.HashTags {
+	result := model.HashTags{
+		Custom:    []model.CustomHashTag{},
+		Location:  []model.LocationHashTag{},
+		User:      []model.UserHashTag{},
+		UserGroup: []model.UserGroupHashTag{},
+	}
+	for _, tag := range Parse(text) {
+		info, ok := r.byName[normalize(tag)]
+		if !ok {
+			result.Custom = append(result.Custom, model.CustomHashTag{TagName: tag})
+			continue
+		}
+		switch info.Type {
+		case TypeUser:
+			result.User = append(result.User, model.UserHashTag{
+				UserId:   info.Id.String(),
+				UserName: info.Name,
+				Uuid:     info.UserRefKey,
+			})
+		case TypeUserGroup, TypeRole:
+			result.UserGroup = append(result.UserGroup, model.UserGroupHashTag{
+				UserGroupId:   info.Id.String(),
+				UserGroupName: info.Name,
+				Uuid:          info.UserRefKey,
+			})
+		case TypeLocation:
+			result.Location = append(result.Location, model.LocationHashTag{
+				LocationId:   info.Id.String(),
+				LocationName: info.Name,
+				Uuid:         info.UserRefKey,
+			})
+		default:
+			logger.Warnf("[hashtag][Resolve] Unknown hashtag type %q for %q, treating as custom", info.Type, tag)
+			result.Custom = append(result.Custom, model.CustomHashTag{TagName: tag})
+		}
+	}
+	return result
+}
+
+// Validate checks that all users, groups and locations referenced by tags exist in the contract.
+// Custom hashtags are always valid.
+func (r *Resolver) Validate(tags model.HashTags) error {
+	var missing []string
+	check := func(tagType, id, uuid, name string) {
+		if info, ok := r.byUuid[uuid]; ok && uuid != "" && info.Id.String() == id {
+			return
+		}
+		missing = append(missing, fmt.Sprintf("%s %q (id: %s)", strings.ToLower(tagType), name, id))
+	}
+	for _, u := range tags.User {
+		check(TypeUser, u.UserId, u.Uuid, u.UserName)
+	}
+	for _, g := range tags.UserGroup {
+		check(TypeUserGroup, g.UserGroupId, g.Uuid, g.UserGroupName)
+	}
+	for _, l := range tags.Location {
+		check(TypeLocation, l.LocationId, l.Uuid, l.LocationName)
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("hashtags not found in contract %s: %s", r.ContractId, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// Render returns the hashtags of tags, e.g. "#BlockA" for the location "Block A". Whitespaces and
+// '#' are removed from the names so that Parse and Resolve read the same tags back.
+// Users come first, followed by groups, locations and custom tags.
+func Render(tags model.HashTags) []string {
+	result := make([]string, 0, len(tags.User)+len(tags.UserGroup)+len(tags.Location)+len(tags.Custom))
+	for _, u := range tags.User {
+		result = append(result, renderTag(u.UserName))
+	}
+	for _, g := range tags.UserGroup {
+		result = append(result, renderTag(g.UserGroupName))
+	}
+	for _, l := range tags.Location {
+		result = append(result, renderTag(l.LocationName))
+	}
+	for _, c := range tags.Custom {
+		result = append(result, renderTag(c.TagName))
+	}
+	return result
+}
+
+func renderTag(name string) string {
+	return prefix + strings.ReplaceAll(strings.Join(strings.Fields(name), ""), prefix, "")
+}
+
+// Decode unmarshals the raw hashtags stored with media (model.MediaParam.Hashtags).
+// An empty or null value results in empty hashtags.
+func Decode(raw json.RawMessage) (model.HashTags, error) {
+	var tags model.HashTags
+	if len(raw) == 0 || string(raw) == "null" {
+		return tags, nil
+	}
+	if err := json.Unmarshal(raw, &tags); err != nil {
+		return tags, fmt.Errorf("unable to decode hashtags: %w", err)
+	}
+	return tags, nil
+}
+
+// splitLocationName splits a location name "Name NameZh" into its English and Chinese names,
+// nil is returned if the name is not bilingual
+func splitLocationName(name string) []string {
+	i := strings.IndexFunc(name, func(r rune) bool { return unicode.Is(unicode.Han, r) })
+	if i <= 0 || strings.TrimSpace(name[:i]) == "" {
+		return nil
+	}
+	return []string{name[:i], name[i:]}
+}
+
+// normalize removes whitespaces, '#' and trailing punctuation like Parse and Render do
+func normalize(name string) string {
+	name = strings.ReplaceAll(strings.Join(strings.Fields(name), ""), prefix, "")
+	return strings.ToLower(strings.TrimRightFunc(name, unicode.IsPunct))
+}
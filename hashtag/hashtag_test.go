@@ -0,0 +1,141 @@
+package hashtag
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/model"
+)
+
+var testInfos = []model.HashtagInfo{
+	{Id: 12, Name: "Peter Chan", Type: TypeUser, UserRefKey: "u-12"},
+	{Id: 3, Name: "Safety Officer", Type: TypeRole, UserRefKey: "r-3"},
+	{Id: 7, Name: "Block A 甲座", Type: TypeLocation, UserRefKey: "l-7"},
+	{Id: 8, Name: "Block B", Type: TypeLocation, UserRefKey: "l-8"},
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{
+			name: "Plain text",
+			text: "No hashtags here",
+			want: nil,
+		},
+		{
+			name: "Mixed",
+			text: "Crack found at #BlockA甲座, please follow up #PeterChan #urgent! #urgent",
+			want: []string{"BlockA甲座", "PeterChan", "urgent"},
+		},
+		{
+			name: "Adjacent",
+			text: "#a#b # #c.",
+			want: []string{"a", "b", "c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Parse(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveAndRender(t *testing.T) {
+	r := NewResolverFromInfo(testInfos...)
+	got := r.Resolve("#peterchan please check #BlockA甲座 with #SafetyOfficer #rework")
+	want := model.HashTags{
+		Custom:    []model.CustomHashTag{{TagName: "rework"}},
+		Location:  []model.LocationHashTag{{LocationId: "7", LocationName: "Block A 甲座", Uuid: "l-7"}},
+		User:      []model.UserHashTag{{UserId: "12", UserName: "Peter Chan", Uuid: "u-12"}},
+		UserGroup: []model.UserGroupHashTag{{UserGroupId: "3", UserGroupName: "Safety Officer", Uuid: "r-3"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Resolve() = %+v, want %+v", got, want)
+	}
+	if err := r.Validate(got); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+	wantRendered := []string{"#PeterChan", "#SafetyOfficer", "#BlockA甲座", "#rework"}
+	if rendered := Render(got); !reflect.DeepEqual(rendered, wantRendered) {
+		t.Errorf("Render() = %v, want %v", rendered, wantRendered)
+	}
+}
+
+func TestRenderRoundTrip(t *testing.T) {
+	r := NewResolverFromInfo(append(testInfos, model.HashtagInfo{Id: 9, Name: "Tech. Dept.", Type: TypeUserGroup, UserRefKey: "g-9"})...)
+	tags := model.HashTags{
+		Custom:    []model.CustomHashTag{{TagName: "rework"}},
+		Location:  []model.LocationHashTag{{LocationId: "8", LocationName: "Block B", Uuid: "l-8"}},
+		User:      []model.UserHashTag{{UserId: "12", UserName: "Peter Chan", Uuid: "u-12"}},
+		UserGroup: []model.UserGroupHashTag{{UserGroupId: "9", UserGroupName: "Tech. Dept.", Uuid: "g-9"}},
+	}
+	if got := r.Resolve(strings.Join(Render(tags), " ")); !reflect.DeepEqual(got, tags) {
+		t.Errorf("Resolve(Render()) = %+v, want %+v", got, tags)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	r := NewResolverFromInfo(testInfos...)
+	tests := []struct {
+		name    string
+		tags    model.HashTags
+		wantErr bool
+	}{
+		{
+			name: "Custom only",
+			tags: model.HashTags{Custom: []model.CustomHashTag{{TagName: "anything"}}},
+		},
+		{
+			name:    "Unknown user",
+			tags:    model.HashTags{User: []model.UserHashTag{{UserId: "99", UserName: "Nobody", Uuid: "u-99"}}},
+			wantErr: true,
+		},
+		{
+			name:    "Mismatched location id",
+			tags:    model.HashTags{Location: []model.LocationHashTag{{LocationId: "8", LocationName: "Block A", Uuid: "l-7"}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := r.Validate(tt.tags); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResolveLocationNames(t *testing.T) {
+	r := NewResolverFromInfo(testInfos...)
+	tests := []struct {
+		name   string
+		text   string
+		wantId string
+	}{
+		{name: "Full name", text: "#BlockA甲座", wantId: "7"},
+		{name: "English name", text: "#BlockA", wantId: "7"},
+		{name: "Chinese name", text: "#甲座", wantId: "7"},
+		{name: "English only location", text: "#blockb", wantId: "8"},
+		{name: "Unknown", text: "#BlockC"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := r.Resolve(tt.text)
+			if tt.wantId == "" {
+				if len(got.Location) != 0 || len(got.Custom) != 1 {
+					t.Errorf("Resolve() = %+v, want a custom hashtag", got)
+				}
+				return
+			}
+			if len(got.Location) != 1 || got.Location[0].LocationId != tt.wantId {
+				t.Errorf("Resolve() = %+v, want location %s", got, tt.wantId)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package model
+
+// DeepCopy returns a copy of m not sharing any pointer, map or slice with m
+func (m Model) DeepCopy() Model {
+	m.UpdatedBy = copyPtr(m.UpdatedBy)
+	m.CreatedByDisplay = copyJSONValue(m.CreatedByDisplay)
+	m.UpdatedByDisplay = copyJSONValue(m.UpdatedByDisplay)
+	return m
+}
+
+// DeepCopy returns a copy of c not sharing any pointer, map or slice with c, e.g. for a cached contract
+func (c Contract) DeepCopy() Contract {
+	c.Model = c.Model.DeepCopy()
+	c.ContractDesc = copyPtr(c.ContractDesc)
+	return c
+}
+
+// DeepCopy returns a copy of c not sharing any pointer, map or slice with c
+func (c CoreContract) DeepCopy() CoreContract {
+	c.Model = c.Model.DeepCopy()
+	c.ContractDesc = copyPtr(c.ContractDesc)
+	c.Address = copyPtr(c.Address)
+	c.AddressLatitude = copyPtr(c.AddressLatitude)
+	c.AddressLongitude = copyPtr(c.AddressLongitude)
+	c.BusinessUnit = copyPtr(c.BusinessUnit)
+	c.DashboardUrl = copyPtr(c.DashboardUrl)
+	return c
+}
+
+// DeepCopy returns a copy of c not sharing any pointer, map or slice with c, e.g. for a cached contract
+func (c GetCoreContractResponse) DeepCopy() GetCoreContractResponse {
+	c.Model = c.Model.DeepCopy()
+	c.CoreContract = c.CoreContract.DeepCopy()
+	if c.Parties != nil {
+		parties := make([]interface{}, len(c.Parties))
+		for i, p := range c.Parties {
+			parties[i] = copyJSONValue(p)
+		}
+		c.Parties = parties
+	}
+	return c
+}
+
+func copyPtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
+
+// copyJSONValue copies the maps and slices of a value decoded by json.Unmarshal into an interface{}
+func copyJSONValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for k, value := range v {
+			result[k] = copyJSONValue(value)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, value := range v {
+			result[i] = copyJSONValue(value)
+		}
+		return result
+	}
+	return v
+}
@@ -0,0 +1,153 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+)
+
+// MediaRefForm is the JSON form a MediaParam is decoded from. Media can be referenced by
+// clients with a full object, or with only its id or refId, e.g. "media": ["123", "<uuid>"]
+type MediaRefForm int
+
+const (
+	// The zero value, for media created in code, decoded from an object or null
+	MediaRefFormObject MediaRefForm = iota
+	// A JSON number, e.g. 123
+	MediaRefFormId
+	// A string of digits, e.g. "123"
+	MediaRefFormIdString
+	// A UUID string set as the FbRefId
+	MediaRefFormUuid
+	// Any other string set as the FbRefId, e.g. a Firebase push id
+	MediaRefFormFbRefId
+)
+
+var regexUuid = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+func (f MediaRefForm) String() string {
+	switch f {
+	case MediaRefFormObject:
+		return "object"
+	case MediaRefFormId:
+		return "id"
+	case MediaRefFormIdString:
+		return "idString"
+	case MediaRefFormUuid:
+		return "uuid"
+	case MediaRefFormFbRefId:
+		return "fbRefId"
+	}
+	return fmt.Sprintf("MediaRefForm(%d)", int(f))
+}
+
+// ParseMediaRef parses a media reference given as a string, e.g. a path parameter.
+// A string of digits is an id, any other non-empty string is a refId.
+func ParseMediaRef(ref string) (MediaParam, error) {
+	if ref == "" {
+		return MediaParam{}, fmt.Errorf("media reference must not be empty")
+	}
+	if isDigits(ref) {
+		id, err := strconv.Atoi(ref)
+		if err != nil || id <= 0 {
+			return MediaParam{}, fmt.Errorf("invalid media id %q", ref)
+		}
+		return MediaParam{Id: intstring.IntString(id), DecodedForm: MediaRefFormIdString}, nil
+	}
+	if regexUuid.MatchString(ref) {
+		return MediaParam{FbRefId: ref, DecodedForm: MediaRefFormUuid}, nil
+	}
+	return MediaParam{FbRefId: ref, DecodedForm: MediaRefFormFbRefId}, nil
+}
+
+// UnmarshalJSON decodes a media from an object, a numeric id, or a string of id or refId.
+// The detected form is kept in DecodedForm so that the media can be marshalled back in the same
+// form with MarshalRef.
+func (m *MediaParam) UnmarshalJSON(b []byte) error {
+	type origMediaParam MediaParam // Create new type so it doesn't reuse this unmarshaller
+	trimmed := bytes.TrimSpace(b)
+	if len(trimmed) == 0 {
+		return fmt.Errorf("cannot unmarshal MediaParam from empty input")
+	}
+	switch c := trimmed[0]; {
+	case c == '{' || string(trimmed) == "null":
+		var origM origMediaParam
+		if err := json.Unmarshal(trimmed, &origM); err != nil {
+			return fmt.Errorf("cannot unmarshal MediaParam object: %w", err)
+		}
+		*m = MediaParam(origM)
+		m.DecodedForm = MediaRefFormObject
+		return nil
+	case c == '"':
+		var str string
+		if err := json.Unmarshal(trimmed, &str); err != nil {
+			return fmt.Errorf("cannot unmarshal MediaParam string: %w", err)
+		}
+		if str == "" {
+			// Kept for compatibility, an empty string was decoded as an empty media
+			*m = MediaParam{}
+			return nil
+		}
+		parsed, err := ParseMediaRef(str)
+		if err != nil {
+			return fmt.Errorf("cannot unmarshal MediaParam: %w", err)
+		}
+		*m = parsed
+		return nil
+	case c == '-' || (c >= '0' && c <= '9'):
+		id, err := strconv.Atoi(string(trimmed))
+		if err != nil || id <= 0 {
+			return fmt.Errorf("cannot unmarshal MediaParam: invalid id %s", trimmed)
+		}
+		*m = MediaParam{Id: intstring.IntString(id), DecodedForm: MediaRefFormId}
+		return nil
+	}
+	return fmt.Errorf("cannot unmarshal MediaParam, not an object nor an id or refId: %s", trimmed)
+}
+
+// MarshalJSON always marshals the media as an object, whatever form it was decoded from, so that
+// the requests sent to other modules are not changed by the form a client used. See MarshalRef.
+func (m MediaParam) MarshalJSON() ([]byte, error) {
+	type origMediaParam MediaParam
+	return json.Marshal(origMediaParam(m))
+}
+
+// MarshalRef marshals the media back in the form it was decoded from if it still holds the id or
+// refId only, e.g. to echo a client request, otherwise as an object like MarshalJSON.
+func (m MediaParam) MarshalRef() ([]byte, error) {
+	switch m.DecodedForm {
+	case MediaRefFormId:
+		if m.isRefOnly(MediaParam{Id: m.Id}) && m.Id != 0 {
+			return []byte(strconv.Itoa(int(m.Id))), nil
+		}
+	case MediaRefFormIdString:
+		if m.isRefOnly(MediaParam{Id: m.Id}) && m.Id != 0 {
+			return json.Marshal(m.Id.String())
+		}
+	case MediaRefFormUuid, MediaRefFormFbRefId:
+		if m.isRefOnly(MediaParam{FbRefId: m.FbRefId}) && m.FbRefId != "" {
+			return json.Marshal(m.FbRefId)
+		}
+	}
+	return m.MarshalJSON()
+}
+
+// isRefOnly returns true if m has no fields set other than those of ref
+func (m MediaParam) isRefOnly(ref MediaParam) bool {
+	ref.DecodedForm = m.DecodedForm
+	return reflect.DeepEqual(m, ref)
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,122 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+)
+
+func TestMediaParamUnmarshalJSON(t *testing.T) {
+	const uuid = "3f2b8c1e-9d4a-4e7b-a1c2-0b9e8f7d6c5a"
+	tests := []struct {
+		name      string
+		input     string
+		wantId    intstring.IntString
+		wantRefId string
+		wantForm  MediaRefForm
+		wantErr   bool
+		// Expected output of json.Marshal, same as input if empty
+		wantJson string
+	}{
+		{name: "Object", input: `{"id":"12","fbRefId":"abc","description":"d"}`, wantId: 12, wantRefId: "abc", wantForm: MediaRefFormObject, wantJson: "-"},
+		{name: "Object with numeric id", input: `{"id":12}`, wantId: 12, wantForm: MediaRefFormObject, wantJson: "-"},
+		{name: "Numeric id", input: `12`, wantId: 12, wantForm: MediaRefFormId},
+		{name: "String id", input: `"12"`, wantId: 12, wantForm: MediaRefFormIdString},
+		{name: "String id with spaces", input: ` "345" `, wantId: 345, wantForm: MediaRefFormIdString, wantJson: `"345"`},
+		{name: "Uuid", input: `"` + uuid + `"`, wantRefId: uuid, wantForm: MediaRefFormUuid},
+		{name: "Firebase refId", input: `"-NcZ1x2y3z4A5b6C7d8e"`, wantRefId: "-NcZ1x2y3z4A5b6C7d8e", wantForm: MediaRefFormFbRefId},
+		{name: "Alphanumeric refId", input: `"12ab"`, wantRefId: "12ab", wantForm: MediaRefFormFbRefId},
+		{name: "Empty string", input: `""`, wantForm: MediaRefFormObject, wantJson: "-"},
+		{name: "Null", input: `null`, wantForm: MediaRefFormObject, wantJson: "-"},
+		{name: "Zero id", input: `0`, wantErr: true},
+		{name: "Negative id", input: `-3`, wantErr: true},
+		{name: "Fractional id", input: `1.5`, wantErr: true},
+		{name: "Zero string id", input: `"0"`, wantErr: true},
+		{name: "Overflowing string id", input: `"99999999999999999999999"`, wantErr: true},
+		{name: "Boolean", input: `true`, wantErr: true},
+		{name: "Array", input: `["12"]`, wantErr: true},
+		{name: "Invalid object", input: `{"id":"x"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got MediaParam
+			err := json.Unmarshal([]byte(tt.input), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UnmarshalJSON() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Id != tt.wantId || got.FbRefId != tt.wantRefId || got.DecodedForm != tt.wantForm {
+				t.Errorf("UnmarshalJSON() = id %v, refId %q, form %v, want id %v, refId %q, form %v",
+					got.Id, got.FbRefId, got.DecodedForm, tt.wantId, tt.wantRefId, tt.wantForm)
+			}
+			if b, err := json.Marshal(got); err != nil || b[0] != '{' {
+				t.Errorf("MarshalJSON() = %s, %v, want an object", b, err)
+			}
+			b, err := got.MarshalRef()
+			if err != nil {
+				t.Fatalf("MarshalRef() error = %v", err)
+			}
+			want := tt.wantJson
+			if want == "" {
+				want = tt.input
+			}
+			if want == "-" {
+				// Marshalled as an object, which must decode to the same media
+				var again MediaParam
+				if err := json.Unmarshal(b, &again); err != nil || again.Id != got.Id || again.FbRefId != got.FbRefId {
+					t.Errorf("round trip = %s, %v", b, err)
+				}
+				return
+			}
+			if string(b) != want {
+				t.Errorf("MarshalRef() = %s, want %s", b, want)
+			}
+		})
+	}
+}
+
+func TestMediaParamMarshalModified(t *testing.T) {
+	var media []MediaParam
+	if err := json.Unmarshal([]byte(`["12", 13, {"id":"14"}]`), &media); err != nil {
+		t.Fatal(err)
+	}
+	media[0].Description = "changed"
+	raw := make([]string, len(media))
+	for i, m := range media {
+		b, err := m.MarshalRef()
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw[i] = string(b)
+	}
+	if raw[0][0] != '{' || raw[1] != "13" || raw[2][0] != '{' {
+		t.Errorf("MarshalRef() = %q, want the modified media as an object", raw)
+	}
+}
+
+func TestParseMediaRef(t *testing.T) {
+	tests := []struct {
+		ref      string
+		wantForm MediaRefForm
+		wantErr  bool
+	}{
+		{ref: "7", wantForm: MediaRefFormIdString},
+		{ref: "a7", wantForm: MediaRefFormFbRefId},
+		{ref: "3F2B8C1E-9D4A-4E7B-A1C2-0B9E8F7D6C5A", wantForm: MediaRefFormUuid},
+		{ref: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			got, err := ParseMediaRef(tt.ref)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMediaRef() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got.DecodedForm != tt.wantForm {
+				t.Errorf("ParseMediaRef() form = %v, want %v", got.DecodedForm, tt.wantForm)
+			}
+		})
+	}
+}
@@ -141,6 +141,8 @@ type (
 		FbUpdatedAt          string                  `json:"fbUpdatedAt"`
 		Hashtags             json.RawMessage         `json:"hashtags"`
 		MediaRefInfo         json.RawMessage         `json:"mediaRefInfo"`
+		// The JSON form the media was decoded from, see UnmarshalJSON
+		DecodedForm MediaRefForm `json:"-"`
 	}
 	SimpleMediaItems struct {
 		Id                   intstring.IntString `gorm:"primaryKey" json:"id,omitempty"`
@@ -508,33 +510,6 @@ func LocationSliceToString(locationList []*Location) string {
 	return strings.Join(locationStr, "; ")
 }
 
-func (m *MediaParam) UnmarshalJSON(b []byte) error {
-	type origMediaParam MediaParam
-	var origM origMediaParam // Create new type so it doesn't reuse this unmarshaller
-	if json.Unmarshal(b, &origM) == nil {
-		// Unmarshal successful just by struct
-		a := MediaParam(origM)
-		*m = a
-		return nil
-	}
-	// Struct unmarshal unsuccessful, it must be a string
-	var str string
-	if json.Unmarshal(b, &str) == nil {
-		// Try parse as intstring
-		if id := intstring.FromString(str); id != 0 {
-			*m = MediaParam{
-				Id: id,
-			}
-		}
-		// If not, treat as refId
-		*m = MediaParam{
-			FbRefId: str,
-		}
-		return nil
-	}
-	return errors.New("cannot unmarshal MediaParam, not a struct nor a string of id")
-}
-
 // SanitizeForCreate clears all models inside a struct for creation.
 // It looks inside nested structs and arrays
 func SanitizeForCreate(mdl interface{}, creatorRefKey string) interface{} {
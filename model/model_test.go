@@ -70,3 +70,20 @@ func TestSanitizeForCreate(t *testing.T) {
 		})
 	}
 }
+
+func TestGetCoreContractResponseDeepCopy(t *testing.T) {
+	desc := "desc"
+	orig := GetCoreContractResponse{
+		CoreContract: CoreContract{ContractNo: "C1", ContractDesc: &desc},
+		Parties:      []interface{}{map[string]interface{}{"id": "1", "roles": []interface{}{"admin"}}},
+	}
+	c := orig.DeepCopy()
+	*c.ContractDesc = "modified"
+	party := c.Parties[0].(map[string]interface{})
+	party["id"] = "2"
+	party["roles"].([]interface{})[0] = "modified"
+	origParty := orig.Parties[0].(map[string]interface{})
+	if desc != "desc" || origParty["id"] != "1" || origParty["roles"].([]interface{})[0] != "admin" {
+		t.Errorf("original modified through its copy: %s %v", desc, origParty)
+	}
+}
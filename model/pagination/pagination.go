@@ -41,6 +41,21 @@ func (p *Pagination) GetSort() string {
 	return p.Sort
 }
 
+// Params returns the request parameters of p to be sent to other modules.
+// Result fields (TotalRows, TotalPages and Rows) are not included.
+// Sort is only included if it is explicitly set.
+func (p *Pagination) Params() map[string]interface{} {
+	params := map[string]interface{}{
+		"isPaginate": true,
+		"limit":      p.GetLimit(),
+		"page":       p.GetPage(),
+	}
+	if p.Sort != "" {
+		params["sort"] = p.Sort
+	}
+	return params
+}
+
 func Paginate(value interface{}, pagination *Pagination, db *gorm.DB) func(db *gorm.DB) *gorm.DB {
 	var (
 		totalRows int64
@@ -0,0 +1,318 @@
+/*
+This package builds an in-memory organisation graph of a contract, linking its
+parties, groups, users and roles together.
+
+The graph is loaded once with Load() and can then be queried locally, e.g.
+
+	g, err := org.Load(tk, contractId)
+	safetyOfficers := g.UsersWithRole(partyId, "Safety Officer")
+	clientAdmins := g.ClientAdmins()
+	userIds := g.ExpandRecipients(userIds, groupIds, partyIds)
+
+The graph is a snapshot and is not updated after loading.
+*/
+package org
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/apis/core"
+	"github.com/Mobility-Development-Team/be-common-mdl/apis/system"
+	"github.com/Mobility-Development-Team/be-common-mdl/apis/user"
+	"github.com/Mobility-Development-Team/be-common-mdl/model"
+	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+	"github.com/Mobility-Development-Team/be-common-mdl/util/concutil"
+	logger "github.com/sirupsen/logrus"
+)
+
+type (
+	Graph struct {
+		ContractId    intstring.IntString
+		ClientPartyId intstring.IntString
+		Parties       map[intstring.IntString]*Party
+		Groups        map[intstring.IntString]*Group
+		Users         map[intstring.IntString]model.UserInfo
+		Roles         map[intstring.IntString]model.CoreRole
+	}
+	Party struct {
+		Info     system.ContractParty
+		AdminIds []intstring.IntString
+		// User ids of the party keyed by role name
+		RoleUserIds map[string][]intstring.IntString
+	}
+	Group struct {
+		Info      model.GroupInfo
+		MemberIds []intstring.IntString
+	}
+)
+
+// Load builds the organisation graph of a contract.
+//
+// Parties, roles, groups and users are loaded in bulk. Role members, party admins and group
+// members are loaded concurrently per party / group since there is no bulk endpoint for them.
+func Load(tk string, contractId intstring.IntString) (*Graph, error) {
+	g := &Graph{
+		ContractId: contractId,
+		Parties:    map[intstring.IntString]*Party{},
+		Groups:     map[intstring.IntString]*Group{},
+		Users:      map[intstring.IntString]model.UserInfo{},
+		Roles:      map[intstring.IntString]model.CoreRole{},
+	}
+	parties, err := system.GetContractParties(tk, contractId)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get contract parties: %w", err)
+	}
+	var userIds []intstring.IntString
+	for _, p := range parties {
+		g.Parties[p.Info.Id] = &Party{
+			Info:        p,
+			RoleUserIds: map[string][]intstring.IntString{},
+		}
+		userIds = append(userIds, p.UserIds...)
+	}
+	if client, err := system.GetClientPartyByContractIds(tk, []intstring.IntString{contractId}); err != nil {
+		logger.Warnf("[org][Load] Unable to get client party of contract %s, ignoring: %v", contractId, err)
+	} else if c := client[contractId]; c != nil {
+		g.ClientPartyId = c.Info.Id
+	}
+	roles, err := core.GetAllRole(tk)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get roles: %w", err)
+	}
+	for _, r := range roles {
+		g.Roles[r.Id] = r
+	}
+	groups, err := user.GetAllGroupInfoByCriteria(tk, *user.NewGroupCriteria(contractId))
+	if err != nil {
+		return nil, fmt.Errorf("unable to get groups: %w", err)
+	}
+	for _, gi := range groups {
+		g.Groups[gi.Id] = &Group{Info: gi}
+	}
+	users, err := core.GetUsersByIds(tk, uniqueIds(userIds), nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get users: %w", err)
+	}
+	for _, u := range users {
+		g.Users[u.Id] = u
+	}
+	if err := g.loadMembers(tk); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (g *Graph) loadMembers(tk string) error {
+	partyIds := make([]intstring.IntString, 0, len(g.Parties))
+	var awaiters []*concutil.Awaiter
+	for partyId, party := range g.Parties {
+		partyId, party := partyId, party
+		partyIds = append(partyIds, partyId)
+		for _, roleId := range party.Info.RoleIds {
+			role, ok := g.Roles[roleId]
+			if !ok {
+				logger.Warnf("[org][Load] Role %s of party %s not found, ignoring", roleId, partyId)
+				continue
+			}
+			awaiters = append(awaiters, concutil.Async(func() (interface{}, error) {
+				users, err := core.GetUsersByRoleAndParty(tk, role.RoleName, g.ContractId, partyId)
+				if err != nil {
+					return nil, fmt.Errorf("unable to get users of role %s in party %s: %w", role.RoleName, partyId, err)
+				}
+				return roleUsers{partyId: partyId, roleName: role.RoleName, userIds: UserIds(users)}, nil
+			}))
+		}
+	}
+	groups := make([]model.GroupInfo, 0, len(g.Groups))
+	for _, group := range g.Groups {
+		groups = append(groups, group.Info)
+	}
+	adminAwaiter := concutil.Async(func() (interface{}, error) {
+		return PartyAdminIds(tk, g.ContractId, partyIds)
+	})
+	memberAwaiter := concutil.Async(func() (interface{}, error) {
+		return GroupMemberIds(tk, groups)
+	})
+	for _, a := range append(awaiters, adminAwaiter, memberAwaiter) {
+		if err := a.Await(); err != nil {
+			return err
+		}
+		// Role users are collected here so that the party maps are not written concurrently
+		if ru, ok := a.Get().(roleUsers); ok {
+			g.Parties[ru.partyId].RoleUserIds[ru.roleName] = ru.userIds
+		}
+	}
+	for partyId, adminIds := range adminAwaiter.Get().(map[intstring.IntString][]intstring.IntString) {
+		g.Parties[partyId].AdminIds = adminIds
+	}
+	for groupId, memberIds := range memberAwaiter.Get().(map[intstring.IntString][]intstring.IntString) {
+		g.Groups[groupId].MemberIds = memberIds
+	}
+	return nil
+}
+
+// PartyAdminIds loads the user ids of the admins of each party of a contract concurrently, by party id
+func PartyAdminIds(tk string, contractId intstring.IntString, partyIds []intstring.IntString) (map[intstring.IntString][]intstring.IntString, error) {
+	awaiters := make([]*concutil.Awaiter, len(partyIds))
+	for i, partyId := range partyIds {
+		partyId := partyId
+		awaiters[i] = concutil.Async(func() (interface{}, error) {
+			admins, err := core.GetAdminUsers(tk, contractId, partyId)
+			if err != nil {
+				return nil, fmt.Errorf("unable to get admins of party %s: %w", partyId, err)
+			}
+			return UserIds(admins), nil
+		})
+	}
+	result := make(map[intstring.IntString][]intstring.IntString, len(partyIds))
+	for i, a := range awaiters {
+		if err := a.Await(); err != nil {
+			return nil, err
+		}
+		result[partyIds[i]] = a.Get().([]intstring.IntString)
+	}
+	return result, nil
+}
+
+// GroupMemberIds loads the user ids of the members of each group concurrently, by group id
+func GroupMemberIds(tk string, groups []model.GroupInfo) (map[intstring.IntString][]intstring.IntString, error) {
+	awaiters := make([]*concutil.Awaiter, len(groups))
+	for i, info := range groups {
+		info := info
+		awaiters[i] = concutil.Async(func() (interface{}, error) {
+			members, err := user.GetUsersByGroupDetails(tk, &info.Name, &info.ContractRefId, &info.PartyRefId)
+			if err != nil {
+				return nil, fmt.Errorf("unable to get members of group %s: %w", info.Name, err)
+			}
+			return UserIds(members), nil
+		})
+	}
+	result := make(map[intstring.IntString][]intstring.IntString, len(groups))
+	for i, a := range awaiters {
+		if err := a.Await(); err != nil {
+			return nil, err
+		}
+		result[groups[i].Id] = a.Get().([]intstring.IntString)
+	}
+	return result, nil
+}
+
+type roleUsers struct {
+	partyId  intstring.IntString
+	roleName string
+	userIds  []intstring.IntString
+}
+
+// UsersOfParty returns all users of a party
+func (g *Graph) UsersOfParty(partyId intstring.IntString) []model.UserInfo {
+	party, ok := g.Parties[partyId]
+	if !ok {
+		return []model.UserInfo{}
+	}
+	return g.usersByIds(party.Info.UserIds)
+}
+
+// UsersWithRole returns all users of a party having the given role
+func (g *Graph) UsersWithRole(partyId intstring.IntString, roleName string) []model.UserInfo {
+	party, ok := g.Parties[partyId]
+	if !ok {
+		return []model.UserInfo{}
+	}
+	return g.usersByIds(party.RoleUserIds[roleName])
+}
+
+// Admins returns the admins of a party
+func (g *Graph) Admins(partyId intstring.IntString) []model.UserInfo {
+	party, ok := g.Parties[partyId]
+	if !ok {
+		return []model.UserInfo{}
+	}
+	return g.usersByIds(party.AdminIds)
+}
+
+// ClientAdmins returns the admins of the client party of the contract
+func (g *Graph) ClientAdmins() []model.UserInfo {
+	return g.Admins(g.ClientPartyId)
+}
+
+// GroupMembers returns the members of a group
+func (g *Graph) GroupMembers(groupId intstring.IntString) []model.UserInfo {
+	group, ok := g.Groups[groupId]
+	if !ok {
+		return []model.UserInfo{}
+	}
+	return g.usersByIds(group.MemberIds)
+}
+
+// PartiesOfUser returns the ids of all parties the user belongs to, in ascending order
+func (g *Graph) PartiesOfUser(userId intstring.IntString) []intstring.IntString {
+	var result []intstring.IntString
+	for partyId, party := range g.Parties {
+		for _, id := range party.Info.UserIds {
+			if id == userId {
+				result = append(result, partyId)
+				break
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
+
+// ExpandRecipients expands groups and party admins into user ids and merges them with userIds.
+// The result is deduplicated and keeps the order of first appearance.
+func (g *Graph) ExpandRecipients(userIds, groupIds, partyAdminIds []intstring.IntString) []intstring.IntString {
+	result := make([]intstring.IntString, 0, len(userIds))
+	result = append(result, userIds...)
+	for _, groupId := range groupIds {
+		if group, ok := g.Groups[groupId]; ok {
+			result = append(result, group.MemberIds...)
+		} else {
+			logger.Warnf("[org][ExpandRecipients] Group %s not found in contract %s, ignoring", groupId, g.ContractId)
+		}
+	}
+	for _, partyId := range partyAdminIds {
+		if party, ok := g.Parties[partyId]; ok {
+			result = append(result, party.AdminIds...)
+		} else {
+			logger.Warnf("[org][ExpandRecipients] Party %s not found in contract %s, ignoring", partyId, g.ContractId)
+		}
+	}
+	return uniqueIds(result)
+}
+
+// usersByIds returns the loaded users of ids, users not found in the graph are returned with the id only
+func (g *Graph) usersByIds(ids []intstring.IntString) []model.UserInfo {
+	result := make([]model.UserInfo, 0, len(ids))
+	for _, id := range ids {
+		u, ok := g.Users[id]
+		if !ok {
+			u = model.UserInfo{Model: model.Model{Id: id}}
+		}
+		result = append(result, u)
+	}
+	return result
+}
+
+// UserIds returns the ids of users
+func UserIds(users []model.UserInfo) []intstring.IntString {
+	ids := make([]intstring.IntString, 0, len(users))
+	for _, u := range users {
+		ids = append(ids, u.Id)
+	}
+	return ids
+}
+
+func uniqueIds(ids []intstring.IntString) []intstring.IntString {
+	seen := make(map[intstring.IntString]struct{}, len(ids))
+	result := make([]intstring.IntString, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := seen[id]; ok || id == 0 {
+			continue
+		}
+		seen[id] = struct{}{}
+		result = append(result, id)
+	}
+	return result
+}
@@ -0,0 +1,86 @@
+package org
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/apis/system"
+	"github.com/Mobility-Development-Team/be-common-mdl/model"
+	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+)
+
+func newTestGraph() *Graph {
+	client := system.ContractParty{UserIds: []intstring.IntString{1, 2, 3}}
+	client.Info.Id = 10
+	contractor := system.ContractParty{UserIds: []intstring.IntString{3, 4}}
+	contractor.Info.Id = 20
+	users := map[intstring.IntString]model.UserInfo{}
+	for _, id := range []intstring.IntString{1, 2, 3, 4} {
+		users[id] = model.UserInfo{Model: model.Model{Id: id}, DisplayName: "User " + id.String()}
+	}
+	return &Graph{
+		ContractId:    38,
+		ClientPartyId: 10,
+		Parties: map[intstring.IntString]*Party{
+			10: {Info: client, AdminIds: []intstring.IntString{1}, RoleUserIds: map[string][]intstring.IntString{"Engineer": {2, 3}}},
+			20: {Info: contractor, AdminIds: []intstring.IntString{4}, RoleUserIds: map[string][]intstring.IntString{"Engineer": {3}}},
+		},
+		Groups: map[intstring.IntString]*Group{
+			100: {MemberIds: []intstring.IntString{2, 4}},
+		},
+		Users: users,
+	}
+}
+
+func TestGraphQueries(t *testing.T) {
+	g := newTestGraph()
+	if got := UserIds(g.UsersWithRole(10, "Engineer")); !reflect.DeepEqual(got, []intstring.IntString{2, 3}) {
+		t.Errorf("UsersWithRole() = %v", got)
+	}
+	if got := UserIds(g.ClientAdmins()); !reflect.DeepEqual(got, []intstring.IntString{1}) {
+		t.Errorf("ClientAdmins() = %v", got)
+	}
+	if got := g.PartiesOfUser(3); !reflect.DeepEqual(got, []intstring.IntString{10, 20}) {
+		t.Errorf("PartiesOfUser() = %v", got)
+	}
+	if got := g.UsersOfParty(99); len(got) != 0 {
+		t.Errorf("UsersOfParty() of unknown party = %v", got)
+	}
+}
+
+func TestExpandRecipients(t *testing.T) {
+	g := newTestGraph()
+	type args struct {
+		userIds       []intstring.IntString
+		groupIds      []intstring.IntString
+		partyAdminIds []intstring.IntString
+	}
+	tests := []struct {
+		name string
+		args args
+		want []intstring.IntString
+	}{
+		{
+			name: "Users only",
+			args: args{userIds: []intstring.IntString{3, 3, 1}},
+			want: []intstring.IntString{3, 1},
+		},
+		{
+			name: "Groups and admins",
+			args: args{
+				userIds:       []intstring.IntString{4},
+				groupIds:      []intstring.IntString{100, 999},
+				partyAdminIds: []intstring.IntString{10, 20},
+			},
+			want: []intstring.IntString{4, 2, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := g.ExpandRecipients(tt.args.userIds, tt.args.groupIds, tt.args.partyAdminIds)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ExpandRecipients() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package cacheutil
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	logger "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const (
+	DefaultTTL           = 10 * time.Minute
+	DefaultRetryInterval = time.Minute
+	// Default MaxEntries of CallerCache, tokens are short-lived so entries of past tokens pile up
+	DefaultCallerMaxEntries = 1000
+)
+
+// Freshness describes how up to date a cached value is
+type Freshness struct {
+	FetchedAt time.Time // When the value was last fetched successfully
+	Stale     bool      // Whether the value is older than the TTL
+	LastError error     // Error of the last failed refresh, nil if the last refresh succeeded
+}
+
+// Age returns how long ago the value was fetched
+func (f Freshness) Age() time.Duration {
+	return time.Since(f.FetchedAt)
+}
+
+// SWRCache is a stale-while-revalidate cache for slow-changing reference data.
+//
+// A value older than TTL is still served while it is refreshed in the background.
+// If the refresh fails, the last good value continues to be served and the refresh is
+// retried on access after RetryInterval. Only the first fetch of a key is synchronous.
+type SWRCache[K comparable, V any] struct {
+	TTL           time.Duration
+	RetryInterval time.Duration
+	// The entry fetched the longest ago is evicted when a new key would exceed it, zero for unlimited
+	MaxEntries int
+
+	mu      sync.Mutex
+	entries map[K]*swrEntry[V]
+	now     func() time.Time
+	// Incremented by Invalidate and InvalidateFunc, so that a fetch started before is not stored
+	invalidations uint64
+}
+
+type swrEntry[V any] struct {
+	value       V
+	fetchedAt   time.Time
+	lastAttempt time.Time
+	lastErr     error
+	refreshing  bool
+}
+
+func NewSWRCache[K comparable, V any](ttl, retryInterval time.Duration) *SWRCache[K, V] {
+	return &SWRCache[K, V]{
+		TTL:           ttl,
+		RetryInterval: retryInterval,
+		entries:       map[K]*swrEntry[V]{},
+		now:           time.Now,
+	}
+}
+
+// NewSWRCacheFromConfig creates a cache configured by the following keys under `prefix`:
+//
+//	[prefix].ttl    /* e.g. "10m", defaults to DefaultTTL */
+//	[prefix].retry  /* e.g. "1m", defaults to DefaultRetryInterval */
+//	[prefix].max    /* e.g. 500, defaults to unlimited */
+func NewSWRCacheFromConfig[K comparable, V any](v *viper.Viper, prefix string) *SWRCache[K, V] {
+	ttl, retry := DefaultTTL, DefaultRetryInterval
+	if d := v.GetDuration(prefix + ".ttl"); d > 0 {
+		ttl = d
+	}
+	if d := v.GetDuration(prefix + ".retry"); d > 0 {
+		retry = d
+	}
+	c := NewSWRCache[K, V](ttl, retry)
+	c.MaxEntries = v.GetInt(prefix + ".max")
+	return c
+}
+
+// Get returns the cached value of key, calling fetch if it is not cached yet.
+//
+// If a value is cached, it is returned immediately regardless of its age, and fetch is
+// called in the background if the value is stale. An error is only returned if the key
+// has never been fetched successfully.
+func (c *SWRCache[K, V]) Get(key K, fetch func() (V, error)) (V, Freshness, error) {
+	c.mu.Lock()
+	now := c.now()
+	e, ok := c.entries[key]
+	if !ok {
+		c.mu.Unlock()
+		return c.fetchNow(key, fetch)
+	}
+	freshness := Freshness{
+		FetchedAt: e.fetchedAt,
+		Stale:     now.Sub(e.fetchedAt) > c.TTL,
+		LastError: e.lastErr,
+	}
+	value := e.value
+	if freshness.Stale && !e.refreshing && now.Sub(e.lastAttempt) > c.RetryInterval {
+		e.refreshing = true
+		e.lastAttempt = now
+		go c.refresh(key, e, fetch)
+	}
+	c.mu.Unlock()
+	return value, freshness, nil
+}
+
+// Contains reports whether a value of key is cached, regardless of its age
+func (c *SWRCache[K, V]) Contains(key K) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.entries[key]
+	return ok
+}
+
+// Set caches a value fetched by other means, e.g. in a batch, as if it was fetched by Get
+func (c *SWRCache[K, V]) Set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.store(key, value)
+}
+
+// Invalidate removes key from the cache, the next Get fetches the value synchronously
+func (c *SWRCache[K, V]) Invalidate(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.invalidations++
+	delete(c.entries, key)
+}
+
+// InvalidateFunc removes all keys matching match from the cache
+func (c *SWRCache[K, V]) InvalidateFunc(match func(key K) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.invalidations++
+	for key := range c.entries {
+		if match(key) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+func (c *SWRCache[K, V]) fetchNow(key K, fetch func() (V, error)) (V, Freshness, error) {
+	c.mu.Lock()
+	invalidations := c.invalidations
+	c.mu.Unlock()
+	value, err := fetch()
+	if err != nil {
+		return value, Freshness{LastError: err}, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.invalidations != invalidations {
+		// Invalidated during the fetch, the value may be older than the invalidation
+		return value, Freshness{FetchedAt: c.now()}, nil
+	}
+	if _, ok := c.entries[key]; ok {
+		// Stored by a concurrent Get or Set in the meantime, which is not older than this value
+		return value, Freshness{FetchedAt: c.now()}, nil
+	}
+	return value, Freshness{FetchedAt: c.store(key, value)}, nil
+}
+
+func (c *SWRCache[K, V]) store(key K, value V) time.Time {
+	now := c.now()
+	if _, ok := c.entries[key]; !ok && c.MaxEntries > 0 && len(c.entries) >= c.MaxEntries {
+		c.evictOldest()
+	}
+	c.entries[key] = &swrEntry[V]{
+		value:       value,
+		fetchedAt:   now,
+		lastAttempt: now,
+	}
+	return now
+}
+
+// refresh fetches key again and updates e, unless e has been invalidated or replaced in the
+// meantime, in which case the value fetched may be older than the current one
+func (c *SWRCache[K, V]) refresh(key K, e *swrEntry[V], fetch func() (V, error)) {
+	value, err := fetch()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if current, ok := c.entries[key]; !ok || current != e {
+		return
+	}
+	e.refreshing = false
+	if err != nil {
+		logger.Warnf("[SWRCache] Unable to refresh %v, serving value fetched at %s: %v", key, e.fetchedAt.Format(time.RFC3339), err)
+		e.lastErr = err
+		return
+	}
+	e.value = value
+	e.fetchedAt = c.now()
+	e.lastErr = nil
+}
+
+func (c *SWRCache[K, V]) evictOldest() {
+	var oldest K
+	var oldestAt time.Time
+	found := false
+	for key, e := range c.entries {
+		if !found || e.fetchedAt.Before(oldestAt) {
+			oldest, oldestAt, found = key, e.fetchedAt, true
+		}
+	}
+	if found {
+		delete(c.entries, oldest)
+	}
+}
+
+// Lazy returns a function returning the value created by newValue on its first call, e.g. for a
+// cache configured by apis.V() which is only available after apis.Init
+func Lazy[T any](newValue func() T) func() T {
+	var once sync.Once
+	var value T
+	return func() T {
+		once.Do(func() { value = newValue() })
+		return value
+	}
+}
+
+// CallerCache is a SWRCache of access-controlled data, e.g. a contract. Values are cached per
+// caller token so that a value fetched for one caller is never served to another, and refreshed
+// with the token of the caller they are cached for.
+type CallerCache[K comparable, V any] struct {
+	cache *SWRCache[callerKey[K], V]
+}
+
+type callerKey[K comparable] struct {
+	caller string
+	key    K
+}
+
+// NewCallerCacheFromConfig creates a CallerCache configured like NewSWRCacheFromConfig,
+// MaxEntries defaults to DefaultCallerMaxEntries.
+func NewCallerCacheFromConfig[K comparable, V any](v *viper.Viper, prefix string) *CallerCache[K, V] {
+	c := NewSWRCacheFromConfig[callerKey[K], V](v, prefix)
+	if c.MaxEntries <= 0 {
+		c.MaxEntries = DefaultCallerMaxEntries
+	}
+	return &CallerCache[K, V]{cache: c}
+}
+
+// Get is SWRCache.Get for the caller authorized by tk
+func (c *CallerCache[K, V]) Get(tk string, key K, fetch func() (V, error)) (V, Freshness, error) {
+	return c.cache.Get(callerKey[K]{caller: CallerKey(tk), key: key}, fetch)
+}
+
+// Contains is SWRCache.Contains for the caller authorized by tk
+func (c *CallerCache[K, V]) Contains(tk string, key K) bool {
+	return c.cache.Contains(callerKey[K]{caller: CallerKey(tk), key: key})
+}
+
+// Set is SWRCache.Set for the caller authorized by tk
+func (c *CallerCache[K, V]) Set(tk string, key K, value V) {
+	c.cache.Set(callerKey[K]{caller: CallerKey(tk), key: key}, value)
+}
+
+// Invalidate removes key from the cache for all callers
+func (c *CallerCache[K, V]) Invalidate(key K) {
+	c.cache.InvalidateFunc(func(k callerKey[K]) bool { return k.key == key })
+}
+
+// InvalidateAll removes all keys from the cache for all callers
+func (c *CallerCache[K, V]) InvalidateAll() {
+	c.cache.InvalidateFunc(func(callerKey[K]) bool { return true })
+}
+
+// CallerKey returns a key identifying the caller authorized by tk without keeping the token itself
+func CallerKey(tk string) string {
+	sum := sha256.Sum256([]byte(tk))
+	return hex.EncodeToString(sum[:])
+}
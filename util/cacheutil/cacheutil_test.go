@@ -0,0 +1,181 @@
+package cacheutil
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+	"github.com/spf13/viper"
+)
+
+func TestSWRCache(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewSWRCache[string, string](time.Minute, 10*time.Second)
+	c.now = func() time.Time { return now }
+
+	var calls int32
+	refreshed := make(chan struct{}, 1)
+	fetch := func(value string, err error) func() (string, error) {
+		return func() (string, error) {
+			atomic.AddInt32(&calls, 1)
+			defer func() {
+				select {
+				case refreshed <- struct{}{}:
+				default:
+				}
+			}()
+			return value, err
+		}
+	}
+
+	if _, _, err := c.Get("k", fetch("", errors.New("down"))); err == nil {
+		t.Fatal("Get() expected error on first failed fetch")
+	}
+	<-refreshed
+	v, f, err := c.Get("k", fetch("v1", nil))
+	<-refreshed
+	if err != nil || v != "v1" || f.Stale {
+		t.Fatalf("Get() = %v, %+v, %v", v, f, err)
+	}
+
+	// Fresh value is served without fetching
+	now = now.Add(30 * time.Second)
+	if v, _, _ := c.Get("k", fetch("v2", nil)); v != "v1" || atomic.LoadInt32(&calls) != 2 {
+		t.Fatalf("Get() = %v with %d calls, want cached value", v, calls)
+	}
+
+	// Stale value is served while a failed refresh happens in the background
+	now = now.Add(time.Minute)
+	if v, f, _ := c.Get("k", fetch("", errors.New("down"))); v != "v1" || !f.Stale {
+		t.Fatalf("Get() = %v, %+v, want stale v1", v, f)
+	}
+	<-refreshed
+	if _, f, _ := c.Get("k", fetch("v2", nil)); f.LastError == nil {
+		t.Fatalf("Get() freshness = %+v, want last error", f)
+	}
+	if atomic.LoadInt32(&calls) != 3 {
+		t.Fatalf("refresh retried before retry interval, calls = %d", calls)
+	}
+
+	// Refresh is retried after the retry interval
+	now = now.Add(11 * time.Second)
+	c.Get("k", fetch("v2", nil))
+	<-refreshed
+	time.Sleep(10 * time.Millisecond)
+	if v, f, _ := c.Get("k", fetch("v3", nil)); v != "v2" || f.Stale || f.LastError != nil {
+		t.Fatalf("Get() = %v, %+v, want refreshed v2", v, f)
+	}
+}
+
+func TestCallerCache(t *testing.T) {
+	c := NewCallerCacheFromConfig[int, string](viper.New(), "test")
+	c.cache.MaxEntries = 2
+	fetch := func(value string) func() (string, error) {
+		return func() (string, error) { return value, nil }
+	}
+
+	if v, _, _ := c.Get("tk-a", 1, fetch("a1")); v != "a1" {
+		t.Fatalf("Get() = %v, want a1", v)
+	}
+	// Another caller never gets the value fetched for the first one
+	if v, _, _ := c.Get("tk-b", 1, fetch("b1")); v != "b1" {
+		t.Fatalf("Get() = %v, want b1", v)
+	}
+	if v, _, _ := c.Get("tk-a", 1, fetch("x")); v != "a1" {
+		t.Fatalf("Get() = %v, want cached a1", v)
+	}
+
+	// The oldest entry is evicted beyond MaxEntries
+	c.Get("tk-c", 1, fetch("c1"))
+	if len(c.cache.entries) != 2 {
+		t.Fatalf("%d entries cached, want 2", len(c.cache.entries))
+	}
+
+	c.Invalidate(1)
+	if len(c.cache.entries) != 0 {
+		t.Fatalf("%d entries cached after Invalidate, want 0", len(c.cache.entries))
+	}
+}
+
+// testContract is a contract sharing its Parties unless deep copied
+type testContract struct {
+	Parties []string
+}
+
+func (c testContract) DeepCopy() testContract {
+	c.Parties = append([]string{}, c.Parties...)
+	return c
+}
+
+func TestSWRCacheInvalidateDuringFetch(t *testing.T) {
+	c := NewSWRCache[string, string](time.Minute, time.Second)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	c.Get("k", func() (string, error) { return "v1", nil })
+
+	// A stale refresh finishing after the key is invalidated and fetched again is dropped
+	now = now.Add(2 * time.Minute)
+	started, release, done := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	c.Get("k", func() (string, error) {
+		defer close(done)
+		close(started)
+		<-release
+		return "old", nil
+	})
+	<-started
+	c.Invalidate("k")
+	if v, _, _ := c.Get("k", func() (string, error) { return "new", nil }); v != "new" {
+		t.Fatalf("Get() = %v, want new", v)
+	}
+	close(release)
+	<-done
+	if v, _, _ := c.Get("k", func() (string, error) { return "x", nil }); v != "new" {
+		t.Errorf("Get() = %v, want new after the stale refresh", v)
+	}
+
+	// Neither is a first fetch started before Invalidate
+	c.Invalidate("k")
+	if v, _, _ := c.Get("k", func() (string, error) {
+		c.Invalidate("k")
+		return "old", nil
+	}); v != "old" || c.Contains("k") {
+		t.Errorf("Get() = %v, cached %v, want old not cached", v, c.Contains("k"))
+	}
+}
+
+func TestReferenceDataCacheContractCopy(t *testing.T) {
+	r := NewReferenceDataCache[testContract](viper.New, "supportinfo", "contract",
+		func() (map[string]string, error) { return nil, nil },
+		func(tk string, contractId intstring.IntString) (*testContract, error) {
+			return &testContract{Parties: []string{"p1"}}, nil
+		},
+	)
+	contract, _, err := r.Contract("tk", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contract.Parties[0] = "modified"
+	if contract, _, _ := r.Contract("tk", 1); contract.Parties[0] != "p1" {
+		t.Errorf("cached contract modified by a caller: %v", contract)
+	}
+}
+
+func TestReferenceDataCacheSupportInfo(t *testing.T) {
+	r := NewReferenceDataCache[testContract](viper.New, "supportinfo", "contract",
+		func() (map[string]string, error) { return map[string]string{"k": "v"}, nil },
+		func(tk string, contractId intstring.IntString) (*testContract, error) { return nil, nil },
+	)
+	info, _, err := r.SupportInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	info["k"] = "modified"
+	if info, _, _ := r.SupportInfo(); info["k"] != "v" {
+		t.Errorf("cached support info modified by a caller: %v", info)
+	}
+	if _, _, err := r.Contract("tk", 1); err == nil {
+		t.Errorf("Contract() expected error on nil contract")
+	}
+}
@@ -0,0 +1,82 @@
+package cacheutil
+
+import (
+	"errors"
+
+	"github.com/Mobility-Development-Team/be-common-mdl/types/intstring"
+	"github.com/spf13/viper"
+)
+
+// ReferenceDataCache caches the reference data served by both the core and system modules:
+// the support info, which is public and shared by all callers, and contracts of type C, which
+// are access-controlled and cached per caller, see CallerCache. Callers get a deep copy of the
+// cached contracts so that they are free to modify them.
+type ReferenceDataCache[C interface{ DeepCopy() C }] struct {
+	supportInfo    func() *SWRCache[string, map[string]string]
+	contracts      func() *CallerCache[intstring.IntString, C]
+	getSupportInfo func() (map[string]string, error)
+	getContract    func(tk string, contractId intstring.IntString) (*C, error)
+}
+
+// NewReferenceDataCache creates the caches on first use, configured under supportInfoConfig and
+// contractConfig of the config returned by v, see NewSWRCacheFromConfig
+func NewReferenceDataCache[C interface{ DeepCopy() C }](
+	v func() *viper.Viper,
+	supportInfoConfig, contractConfig string,
+	getSupportInfo func() (map[string]string, error),
+	getContract func(tk string, contractId intstring.IntString) (*C, error),
+) *ReferenceDataCache[C] {
+	return &ReferenceDataCache[C]{
+		supportInfo: Lazy(func() *SWRCache[string, map[string]string] {
+			return NewSWRCacheFromConfig[string, map[string]string](v(), supportInfoConfig)
+		}),
+		contracts: Lazy(func() *CallerCache[intstring.IntString, C] {
+			return NewCallerCacheFromConfig[intstring.IntString, C](v(), contractConfig)
+		}),
+		getSupportInfo: getSupportInfo,
+		getContract:    getContract,
+	}
+}
+
+// SupportInfo returns a copy of the cached support info, which the caller is free to modify
+func (r *ReferenceDataCache[C]) SupportInfo() (map[string]string, Freshness, error) {
+	supportInfo, freshness, err := r.supportInfo().Get("", func() (map[string]string, error) {
+		supportInfo, err := r.getSupportInfo()
+		if err == nil && supportInfo == nil {
+			err = errors.New("nil support info received")
+		}
+		return supportInfo, err
+	})
+	if err != nil {
+		return nil, freshness, err
+	}
+	result := make(map[string]string, len(supportInfo))
+	for k, v := range supportInfo {
+		result[k] = v
+	}
+	return result, freshness, nil
+}
+
+// Contract returns a deep copy of the contract as seen by the caller authorized by tk
+func (r *ReferenceDataCache[C]) Contract(tk string, contractId intstring.IntString) (C, Freshness, error) {
+	contract, freshness, err := r.contracts().Get(tk, contractId, func() (C, error) {
+		var zero C
+		contract, err := r.getContract(tk, contractId)
+		if err != nil {
+			return zero, err
+		}
+		if contract == nil {
+			return zero, errors.New("nil contract received")
+		}
+		return *contract, nil
+	})
+	if err != nil {
+		return contract, freshness, err
+	}
+	return contract.DeepCopy(), freshness, nil
+}
+
+// InvalidateContract removes a contract from the cache of all callers
+func (r *ReferenceDataCache[C]) InvalidateContract(contractId intstring.IntString) {
+	r.contracts().Invalidate(contractId)
+}
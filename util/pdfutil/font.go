@@ -0,0 +1,262 @@
+package pdfutil
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Fonts used by Document. Latin text uses the standard Helvetica fonts, Chinese text uses the
+// standard traditional Chinese font MSung-Light which is not embedded, it is provided by the
+// PDF reader (Acrobat, pdf.js, Preview, Chrome...), see Document for the limitations.
+const (
+	fontRegular = "F1"
+	fontBold    = "F2"
+	fontZh      = "F3"
+
+	zhFontName = "MSung-Light"
+	// Width of a glyph of MSung-Light in 1/1000 of the font size
+	zhGlyphWidth = 1000
+	// Replaces characters which cannot be encoded in UCS-2
+	zhReplacement = 0x3013
+)
+
+var (
+	// Widths of the characters 32 to 126 of Helvetica and Helvetica-Bold, from their AFM files
+	helveticaWidths = [95]int{
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	}
+	helveticaBoldWidths = [95]int{
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	}
+	// Characters of WinAnsiEncoding outside Latin-1 and their approximate widths
+	winAnsiExtra = map[rune]struct {
+		code  byte
+		width int
+	}{
+		'€': {0x80, 556}, '‚': {0x82, 222}, 'ƒ': {0x83, 556}, '„': {0x84, 333}, '…': {0x85, 1000},
+		'†': {0x86, 556}, '‡': {0x87, 556}, 'ˆ': {0x88, 333}, '‰': {0x89, 1000}, 'Š': {0x8a, 667},
+		'‹': {0x8b, 333}, 'Œ': {0x8c, 1000}, 'Ž': {0x8e, 611}, '‘': {0x91, 222}, '’': {0x92, 222},
+		'“': {0x93, 333}, '”': {0x94, 333}, '•': {0x95, 350}, '–': {0x96, 556}, '—': {0x97, 1000},
+		'˜': {0x98, 333}, '™': {0x99, 1000}, 'š': {0x9a, 500}, '›': {0x9b, 333}, 'œ': {0x9c, 944},
+		'ž': {0x9e, 500}, 'Ÿ': {0x9f, 667},
+	}
+)
+
+type (
+	// token is a unit of line wrapping, a Latin word with its trailing spaces or a single Chinese character
+	token struct {
+		text  string
+		zh    bool
+		width float64
+		// Width of the trailing spaces, not counted at the end of a line
+		spaceWidth float64
+	}
+	line []token
+)
+
+// winAnsi returns the WinAnsiEncoding code of r and its width in Helvetica
+func winAnsi(r rune, bold bool) (byte, int, bool) {
+	switch {
+	case r >= 32 && r <= 126:
+		if bold {
+			return byte(r), helveticaBoldWidths[r-32], true
+		}
+		return byte(r), helveticaWidths[r-32], true
+	case r >= 0xa0 && r <= 0xff:
+		return byte(r), 556, true
+	}
+	if e, ok := winAnsiExtra[r]; ok {
+		return e.code, e.width, true
+	}
+	return 0, 0, false
+}
+
+func isZh(r rune) bool {
+	_, _, ok := winAnsi(r, false)
+	return !ok && r != '\t'
+}
+
+// textWidth returns the width of s in points
+func textWidth(s string, size float64, bold bool) float64 {
+	total := 0
+	for _, r := range s {
+		if r == '\t' {
+			r = ' '
+		}
+		if _, w, ok := winAnsi(r, bold); ok {
+			total += w
+		} else {
+			total += zhGlyphWidth
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// tokenize splits a paragraph into tokens
+func tokenize(s string, size float64, bold bool) []token {
+	var tokens []token
+	var word strings.Builder
+	flush := func(spaces string) {
+		if word.Len() == 0 && spaces == "" {
+			return
+		}
+		text := word.String()
+		tokens = append(tokens, token{
+			text:       text + spaces,
+			width:      textWidth(text, size, bold),
+			spaceWidth: textWidth(spaces, size, bold),
+		})
+		word.Reset()
+	}
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case isZh(r):
+			flush("")
+			tokens = append(tokens, token{text: string(r), zh: true, width: float64(zhGlyphWidth) * size / 1000})
+		case unicode.IsSpace(r):
+			j := i
+			for j < len(runes) && unicode.IsSpace(runes[j]) && !isZh(runes[j]) {
+				j++
+			}
+			flush(strings.Repeat(" ", j-i))
+			i = j - 1
+		default:
+			word.WriteRune(r)
+		}
+	}
+	flush("")
+	return tokens
+}
+
+// wrap breaks text into lines no wider than maxWidth, a word longer than a line is broken anywhere
+func wrap(text string, size float64, bold bool, maxWidth float64) []line {
+	var lines []line
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		var cur line
+		width := 0.0
+		for _, t := range tokenize(paragraph, size, bold) {
+			for _, part := range splitLongToken(t, size, bold, maxWidth) {
+				if len(cur) > 0 && width+part.width > maxWidth {
+					lines = append(lines, cur)
+					cur, width = nil, 0
+				}
+				cur = append(cur, part)
+				width += part.width + part.spaceWidth
+			}
+		}
+		lines = append(lines, cur)
+	}
+	return lines
+}
+
+func splitLongToken(t token, size float64, bold bool, maxWidth float64) []token {
+	if t.width <= maxWidth || t.zh {
+		return []token{t}
+	}
+	word := strings.TrimRight(t.text, " ")
+	spaces := t.text[len(word):]
+	var parts []token
+	var cur strings.Builder
+	for _, r := range word {
+		if cur.Len() > 0 && textWidth(cur.String()+string(r), size, bold) > maxWidth {
+			parts = append(parts, token{text: cur.String(), width: textWidth(cur.String(), size, bold)})
+			cur.Reset()
+		}
+		cur.WriteRune(r)
+	}
+	last := cur.String()
+	return append(parts, token{text: last + spaces, width: textWidth(last, size, bold), spaceWidth: t.spaceWidth})
+}
+
+func (l line) width() float64 {
+	w := 0.0
+	for i, t := range l {
+		w += t.width
+		if i < len(l)-1 {
+			w += t.spaceWidth
+		}
+	}
+	return w
+}
+
+// textOps returns the operators showing the line, runs of the same font are shown together
+func (l line) textOps(size float64, bold bool) string {
+	var b strings.Builder
+	latinFont := fontRegular
+	if bold {
+		latinFont = fontBold
+	}
+	for i := 0; i < len(l); {
+		j := i
+		for j < len(l) && l[j].zh == l[i].zh {
+			j++
+		}
+		var text strings.Builder
+		for _, t := range l[i:j] {
+			text.WriteString(t.text)
+		}
+		if l[i].zh {
+			if bold {
+				// MSung-Light has no bold variant, the glyphs are stroked as well
+				b.WriteString("2 Tr ")
+			}
+			fmt.Fprintf(&b, "/%s %.2f Tf %s Tj ", fontZh, size, encodeZh(text.String()))
+			if bold {
+				b.WriteString("0 Tr ")
+			}
+		} else {
+			fmt.Fprintf(&b, "/%s %.2f Tf %s Tj ", latinFont, size, encodeLatin(text.String(), bold))
+		}
+		i = j
+	}
+	return b.String()
+}
+
+// encodeLatin returns s as a PDF literal string in WinAnsiEncoding
+func encodeLatin(s string, bold bool) string {
+	var b bytes.Buffer
+	b.WriteByte('(')
+	for _, r := range s {
+		if r == '\t' {
+			r = ' '
+		}
+		c, _, ok := winAnsi(r, bold)
+		if !ok {
+			c = '?'
+		}
+		if c == '(' || c == ')' || c == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// encodeZh returns s as a PDF hex string in UCS-2, as expected by the UniCNS-UCS2-H encoding
+func encodeZh(s string) string {
+	var b strings.Builder
+	b.WriteByte('<')
+	for _, r := range s {
+		if r > 0xffff {
+			r = zhReplacement
+		}
+		fmt.Fprintf(&b, "%04X", r)
+	}
+	b.WriteByte('>')
+	return b.String()
+}
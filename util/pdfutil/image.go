@@ -0,0 +1,100 @@
+package pdfutil
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	_ "image/png"
+)
+
+// Quality of the JPEG images embedded, opaque images are embedded as JPEG
+const jpegQuality = 85
+
+// pdfImage is an image XObject
+type pdfImage struct {
+	name          string
+	width, height int
+	filter        string
+	colorSpace    string
+	data          []byte
+	// Alpha channel, nil for opaque images
+	mask []byte
+}
+
+type opaquer interface {
+	Opaque() bool
+}
+
+// newPdfImage encodes img, opaque images as JPEG and other images as RGB with a soft mask
+func newPdfImage(name string, img image.Image) (*pdfImage, error) {
+	b := img.Bounds()
+	if b.Empty() {
+		return nil, fmt.Errorf("image is empty")
+	}
+	result := &pdfImage{name: name, width: b.Dx(), height: b.Dy()}
+	if o, ok := img.(opaquer); ok && o.Opaque() {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, err
+		}
+		result.filter, result.data = "DCTDecode", buf.Bytes()
+		result.colorSpace = "DeviceRGB"
+		if _, gray := img.(*image.Gray); gray {
+			result.colorSpace = "DeviceGray"
+		}
+		return result, nil
+	}
+	nrgba := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(nrgba, nrgba.Bounds(), img, b.Min, draw.Src)
+	rgb := make([]byte, 0, b.Dx()*b.Dy()*3)
+	alpha := make([]byte, 0, b.Dx()*b.Dy())
+	for i := 0; i < len(nrgba.Pix); i += 4 {
+		rgb = append(rgb, nrgba.Pix[i], nrgba.Pix[i+1], nrgba.Pix[i+2])
+		alpha = append(alpha, nrgba.Pix[i+3])
+	}
+	var err error
+	if result.data, err = deflate(rgb); err != nil {
+		return nil, err
+	}
+	if result.mask, err = deflate(alpha); err != nil {
+		return nil, err
+	}
+	result.filter, result.colorSpace = "FlateDecode", "DeviceRGB"
+	return result, nil
+}
+
+// DecodeImage decodes a JPEG or PNG image. The EXIF orientation of photos is not applied,
+// media.DecodeImage should be used for photos taken by users.
+func DecodeImage(data []byte) (image.Image, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode image: %w", err)
+	}
+	return img, nil
+}
+
+// fitImage returns the size of an image of w x h scaled to fit in maxWidth x maxHeight, keeping its ratio.
+// A zero maxHeight does not limit the height.
+func fitImage(w, h int, maxWidth, maxHeight float64) (float64, float64) {
+	width, height := float64(w), float64(h)
+	scale := maxWidth / width
+	if maxHeight > 0 && height*scale > maxHeight {
+		scale = maxHeight / height
+	}
+	return width * scale, height * scale
+}
+
+func deflate(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,506 @@
+// Package pdfutil composes simple PDF reports, e.g. a follow up report with before and after photos,
+// without going through the document module. Text can mix English and Chinese.
+package pdfutil
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"strings"
+)
+
+// Page size and layout defaults, in points
+const (
+	A4Width         = 595.28
+	A4Height        = 841.89
+	DefaultMargin   = 40
+	DefaultFontSize = 10
+
+	lineSpacing        = 1.4
+	cellPadding        = 4
+	imageGap           = 10
+	defaultImageHeight = 300
+	signatureHeight    = 60
+	signaturesPerRow   = 3
+	headerTitleSize    = 14
+	headerSubtitleSize = 9
+	footerSize         = 8
+)
+
+type (
+	// Document is a PDF document laid out from top to bottom, a new page is added when the content
+	// does not fit in the current one. Set the exported fields before adding any content.
+	//
+	// No font is embedded, Chinese text relies on the MSung-Light font of the PDF reader:
+	//	- readers without an Asian font pack, e.g. Acrobat without the font pack or some printers,
+	//	  show blanks instead of the Chinese text
+	//	- the UniCNS-UCS2-H encoding only covers Traditional Chinese, characters only used in
+	//	  Simplified Chinese are not displayed
+	//	- bold Chinese text is simulated by stroking the glyph outlines
+	// Use the document module for reports which must display the same everywhere.
+	Document struct {
+		PageWidth, PageHeight float64
+		Margin                float64
+		FontSize              float64
+
+		title, subtitle string
+		pages           []*bytes.Buffer
+		// Distance from the top of the current page to where the next content is added
+		y      float64
+		images []*pdfImage
+	}
+	KeyValue struct {
+		Key   string
+		Value string
+	}
+	Column struct {
+		Title string
+		// Relative width of the column, columns share the page equally if all widths are zero
+		Width float64
+	}
+	Table struct {
+		Columns []Column
+		Rows    [][]string
+	}
+	ImageOptions struct {
+		// Defaults to the width of the page content
+		MaxWidth float64
+		// Defaults to 300
+		MaxHeight float64
+		Caption   string
+	}
+	// ImageCell is an image of ImageRow, Image can be nil to leave the cell empty, e.g. a missing after photo
+	ImageCell struct {
+		Image   image.Image
+		Caption string
+	}
+	// SignatureBlock is a signature with the details of the signer, Image can be nil if the user has no signature
+	SignatureBlock struct {
+		Image image.Image
+		Name  string
+		Title string
+		Date  string
+	}
+)
+
+// New returns an empty A4 document
+func New() *Document {
+	return &Document{
+		PageWidth:  A4Width,
+		PageHeight: A4Height,
+		Margin:     DefaultMargin,
+		FontSize:   DefaultFontSize,
+	}
+}
+
+// Bilingual returns the English and Chinese text on two lines, e.g. for a table header
+func Bilingual(en, zh string) string {
+	if en == "" || zh == "" {
+		return en + zh
+	}
+	return en + "\n" + zh
+}
+
+// SetHeader sets the header shown at the top of every page, e.g. the report name and contract number
+func (d *Document) SetHeader(title, subtitle string) {
+	d.title, d.subtitle = title, subtitle
+}
+
+// PageCount returns the number of pages so far
+func (d *Document) PageCount() int {
+	return len(d.pages)
+}
+
+// PageBreak starts a new page
+func (d *Document) PageBreak() {
+	d.newPage()
+}
+
+// Space adds vertical space, it does not continue on the next page
+func (d *Document) Space(height float64) {
+	d.page()
+	d.y += height
+	if d.y > d.bottom() {
+		d.y = d.bottom()
+	}
+}
+
+// Heading adds a bold title
+func (d *Document) Heading(text string) {
+	size := d.FontSize * 1.3
+	d.Space(d.FontSize * 0.6)
+	d.paragraph(text, size, true)
+	d.Space(d.FontSize * 0.3)
+}
+
+// Text adds a paragraph wrapped to the page width, newlines start a new line
+func (d *Document) Text(text string) {
+	d.paragraph(text, d.FontSize, false)
+}
+
+// BilingualText adds the English text followed by the Chinese text
+func (d *Document) BilingualText(en, zh string) {
+	d.Text(Bilingual(en, zh))
+}
+
+// KeyValues adds a table of two columns with the keys in bold, e.g. the contract information
+func (d *Document) KeyValues(rows ...KeyValue) {
+	widths := d.columnWidths([]Column{{Width: 1}, {Width: 2}})
+	for _, r := range rows {
+		d.row(widths, []string{r.Key, r.Value}, false, true, nil)
+	}
+	d.Space(d.FontSize * 0.6)
+}
+
+// Table adds a table, the header is repeated on every page the table spans
+func (d *Document) Table(t Table) {
+	if len(t.Columns) == 0 {
+		return
+	}
+	widths := d.columnWidths(t.Columns)
+	header := make([]string, len(t.Columns))
+	hasHeader := false
+	for i, c := range t.Columns {
+		header[i] = c.Title
+		hasHeader = hasHeader || c.Title != ""
+	}
+	var onBreak func()
+	if hasHeader {
+		onBreak = func() { d.row(widths, header, true, false, nil) }
+		onBreak()
+	}
+	for _, r := range t.Rows {
+		d.row(widths, r, false, false, onBreak)
+	}
+	d.Space(d.FontSize * 0.6)
+}
+
+// Image adds an image scaled to fit in the page width and opts.MaxHeight
+func (d *Document) Image(img image.Image, opts ImageOptions) error {
+	maxWidth, maxHeight := d.contentWidth(), opts.MaxHeight
+	if opts.MaxWidth > 0 && opts.MaxWidth < maxWidth {
+		maxWidth = opts.MaxWidth
+	}
+	if maxHeight <= 0 {
+		maxHeight = defaultImageHeight
+	}
+	return d.ImageRow([]ImageCell{{Image: img, Caption: opts.Caption}}, maxWidth, maxHeight)
+}
+
+// ImageRow adds images side by side, e.g. before and after photos. Each image is scaled to fit
+// in width / len(cells) and maxHeight, width defaults to the page width and maxHeight to 300.
+func (d *Document) ImageRow(cells []ImageCell, width, maxHeight float64) error {
+	if len(cells) == 0 {
+		return nil
+	}
+	if width <= 0 || width > d.contentWidth() {
+		width = d.contentWidth()
+	}
+	if maxHeight <= 0 {
+		maxHeight = defaultImageHeight
+	}
+	cellWidth := (width - imageGap*float64(len(cells)-1)) / float64(len(cells))
+	type placed struct {
+		img           *pdfImage
+		width, height float64
+		caption       []line
+	}
+	placements := make([]placed, len(cells))
+	rowHeight, captionHeight := 0.0, 0.0
+	captionSize := d.FontSize * 0.9
+	for i, c := range cells {
+		p := placed{width: cellWidth}
+		if c.Image != nil {
+			img, err := d.addImage(c.Image)
+			if err != nil {
+				return err
+			}
+			p.img = img
+			p.width, p.height = fitImage(img.width, img.height, cellWidth, maxHeight)
+		}
+		if c.Caption != "" {
+			p.caption = wrap(c.Caption, captionSize, false, cellWidth)
+		}
+		if p.height > rowHeight {
+			rowHeight = p.height
+		}
+		if h := float64(len(p.caption)) * captionSize * lineSpacing; h > captionHeight {
+			captionHeight = h
+		}
+		placements[i] = p
+	}
+	if rowHeight == 0 {
+		// No image at all, the empty cells are drawn at the maximum height
+		rowHeight = maxHeight
+	}
+	d.ensure(rowHeight + captionHeight)
+	for i, p := range placements {
+		x := d.Margin + float64(i)*(cellWidth+imageGap)
+		if p.img != nil {
+			d.drawImage(p.img, x+(cellWidth-p.width)/2, d.y, p.width, p.height)
+		} else {
+			d.rect(x, d.y, cellWidth, rowHeight, false)
+		}
+		y := d.y + rowHeight
+		for _, l := range p.caption {
+			d.textLine(l, x+(cellWidth-l.width())/2, y, captionSize, false)
+			y += captionSize * lineSpacing
+		}
+	}
+	d.y += rowHeight + captionHeight + d.FontSize*0.6
+	return nil
+}
+
+// Signatures adds the signatures side by side, up to 3 per row
+func (d *Document) Signatures(blocks ...SignatureBlock) error {
+	cellWidth := (d.contentWidth() - imageGap*(signaturesPerRow-1)) / signaturesPerRow
+	size := d.FontSize * 0.9
+	for start := 0; start < len(blocks); start += signaturesPerRow {
+		end := start + signaturesPerRow
+		if end > len(blocks) {
+			end = len(blocks)
+		}
+		row := blocks[start:end]
+		textLines := make([][]line, len(row))
+		textHeight := 0.0
+		for i, b := range row {
+			for _, text := range []string{b.Name, b.Title, b.Date} {
+				if text != "" {
+					textLines[i] = append(textLines[i], wrap(text, size, false, cellWidth)...)
+				}
+			}
+			if h := float64(len(textLines[i])) * size * lineSpacing; h > textHeight {
+				textHeight = h
+			}
+		}
+		d.ensure(signatureHeight + cellPadding + textHeight)
+		for i, b := range row {
+			x := d.Margin + float64(i)*(cellWidth+imageGap)
+			if b.Image != nil {
+				img, err := d.addImage(b.Image)
+				if err != nil {
+					return err
+				}
+				w, h := fitImage(img.width, img.height, cellWidth, signatureHeight)
+				d.drawImage(img, x, d.y+signatureHeight-h, w, h)
+			}
+			d.hline(x, x+cellWidth, d.y+signatureHeight)
+			y := d.y + signatureHeight + cellPadding
+			for _, l := range textLines[i] {
+				d.textLine(l, x, y, size, false)
+				y += size * lineSpacing
+			}
+		}
+		d.y += signatureHeight + cellPadding + textHeight + d.FontSize
+	}
+	return nil
+}
+
+// Bytes returns the PDF file
+func (d *Document) Bytes() ([]byte, error) {
+	d.page()
+	return d.encode()
+}
+
+// WriteTo writes the PDF file to w
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	b, err := d.Bytes()
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(b)
+	return int64(n), err
+}
+
+func (d *Document) paragraph(text string, size float64, bold bool) {
+	d.page()
+	for _, l := range wrap(text, size, bold, d.contentWidth()) {
+		d.ensure(size * lineSpacing)
+		d.textLine(l, d.Margin, d.y, size, bold)
+		d.y += size * lineSpacing
+	}
+}
+
+// row adds a row of a table, onBreak is called if the row starts a new page
+func (d *Document) row(widths []float64, cells []string, header, boldFirst bool, onBreak func()) {
+	d.page()
+	size := d.FontSize
+	lines := make([][]line, len(widths))
+	height := 0.0
+	for i := range widths {
+		if i >= len(cells) {
+			continue
+		}
+		lines[i] = wrap(cells[i], size, header || (boldFirst && i == 0), widths[i]-2*cellPadding)
+		if h := float64(len(lines[i]))*size*lineSpacing + 2*cellPadding; h > height {
+			height = h
+		}
+	}
+	if d.ensure(height) && onBreak != nil {
+		onBreak()
+	}
+	x := d.Margin
+	for i, w := range widths {
+		if header {
+			d.fill(x, d.y, w, height, 0.9)
+		}
+		d.rect(x, d.y, w, height, false)
+		y := d.y + cellPadding
+		for _, l := range lines[i] {
+			d.textLine(l, x+cellPadding, y, size, header || (boldFirst && i == 0))
+			y += size * lineSpacing
+		}
+		x += w
+	}
+	d.y += height
+}
+
+func (d *Document) columnWidths(columns []Column) []float64 {
+	total := 0.0
+	for _, c := range columns {
+		total += c.Width
+	}
+	widths := make([]float64, len(columns))
+	for i, c := range columns {
+		if total > 0 {
+			widths[i] = d.contentWidth() * c.Width / total
+		} else {
+			widths[i] = d.contentWidth() / float64(len(columns))
+		}
+	}
+	return widths
+}
+
+func (d *Document) contentWidth() float64 {
+	return d.PageWidth - 2*d.Margin
+}
+
+func (d *Document) bottom() float64 {
+	return d.PageHeight - d.Margin
+}
+
+// page returns the content of the current page, adding the first page if needed
+func (d *Document) page() *bytes.Buffer {
+	if len(d.pages) == 0 {
+		d.newPage()
+	}
+	return d.pages[len(d.pages)-1]
+}
+
+// ensure starts a new page if height does not fit in the current one, returns true if a page is added.
+// Content taller than a page is added to an empty page anyway.
+func (d *Document) ensure(height float64) bool {
+	d.page()
+	if d.y+height <= d.bottom() || d.y <= d.top() {
+		return false
+	}
+	d.newPage()
+	return true
+}
+
+// top returns where the content starts below the header
+func (d *Document) top() float64 {
+	top := d.Margin
+	if d.title != "" {
+		top += headerTitleSize * lineSpacing
+	}
+	if d.subtitle != "" {
+		top += headerSubtitleSize * lineSpacing
+	}
+	if top > d.Margin {
+		top += d.FontSize
+	}
+	return top
+}
+
+func (d *Document) newPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+	d.y = d.Margin
+	if d.title != "" {
+		for _, l := range wrap(d.title, headerTitleSize, true, d.contentWidth())[:1] {
+			d.textLine(l, d.Margin, d.y, headerTitleSize, true)
+		}
+		d.y += headerTitleSize * lineSpacing
+	}
+	if d.subtitle != "" {
+		for _, l := range wrap(d.subtitle, headerSubtitleSize, false, d.contentWidth())[:1] {
+			d.textLine(l, d.Margin, d.y, headerSubtitleSize, false)
+		}
+		d.y += headerSubtitleSize * lineSpacing
+	}
+	if d.y > d.Margin {
+		d.hline(d.Margin, d.PageWidth-d.Margin, d.y)
+		d.y += d.FontSize
+	}
+}
+
+// footer returns the operators of the page number shown at the bottom of page i
+func (d *Document) footer(i int) string {
+	text := fmt.Sprintf("Page %d of %d", i+1, len(d.pages))
+	x := d.PageWidth - d.Margin - textWidth(text, footerSize, false)
+	return fmt.Sprintf("BT %.2f %.2f Td /%s %d Tf %s Tj ET\n", x, d.Margin/2, fontRegular, footerSize, encodeLatin(text, false))
+}
+
+func (d *Document) addImage(img image.Image) (*pdfImage, error) {
+	result, err := newPdfImage(fmt.Sprintf("Im%d", len(d.images)+1), img)
+	if err != nil {
+		return nil, err
+	}
+	d.images = append(d.images, result)
+	return result, nil
+}
+
+// Drawing operators, coordinates are from the top left corner of the page while PDF coordinates are
+// from the bottom left corner.
+
+func (d *Document) textLine(l line, x, top, size float64, bold bool) {
+	if len(l) == 0 {
+		return
+	}
+	baseline := d.PageHeight - top - size*0.8
+	if bold {
+		// Stroke width of the Chinese glyphs in bold
+		fmt.Fprintf(d.page(), "%.2f w ", size*0.03)
+	}
+	fmt.Fprintf(d.page(), "BT %.2f %.2f Td %sET\n", x, baseline, l.textOps(size, bold))
+}
+
+func (d *Document) rect(x, top, w, h float64, filled bool) {
+	op := "S"
+	if filled {
+		op = "f"
+	}
+	fmt.Fprintf(d.page(), "0.5 w %.2f %.2f %.2f %.2f re %s\n", x, d.PageHeight-top-h, w, h, op)
+}
+
+func (d *Document) fill(x, top, w, h, gray float64) {
+	fmt.Fprintf(d.page(), "%.2f g ", gray)
+	d.rect(x, top, w, h, true)
+	fmt.Fprint(d.page(), "0 g\n")
+}
+
+func (d *Document) hline(x1, x2, top float64) {
+	y := d.PageHeight - top
+	fmt.Fprintf(d.page(), "0.5 w %.2f %.2f m %.2f %.2f l S\n", x1, y, x2, y)
+}
+
+func (d *Document) drawImage(img *pdfImage, x, top, w, h float64) {
+	fmt.Fprintf(d.page(), "q %.2f 0 0 %.2f %.2f %.2f cm /%s Do Q\n", w, h, x, d.PageHeight-top-h, img.name)
+}
+
+// encodeTextString encodes s as a PDF text string in UTF-16BE, used by the document information
+func encodeTextString(s string) string {
+	var b strings.Builder
+	b.WriteString("<FEFF")
+	for _, r := range s {
+		if r > 0xffff {
+			r -= 0x10000
+			fmt.Fprintf(&b, "%04X%04X", 0xd800+(r>>10), 0xdc00+(r&0x3ff))
+			continue
+		}
+		fmt.Fprintf(&b, "%04X", r)
+	}
+	b.WriteByte('>')
+	return b.String()
+}
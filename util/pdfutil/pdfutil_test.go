@@ -0,0 +1,173 @@
+package pdfutil
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		maxWidth float64
+		want     []string
+	}{
+		{
+			name:     "Test fits on one line",
+			text:     "Follow up",
+			maxWidth: 100,
+			want:     []string{"Follow up"},
+		},
+		{
+			name:     "Test wraps at spaces",
+			text:     "aaaa bbbb cccc",
+			maxWidth: 60,
+			want:     []string{"aaaa bbbb ", "cccc"},
+		},
+		{
+			name:     "Test wraps between Chinese characters",
+			text:     "跟進報告",
+			maxWidth: 25,
+			want:     []string{"跟進", "報告"},
+		},
+		{
+			name:     "Test breaks a long word",
+			text:     "aaaaaaaaaa",
+			maxWidth: 30,
+			want:     []string{"aaaaa", "aaaaa"},
+		},
+		{
+			name:     "Test keeps newlines",
+			text:     "Before\n\n之前",
+			maxWidth: 100,
+			want:     []string{"Before", "", "之前"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, l := range wrap(tt.text, 10, false, tt.maxWidth) {
+				var b strings.Builder
+				for _, tk := range l {
+					b.WriteString(tk.text)
+				}
+				got = append(got, b.String())
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("wrap() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeText(t *testing.T) {
+	if got := encodeLatin(`a(b)\c – é`, false); got != "(a\\(b\\)\\\\c \x96 \xe9)" {
+		t.Errorf("encodeLatin() = %q", got)
+	}
+	if got := encodeZh("中文"); got != "<4E2D6587>" {
+		t.Errorf("encodeZh() = %q", got)
+	}
+	if got := (line{{text: "Site ", width: 1}, {text: "工", zh: true}, {text: "地", zh: true}}).textOps(10, false); got != "/F1 10.00 Tf (Site ) Tj /F3 10.00 Tf <5DE55730> Tj " {
+		t.Errorf("textOps() = %q", got)
+	}
+}
+
+func TestDocument(t *testing.T) {
+	opaque := image.NewRGBA(image.Rect(0, 0, 40, 30))
+	transparent := image.NewNRGBA(image.Rect(0, 0, 20, 10))
+	for x := 0; x < 40; x++ {
+		for y := 0; y < 30; y++ {
+			opaque.Set(x, y, color.RGBA{R: 200, A: 255})
+		}
+	}
+	transparent.Set(5, 5, color.NRGBA{B: 255, A: 255})
+
+	d := New()
+	d.SetHeader("Follow Up Report 跟進報告", "Contract ABC-123")
+	d.Heading("Contract Information")
+	d.KeyValues(KeyValue{Key: Bilingual("Contract No.", "合約編號"), Value: "ABC-123"})
+	rows := make([][]string, 100)
+	for i := range rows {
+		rows[i] = []string{strconv.Itoa(i + 1), "Remove debris 清理雜物"}
+	}
+	d.Table(Table{Columns: []Column{{Title: "No.", Width: 1}, {Title: "Description", Width: 4}}, Rows: rows})
+	if err := d.ImageRow([]ImageCell{{Image: opaque, Caption: "Before"}, {Caption: "After"}}, 0, 200); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Signatures(SignatureBlock{Image: transparent, Name: "Chan Tai Man", Date: "2024-01-01"}); err != nil {
+		t.Fatal(err)
+	}
+	pdf, err := d.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+		t.Fatalf("not a PDF file")
+	}
+	// Every entry of the cross-reference table must point to its object
+	startxref := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(pdf)
+	if startxref == nil {
+		t.Fatalf("no startxref")
+	}
+	xref, _ := strconv.Atoi(string(startxref[1]))
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(pdf[xref:], -1)
+	for i, e := range entries {
+		offset, _ := strconv.Atoi(string(e[1]))
+		if want := fmt.Sprintf("%d 0 obj", i+1); !bytes.HasPrefix(pdf[offset:], []byte(want)) {
+			t.Errorf("xref entry %d does not point to %s", i+1, want)
+		}
+	}
+
+	pages := d.PageCount()
+	if pages < 2 {
+		t.Errorf("expected the table to span multiple pages, got %d", pages)
+	}
+	if !bytes.Contains(pdf, []byte(fmt.Sprintf("/Count %d >>", pages))) {
+		t.Errorf("expected %d pages", pages)
+	}
+	if n := bytes.Count(pdf, []byte("/Subtype /Image")); n != 3 {
+		t.Errorf("expected an image, a signature and its mask, got %d images", n)
+	}
+	if !bytes.Contains(pdf, []byte("/Filter /DCTDecode")) || !bytes.Contains(pdf, []byte("/SMask")) {
+		t.Errorf("expected a JPEG image and a transparent image")
+	}
+
+	// The header is repeated on every page and the last page has the page number
+	contents := regexp.MustCompile(`obj\n<< /Filter /FlateDecode /Length (\d+) >>\nstream\n`).FindAllSubmatchIndex(pdf, -1)
+	var decoded []string
+	for _, c := range contents {
+		length, _ := strconv.Atoi(string(pdf[c[2]:c[3]]))
+		r, err := zlib.NewReader(bytes.NewReader(pdf[c[1] : c[1]+length]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded = append(decoded, string(b))
+	}
+	if len(decoded) != pages {
+		t.Fatalf("expected %d page contents, got %d", pages, len(decoded))
+	}
+	for i, c := range decoded {
+		if !strings.Contains(c, "(Follow Up Report ) Tj 2 Tr /F3 14.00 Tf <8DDF90325831544A> Tj 0 Tr") {
+			t.Errorf("page %d has no header", i+1)
+		}
+		if !strings.Contains(c, fmt.Sprintf("(Page %d of %d) Tj", i+1, pages)) {
+			t.Errorf("page %d has no page number", i+1)
+		}
+		if i > 0 && i < pages-1 && !strings.Contains(c, "/F2 10.00 Tf (Description) Tj") {
+			t.Errorf("table header not repeated on page %d", i+1)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package pdfutil
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// writer writes the objects of a PDF file and records their offsets for the cross-reference table
+type writer struct {
+	buf     bytes.Buffer
+	offsets []int
+}
+
+// alloc reserves the number of a new object
+func (w *writer) alloc() int {
+	w.offsets = append(w.offsets, 0)
+	return len(w.offsets)
+}
+
+func (w *writer) object(n int, body string) {
+	w.offsets[n-1] = w.buf.Len()
+	fmt.Fprintf(&w.buf, "%d 0 obj\n%s\nendobj\n", n, body)
+}
+
+func (w *writer) stream(n int, dict string, data []byte) {
+	w.offsets[n-1] = w.buf.Len()
+	fmt.Fprintf(&w.buf, "%d 0 obj\n<< %s /Length %d >>\nstream\n", n, dict, len(data))
+	w.buf.Write(data)
+	w.buf.WriteString("\nendstream\nendobj\n")
+}
+
+// encode writes the document, fonts and images are shared by all pages
+func (d *Document) encode() ([]byte, error) {
+	w := &writer{}
+	w.buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	catalog, pages, info := w.alloc(), w.alloc(), w.alloc()
+	regular, bold, zh, zhDescendant, zhDescriptor := w.alloc(), w.alloc(), w.alloc(), w.alloc(), w.alloc()
+
+	w.object(regular, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	w.object(bold, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	w.object(zh, fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /%s /Encoding /UniCNS-UCS2-H /DescendantFonts [%d 0 R] >>",
+		zhFontName, zhDescendant))
+	w.object(zhDescendant, fmt.Sprintf("<< /Type /Font /Subtype /CIDFontType0 /BaseFont /%s "+
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (CNS1) /Supplement 0 >> /FontDescriptor %d 0 R /DW %d /W [1 95 500] >>",
+		zhFontName, zhDescriptor, zhGlyphWidth))
+	w.object(zhDescriptor, fmt.Sprintf("<< /Type /FontDescriptor /FontName /%s /Flags 6 /FontBBox [-160 -249 1015 1071] "+
+		"/ItalicAngle 0 /Ascent 880 /Descent -120 /CapHeight 880 /StemV 93 >>", zhFontName))
+
+	var xObjects strings.Builder
+	for _, img := range d.images {
+		n := w.alloc()
+		dict := fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /%s /BitsPerComponent 8 /Filter /%s",
+			img.width, img.height, img.colorSpace, img.filter)
+		if img.mask != nil {
+			mask := w.alloc()
+			w.stream(mask, fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceGray "+
+				"/BitsPerComponent 8 /Filter /FlateDecode", img.width, img.height), img.mask)
+			dict += fmt.Sprintf(" /SMask %d 0 R", mask)
+		}
+		w.stream(n, dict, img.data)
+		fmt.Fprintf(&xObjects, "/%s %d 0 R ", img.name, n)
+	}
+	resources := fmt.Sprintf("<< /Font << /%s %d 0 R /%s %d 0 R /%s %d 0 R >> /XObject << %s>> >>",
+		fontRegular, regular, fontBold, bold, fontZh, zh, xObjects.String())
+
+	kids := make([]string, len(d.pages))
+	for i, content := range d.pages {
+		page, contents := w.alloc(), w.alloc()
+		data, err := deflate(append(append([]byte{}, content.Bytes()...), d.footer(i)...))
+		if err != nil {
+			return nil, err
+		}
+		w.stream(contents, "/Filter /FlateDecode", data)
+		w.object(page, fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.2f %.2f] /Resources %s /Contents %d 0 R >>",
+			pages, d.PageWidth, d.PageHeight, resources, contents))
+		kids[i] = fmt.Sprintf("%d 0 R", page)
+	}
+	w.object(pages, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	w.object(catalog, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pages))
+	infoDict := "<< /Producer (be-common-mdl pdfutil)"
+	if d.title != "" {
+		infoDict += " /Title " + encodeTextString(d.title)
+	}
+	w.object(info, infoDict+" >>")
+
+	xref := w.buf.Len()
+	fmt.Fprintf(&w.buf, "xref\n0 %d\n0000000000 65535 f \n", len(w.offsets)+1)
+	for _, offset := range w.offsets {
+		fmt.Fprintf(&w.buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&w.buf, "trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		len(w.offsets)+1, catalog, info, xref)
+	return w.buf.Bytes(), nil
+}